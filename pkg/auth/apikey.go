@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APIKeyPrefix starts every API key. Keys have the form "wsk_<id>_<secret>": the id is
+// public and used for lookup (safe to log and show in UIs), the secret is only ever
+// stored as a SHA-256 hash.
+const APIKeyPrefix = "wsk_"
+
+var (
+	// ErrInvalidAPIKey indicates the key is malformed, unknown, expired, or does not match.
+	// Do not expose which to clients.
+	ErrInvalidAPIKey = errors.New("auth: invalid api key")
+
+	// ErrAPIKeyNotFound is returned by APIKeyStore implementations for unknown ids.
+	ErrAPIKeyNotFound = errors.New("auth: api key not found")
+
+	// ErrAPIKeyUnavailable indicates the key store could not be consulted.
+	ErrAPIKeyUnavailable = errors.New("auth: api key store unavailable")
+)
+
+// APIKey is the stored form of an API key. It never contains the secret.
+type APIKey struct {
+	ID       string
+	Hash     []byte
+	Subject  string
+	TenantID string
+	Scopes   []string
+
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // zero means no expiry
+	LastUsedAt time.Time
+}
+
+// APIKeyStore persists API keys by id.
+type APIKeyStore interface {
+	// LookupAPIKey returns ErrAPIKeyNotFound for unknown ids.
+	LookupAPIKey(ctx context.Context, id string) (APIKey, error)
+
+	// TouchAPIKey records that the key was used at the given time.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// NewAPIKey generates a key for subject in tenant. The returned plaintext must be shown
+// to the caller once; only the returned APIKey (holding the hash) should be stored.
+func NewAPIKey(subject, tenantID string, scopes []string, expiresAt time.Time) (string, APIKey, error) {
+	if strings.TrimSpace(subject) == "" {
+		return "", APIKey{}, errors.New("auth: api key requires subject")
+	}
+	if strings.TrimSpace(tenantID) == "" {
+		return "", APIKey{}, errors.New("auth: api key requires tenant_id")
+	}
+
+	var id [8]byte
+	var secret [32]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", APIKey{}, fmt.Errorf("auth: generate api key: %w", err)
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", APIKey{}, fmt.Errorf("auth: generate api key: %w", err)
+	}
+
+	k := APIKey{
+		ID:        hex.EncodeToString(id[:]),
+		Subject:   subject,
+		TenantID:  tenantID,
+		Scopes:    append([]string(nil), scopes...),
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	plaintext := APIKeyPrefix + k.ID + "_" + base64.RawURLEncoding.EncodeToString(secret[:])
+	k.Hash = HashAPIKey(plaintext)
+	return plaintext, k, nil
+}
+
+// HashAPIKey returns the value stored in APIKey.Hash for a plaintext key.
+// Keys carry 256 bits of randomness, so a fast hash is sufficient.
+func HashAPIKey(plaintext string) []byte {
+	sum := sha256.Sum256([]byte(plaintext))
+	return sum[:]
+}
+
+// ParseAPIKeyID extracts the public id from a plaintext key.
+func ParseAPIKeyID(plaintext string) (string, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(plaintext), APIKeyPrefix)
+	if !ok {
+		return "", ErrInvalidAPIKey
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", ErrInvalidAPIKey
+	}
+	return id, nil
+}
+
+// IsAPIKey reports whether s looks like an API key (it is not validated).
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), APIKeyPrefix)
+}
+
+// APIKeyVerifier authenticates plaintext API keys against a store.
+type APIKeyVerifier struct {
+	Store APIKeyStore
+
+	// TouchInterval throttles last-used updates to one write per key per interval.
+	// Defaults to 1m. Touch failures never fail authentication.
+	TouchInterval time.Duration
+
+	now func() time.Time
+}
+
+// Verify checks key and returns claims equivalent to a JWT for the same principal.
+// Store failures return ErrAPIKeyUnavailable; every other failure returns ErrInvalidAPIKey.
+func (v *APIKeyVerifier) Verify(ctx context.Context, key string) (*Claims, error) {
+	if v.Store == nil {
+		return nil, errors.New("auth: api key verifier requires store")
+	}
+
+	key = strings.TrimSpace(key)
+	id, err := ParseAPIKeyID(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := v.Store.LookupAPIKey(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPIKeyUnavailable, err)
+	}
+	if subtle.ConstantTimeCompare(HashAPIKey(key), stored.Hash) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	t := now()
+	if !stored.ExpiresAt.IsZero() && !t.Before(stored.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+	if strings.TrimSpace(stored.Subject) == "" || strings.TrimSpace(stored.TenantID) == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	interval := v.TouchInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if t.Sub(stored.LastUsedAt) >= interval {
+		_ = v.Store.TouchAPIKey(ctx, id, t)
+	}
+
+	claims := &Claims{
+		TenantID: stored.TenantID,
+		Scopes:   append([]string(nil), stored.Scopes...),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: stored.Subject,
+			ID:      stored.ID,
+		},
+	}
+	if !stored.CreatedAt.IsZero() {
+		claims.IssuedAt = jwt.NewNumericDate(stored.CreatedAt)
+	}
+	if !stored.ExpiresAt.IsZero() {
+		claims.ExpiresAt = jwt.NewNumericDate(stored.ExpiresAt)
+	}
+	return claims, nil
+}
+
+// MemoryAPIKeyStore is an in-process APIKeyStore, suitable for tests and static configuration.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// NewMemoryAPIKeyStore returns a store holding keys.
+func NewMemoryAPIKeyStore(keys ...APIKey) *MemoryAPIKeyStore {
+	s := &MemoryAPIKeyStore{keys: map[string]APIKey{}}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s
+}
+
+// Put adds or replaces a key.
+func (s *MemoryAPIKeyStore) Put(k APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+}
+
+// Delete removes a key.
+func (s *MemoryAPIKeyStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+}
+
+// LookupAPIKey implements APIKeyStore.
+func (s *MemoryAPIKeyStore) LookupAPIKey(ctx context.Context, id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	k.Scopes = append([]string(nil), k.Scopes...)
+	return k, nil
+}
+
+// TouchAPIKey implements APIKeyStore.
+func (s *MemoryAPIKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	k.LastUsedAt = at
+	s.keys[id] = k
+	return nil
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SQLAPIKeyStore is a Postgres-backed APIKeyStore. Open the *sql.DB with db.Open.
+type SQLAPIKeyStore struct {
+	db *sql.DB
+}
+
+// NewSQLAPIKeyStore returns a store on db. Call EnsureAPIKeyTables once at startup
+// (or ship the equivalent DDL in your migrations).
+func NewSQLAPIKeyStore(db *sql.DB) *SQLAPIKeyStore {
+	if db == nil {
+		panic("auth.NewSQLAPIKeyStore requires non-nil db")
+	}
+	return &SQLAPIKeyStore{db: db}
+}
+
+// EnsureAPIKeyTables creates the API key table if it does not exist.
+func EnsureAPIKeyTables(ctx context.Context, db *sql.DB) error {
+	if db == nil {
+		return errors.New("auth: nil db")
+	}
+
+	const ddl = `
+CREATE TABLE IF NOT EXISTS auth_api_keys (
+	id TEXT PRIMARY KEY,
+	hash BYTEA NOT NULL,
+	subject TEXT NOT NULL,
+	tenant_id TEXT NOT NULL,
+	scopes TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS auth_api_keys_tenant_id_idx
+	ON auth_api_keys (tenant_id);
+`
+	_, err := db.ExecContext(ctx, ddl)
+	return err
+}
+
+// Create stores k. Scopes are stored space-separated, like the OAuth "scope" parameter.
+func (s *SQLAPIKeyStore) Create(ctx context.Context, k APIKey) error {
+	if k.ID == "" || len(k.Hash) == 0 {
+		return errors.New("auth: api key requires id and hash")
+	}
+
+	const q = `
+INSERT INTO auth_api_keys (id, hash, subject, tenant_id, scopes, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+`
+	created := k.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, q,
+		k.ID, k.Hash, k.Subject, k.TenantID, strings.Join(k.Scopes, " "),
+		created.UTC(), nullTime(k.ExpiresAt),
+	)
+	return err
+}
+
+// Delete removes a key. Deleting an unknown key is not an error.
+func (s *SQLAPIKeyStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM auth_api_keys WHERE id = $1;`, id)
+	return err
+}
+
+// LookupAPIKey implements APIKeyStore.
+func (s *SQLAPIKeyStore) LookupAPIKey(ctx context.Context, id string) (APIKey, error) {
+	const q = `
+SELECT id, hash, subject, tenant_id, scopes, created_at, expires_at, last_used_at
+FROM auth_api_keys
+WHERE id = $1;
+`
+	var (
+		k        APIKey
+		scopes   string
+		expires  sql.NullTime
+		lastUsed sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, q, id).Scan(
+		&k.ID, &k.Hash, &k.Subject, &k.TenantID, &scopes, &k.CreatedAt, &expires, &lastUsed,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	k.ExpiresAt = expires.Time
+	k.LastUsedAt = lastUsed.Time
+	return k, nil
+}
+
+// TouchAPIKey implements APIKeyStore.
+func (s *SQLAPIKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE auth_api_keys SET last_used_at = GREATEST(last_used_at, $2) WHERE id = $1;`,
+		id, at.UTC(),
+	)
+	return err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,51 @@
+//go:build integration
+// +build integration
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+	wstest "github.com/hanzy-dev/saas-ws-lib/pkg/testkit"
+)
+
+func TestSQLAPIKeyStore(t *testing.T) {
+	db := wstest.OpenTestDB(t)
+	ctx := wstest.WithTimeout(t, 5*time.Second)
+
+	if err := auth.EnsureAPIKeyTables(ctx, db); err != nil {
+		t.Fatalf("ensure tables: %v", err)
+	}
+	s := auth.NewSQLAPIKeyStore(db)
+
+	plain, k, err := auth.NewAPIKey("u1", "t1", []string{"orders:read", "orders:write"}, time.Time{})
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	if err := s.Create(ctx, k); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Delete(context.Background(), k.ID) })
+
+	v := &auth.APIKeyVerifier{Store: s}
+	claims, err := v.Verify(ctx, plain)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Subject != "u1" || claims.TenantID != "t1" || len(claims.Scopes) != 2 {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	got, err := s.LookupAPIKey(ctx, k.ID)
+	if err != nil || got.LastUsedAt.IsZero() || !got.ExpiresAt.IsZero() {
+		t.Fatalf("key=%+v err=%v", got, err)
+	}
+
+	if _, err := s.LookupAPIKey(ctx, "missing"); !errors.Is(err, auth.ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
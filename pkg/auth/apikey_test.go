@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingAPIKeyStore struct{}
+
+func (failingAPIKeyStore) LookupAPIKey(ctx context.Context, id string) (APIKey, error) {
+	return APIKey{}, errors.New("db down")
+}
+
+func (failingAPIKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	return errors.New("db down")
+}
+
+func TestNewAPIKey(t *testing.T) {
+	t.Parallel()
+
+	plain, k, err := NewAPIKey("u1", "t1", []string{"orders:read"}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !strings.HasPrefix(plain, APIKeyPrefix+k.ID+"_") {
+		t.Fatalf("unexpected key format %q", plain)
+	}
+	if strings.Contains(string(k.Hash), plain) || len(k.Hash) != 32 {
+		t.Fatalf("expected sha256 hash only")
+	}
+	if id, err := ParseAPIKeyID(plain); err != nil || id != k.ID {
+		t.Fatalf("id=%q err=%v", id, err)
+	}
+
+	if _, _, err := NewAPIKey("", "t1", nil, time.Time{}); err == nil {
+		t.Fatalf("expected error without subject")
+	}
+	if _, _, err := NewAPIKey("u1", " ", nil, time.Time{}); err == nil {
+		t.Fatalf("expected error without tenant")
+	}
+}
+
+func TestParseAPIKeyID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		id   string
+		fail bool
+	}{
+		{"wsk_abc_secret", "abc", false},
+		{"wsk_abc_sec_ret", "abc", false},
+		{" wsk_abc_secret ", "abc", false},
+		{"wsk_abc", "", true},
+		{"wsk__secret", "", true},
+		{"wsk_abc_", "", true},
+		{"sk_abc_secret", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		id, err := ParseAPIKeyID(tt.in)
+		if tt.fail {
+			if !errors.Is(err, ErrInvalidAPIKey) {
+				t.Fatalf("%q: expected ErrInvalidAPIKey, got %v", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || id != tt.id {
+			t.Fatalf("%q: id=%q err=%v", tt.in, id, err)
+		}
+	}
+}
+
+func TestAPIKeyVerifier(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	plain, k, _ := NewAPIKey("u1", "t1", []string{"orders:read"}, now.Add(time.Hour))
+	expiredPlain, expired, _ := NewAPIKey("u2", "t1", nil, now.Add(-time.Second))
+	store := NewMemoryAPIKeyStore(k, expired)
+
+	v := &APIKeyVerifier{Store: store, TouchInterval: time.Minute, now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	claims, err := v.Verify(ctx, plain)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if claims.Subject != "u1" || claims.TenantID != "t1" || len(claims.Scopes) != 1 || claims.ID != k.ID {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	got, _ := store.LookupAPIKey(ctx, k.ID)
+	if !got.LastUsedAt.Equal(now) {
+		t.Fatalf("expected last used to be recorded")
+	}
+
+	// touch is throttled
+	first := now
+	now = now.Add(30 * time.Second)
+	_, _ = v.Verify(ctx, plain)
+	if got, _ := store.LookupAPIKey(ctx, k.ID); !got.LastUsedAt.Equal(first) {
+		t.Fatalf("expected touch to be throttled")
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"malformed", "nope"},
+		{"unknown id", "wsk_0000_secret"},
+		{"wrong secret", APIKeyPrefix + k.ID + "_wrong"},
+		{"expired", expiredPlain},
+	}
+	for _, tt := range tests {
+		if _, err := v.Verify(ctx, tt.key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("%s: expected ErrInvalidAPIKey, got %v", tt.name, err)
+		}
+	}
+
+	store.Delete(k.ID)
+	if _, err := v.Verify(ctx, plain); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expected deleted key to fail, got %v", err)
+	}
+
+	broken := &APIKeyVerifier{Store: failingAPIKeyStore{}}
+	if _, err := broken.Verify(ctx, plain); !errors.Is(err, ErrAPIKeyUnavailable) {
+		t.Fatalf("expected ErrAPIKeyUnavailable, got %v", err)
+	}
+	if _, err := (&APIKeyVerifier{}).Verify(ctx, plain); err == nil {
+		t.Fatalf("expected error without store")
+	}
+}
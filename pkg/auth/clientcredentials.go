@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/httpx"
+)
+
+// ClientCredentialsConfig configures a ClientCredentials token source.
+type ClientCredentialsConfig struct {
+	// TokenURL is the authorization server's token endpoint. Required.
+	TokenURL string
+
+	// ClientID and ClientSecret authenticate this service (client_secret_basic). Required.
+	ClientID     string
+	ClientSecret string
+
+	// Scopes and Audience are sent as the "scope" and "audience" parameters.
+	Scopes   []string
+	Audience []string
+
+	// RefreshBefore refreshes tokens this long before they expire. Defaults to 1m,
+	// capped at half the token lifetime.
+	RefreshBefore time.Duration
+
+	// HTTPClient calls the token endpoint. Defaults to httpx.NewClient with a 5s timeout.
+	// It must not itself use this token source.
+	HTTPClient *http.Client
+}
+
+// ClientCredentials is an OAuth 2.0 client-credentials token source (RFC 6749 section 4.4).
+// It implements httpx.TokenSource:
+//
+//	src, _ := auth.NewClientCredentials(auth.ClientCredentialsConfig{...})
+//	client := httpx.NewClient(httpx.ClientConfig{TokenSource: src, TokenHosts: []string{"orders.internal"}})
+//
+// Tokens are cached and refreshed ahead of expiry; concurrent refreshes share one request.
+// If a refresh fails while the cached token is still valid, the cached token is used.
+type ClientCredentials struct {
+	endpoint      tokenEndpoint
+	form          url.Values
+	refreshBefore time.Duration
+	now           func() time.Time
+
+	group singleflight.Group
+
+	mu        sync.Mutex
+	tok       *Token
+	refreshAt time.Time
+}
+
+var _ httpx.TokenSource = (*ClientCredentials)(nil)
+
+// NewClientCredentials validates cfg and returns a token source. No token is fetched yet.
+func NewClientCredentials(cfg ClientCredentialsConfig) (*ClientCredentials, error) {
+	if strings.TrimSpace(cfg.TokenURL) == "" {
+		return nil, errors.New("auth: client credentials require TokenURL")
+	}
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, errors.New("auth: client credentials require ClientID and ClientSecret")
+	}
+	if cfg.RefreshBefore <= 0 {
+		cfg.RefreshBefore = time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = httpx.NewClient(httpx.ClientConfig{Timeout: 5 * time.Second})
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	for _, a := range cfg.Audience {
+		form.Add("audience", a)
+	}
+
+	return &ClientCredentials{
+		endpoint: tokenEndpoint{
+			url:          cfg.TokenURL,
+			clientID:     cfg.ClientID,
+			clientSecret: cfg.ClientSecret,
+			client:       cfg.HTTPClient,
+			now:          time.Now,
+		},
+		form:          form,
+		refreshBefore: cfg.RefreshBefore,
+		now:           time.Now,
+	}, nil
+}
+
+// Token implements httpx.TokenSource.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	tok, refreshAt := c.tok, c.refreshAt
+	c.mu.Unlock()
+
+	now := c.now()
+	if tok != nil && (refreshAt.IsZero() || now.Before(refreshAt)) {
+		return tok.AccessToken, nil
+	}
+
+	// The shared fetch must not be cancelled by whichever caller happened to start it.
+	ch := c.group.DoChan("token", func() (any, error) {
+		return c.fetch(context.WithoutCancel(ctx))
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			// Keep using a token that is due for refresh but not yet expired.
+			if tok != nil && (tok.Expiry.IsZero() || now.Before(tok.Expiry)) {
+				return tok.AccessToken, nil
+			}
+			return "", res.Err
+		}
+		return res.Val.(*Token).AccessToken, nil
+	}
+}
+
+// Invalidate implements httpx.TokenSource. The next Token call fetches a new token.
+func (c *ClientCredentials) Invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tok != nil && c.tok.AccessToken == token {
+		c.tok = nil
+		c.refreshAt = time.Time{}
+	}
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (*Token, error) {
+	tok, err := c.endpoint.request(ctx, c.form)
+	if err != nil {
+		return nil, err
+	}
+
+	var refreshAt time.Time
+	if !tok.Expiry.IsZero() {
+		lifetime := tok.Expiry.Sub(c.now())
+		early := min(c.refreshBefore, lifetime/2)
+		refreshAt = tok.Expiry.Add(-early)
+	}
+
+	c.mu.Lock()
+	c.tok, c.refreshAt = tok, refreshAt
+	c.mu.Unlock()
+	return tok, nil
+}
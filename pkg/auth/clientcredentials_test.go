@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/httpx"
+)
+
+type tokenServer struct {
+	calls atomic.Int32
+	fail  atomic.Bool
+	delay time.Duration
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := s.calls.Add(1)
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+	if s.fail.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	id, secret, _ := r.BasicAuth()
+	_ = r.ParseForm()
+	if id != "svc" || secret != "pw" || r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "a b" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_request"}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"access_token":"t` + strconv.Itoa(int(n)) + `","token_type":"Bearer","expires_in":120}`))
+}
+
+func newTestClientCredentials(t *testing.T, url string) (*ClientCredentials, *time.Time) {
+	t.Helper()
+
+	src, err := NewClientCredentials(ClientCredentialsConfig{TokenURL: url, ClientID: "svc", ClientSecret: "pw", Scopes: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("NewClientCredentials: %v", err)
+	}
+	now := time.Now()
+	clock := func() time.Time { return now }
+	src.now, src.endpoint.now = clock, clock
+	return src, &now
+}
+
+func TestClientCredentials_CacheAndRefresh(t *testing.T) {
+	t.Parallel()
+
+	ts := &tokenServer{}
+	srv := httptest.NewServer(ts)
+	defer srv.Close()
+
+	src, now := newTestClientCredentials(t, srv.URL)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if tok, err := src.Token(ctx); err != nil || tok != "t1" {
+			t.Fatalf("tok=%q err=%v", tok, err)
+		}
+	}
+	if got := ts.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 fetch, got %d", got)
+	}
+
+	// refreshed one minute before the 120s expiry
+	*now = now.Add(59 * time.Second)
+	if tok, _ := src.Token(ctx); tok != "t1" {
+		t.Fatalf("expected cached token, got %q", tok)
+	}
+	*now = now.Add(time.Second)
+	if tok, _ := src.Token(ctx); tok != "t2" {
+		t.Fatalf("expected refreshed token, got %q", tok)
+	}
+
+	// refresh failure keeps serving a still-valid token, but not an expired one
+	ts.fail.Store(true)
+	*now = now.Add(90 * time.Second)
+	if tok, err := src.Token(ctx); err != nil || tok != "t2" {
+		t.Fatalf("expected stale-but-valid token, tok=%q err=%v", tok, err)
+	}
+	*now = now.Add(time.Minute)
+	if _, err := src.Token(ctx); !errors.Is(err, ErrTokenEndpoint) {
+		t.Fatalf("expected ErrTokenEndpoint, got %v", err)
+	}
+
+	ts.fail.Store(false)
+	tok, _ := src.Token(ctx)
+	src.Invalidate("other")
+	if again, _ := src.Token(ctx); again != tok {
+		t.Fatalf("invalidating another token must keep the cache")
+	}
+	src.Invalidate(tok)
+	if again, _ := src.Token(ctx); again == tok {
+		t.Fatalf("expected new token after Invalidate")
+	}
+}
+
+func TestClientCredentials_Singleflight(t *testing.T) {
+	t.Parallel()
+
+	ts := &tokenServer{delay: 50 * time.Millisecond}
+	srv := httptest.NewServer(ts)
+	defer srv.Close()
+
+	src, _ := newTestClientCredentials(t, srv.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tok, err := src.Token(context.Background()); err != nil || tok != "t1" {
+				t.Errorf("tok=%q err=%v", tok, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := ts.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 shared fetch, got %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src.Invalidate("t1")
+	if _, err := src.Token(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClientCredentials_WithHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	ts := &tokenServer{}
+	idp := httptest.NewServer(ts)
+	defer idp.Close()
+
+	// the API rejects the first token, as if it had been revoked
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer api.Close()
+
+	src, err := NewClientCredentials(ClientCredentialsConfig{TokenURL: idp.URL, ClientID: "svc", ClientSecret: "pw", Scopes: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("NewClientCredentials: %v", err)
+	}
+	client := httpx.NewClient(httpx.ClientConfig{TokenSource: src, TokenHosts: []string{strings.TrimPrefix(api.URL, "http://")}})
+
+	resp, err := client.Get(api.URL)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || ts.calls.Load() != 2 {
+		t.Fatalf("status=%d fetches=%d", resp.StatusCode, ts.calls.Load())
+	}
+}
+
+func TestNewClientCredentials_Validation(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []ClientCredentialsConfig{
+		{},
+		{TokenURL: "http://idp"},
+		{TokenURL: "http://idp", ClientID: "svc"},
+	} {
+		if _, err := NewClientCredentials(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,638 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxConditionLen   = 2048
+	maxConditionDepth = 32
+)
+
+// Condition is a compiled attribute-based policy expression.
+//
+// The language is deliberately small and side-effect free:
+//
+//	resource.owner_id == subject.id && request.method in ["GET", "PATCH"]
+//	request.hour >= 9 && request.hour < 17 && request.weekday <= 5
+//	cidr(request.ip, "10.0.0.0/8") || "orders:admin" in subject.scopes
+//
+// Operators: || && ! == != < <= > >= in, parentheses and list literals.
+// "in" tests list membership; its right operand must be a list literal or a list
+// variable (subject.scopes, actor.chain, resource.<attr>). A resource attribute that is
+// not a list makes it false; there is no substring matching.
+// Literals: strings ("..." or '...'), numbers, true, false, null.
+//
+// Variables:
+//   - action, resource: PolicyRequest.Action and PolicyRequest.Resource
+//   - subject.id, subject.scopes, tenant.id
+//   - actor.id (current actor, "" if not delegated), actor.chain (all actors, current first)
+//   - resource.<attr>: PolicyRequest.ResourceAttributes (nested maps via dots)
+//   - request.ip, request.method, request.path
+//   - request.time (unix seconds), request.hour (0-23), request.weekday (1=Mon..7=Sun)
+//
+// Functions: cidr(ip, "prefix") reports whether ip is within the literal CIDR prefix.
+//
+// Type mismatches never fail evaluation: they make the comparison false.
+type Condition struct {
+	src  string
+	root condNode
+}
+
+// CompileCondition parses and validates src. Unknown variables, functions and
+// malformed CIDR literals are rejected here, not at evaluation time.
+func CompileCondition(src string) (*Condition, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errors.New("auth: empty condition")
+	}
+	if len(src) > maxConditionLen {
+		return nil, fmt.Errorf("auth: condition exceeds %d characters", maxConditionLen)
+	}
+
+	toks, err := lexCondition(src)
+	if err != nil {
+		return nil, fmt.Errorf("auth: condition %q: %w", src, err)
+	}
+	p := &condParser{toks: toks}
+	root, err := p.parseOr(0)
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth: condition %q: %w", src, err)
+	}
+	return &Condition{src: src, root: root}, nil
+}
+
+// String returns the source expression.
+func (c *Condition) String() string { return c.src }
+
+// Eval evaluates the condition against req. Non-boolean results count as false.
+func (c *Condition) Eval(req PolicyRequest) bool {
+	if c == nil || c.root == nil {
+		return false
+	}
+	b, ok := c.root.eval(&req).(bool)
+	return ok && b
+}
+
+// ---- lexer ----
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type condToken struct {
+	kind tokKind
+	text string
+}
+
+func lexCondition(src string) ([]condToken, error) {
+	var toks []condToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			toks = append(toks, condToken{tokString, sb.String()})
+			i = j + 1
+
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, condToken{tokNumber, src[i:j]})
+			i = j
+
+		case isIdentByte(c) && !(c >= '0' && c <= '9'):
+			j := i
+			for j < len(src) && (isIdentByte(src[j]) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, condToken{tokIdent, src[i:j]})
+			i = j
+
+		default:
+			op := ""
+			for _, cand := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, condToken{tokOp, op})
+			i += len(op)
+		}
+	}
+	return append(toks, condToken{kind: tokEOF}), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// ---- parser ----
+
+type condParser struct {
+	toks []condToken
+	pos  int
+}
+
+func (p *condParser) peek() condToken { return p.toks[p.pos] }
+
+func (p *condParser) next() condToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *condParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *condParser) expect(op string) error {
+	if !p.accept(op) {
+		return fmt.Errorf("expected %q, got %q", op, p.peek().text)
+	}
+	return nil
+}
+
+func (p *condParser) parseOr(depth int) (condNode, error) {
+	if depth > maxConditionDepth {
+		return nil, errors.New("expression nested too deeply")
+	}
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd(depth int) (condNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseUnary(depth int) (condNode, error) {
+	if p.accept("!") {
+		if depth > maxConditionDepth {
+			return nil, errors.New("expression nested too deeply")
+		}
+		n, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parseCompare(depth)
+}
+
+func (p *condParser) parseCompare(depth int) (condNode, error) {
+	left, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		right, err := p.parsePrimary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return cmpNode{op: t.text, left: left, right: right}, nil
+	case t.kind == tokIdent && t.text == "in":
+		p.next()
+		right, err := p.parsePrimary(depth)
+		if err != nil {
+			return nil, err
+		}
+		if !listOperand(right) {
+			return nil, errors.New(`"in" requires a list literal or list variable on the right`)
+		}
+		return inNode{left, right}, nil
+	}
+	return left, nil
+}
+
+// listOperand reports whether n may evaluate to a list.
+func listOperand(n condNode) bool {
+	switch n := n.(type) {
+	case listNode:
+		return true
+	case varNode:
+		return n.list
+	}
+	return false
+}
+
+func (p *condParser) parsePrimary(depth int) (condNode, error) {
+	if depth > maxConditionDepth {
+		return nil, errors.New("expression nested too deeply")
+	}
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return litNode{t.text}, nil
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return litNode{f}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return litNode{true}, nil
+		case "false":
+			return litNode{false}, nil
+		case "null":
+			return litNode{nil}, nil
+		case "in":
+			return nil, errors.New("unexpected \"in\"")
+		}
+		if p.accept("(") {
+			return p.parseCall(t.text, depth)
+		}
+		return newVarNode(t.text)
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			var items []condNode
+			for !p.accept("]") {
+				if len(items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				n, err := p.parsePrimary(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, n)
+			}
+			return listNode(items), nil
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func (p *condParser) parseCall(name string, depth int) (condNode, error) {
+	var args []condNode
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, n)
+	}
+
+	switch name {
+	case "cidr":
+		if len(args) != 2 {
+			return nil, errors.New("cidr() takes 2 arguments")
+		}
+		lit, ok := args[1].(litNode)
+		s, isStr := lit.v.(string)
+		if !ok || !isStr {
+			return nil, errors.New("cidr() requires a string literal prefix")
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("cidr(): %w", err)
+		}
+		return cidrNode{ip: args[0], prefix: prefix.Masked()}, nil
+	default:
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+}
+
+// ---- AST ----
+
+type condNode interface {
+	eval(req *PolicyRequest) any
+}
+
+type litNode struct{ v any }
+
+func (n litNode) eval(*PolicyRequest) any { return n.v }
+
+type listNode []condNode
+
+func (n listNode) eval(req *PolicyRequest) any {
+	out := make([]any, len(n))
+	for i, item := range n {
+		out[i] = item.eval(req)
+	}
+	return out
+}
+
+type orNode struct{ left, right condNode }
+
+func (n orNode) eval(req *PolicyRequest) any {
+	return truthy(n.left.eval(req)) || truthy(n.right.eval(req))
+}
+
+type andNode struct{ left, right condNode }
+
+func (n andNode) eval(req *PolicyRequest) any {
+	return truthy(n.left.eval(req)) && truthy(n.right.eval(req))
+}
+
+type notNode struct{ n condNode }
+
+func (n notNode) eval(req *PolicyRequest) any { return !truthy(n.n.eval(req)) }
+
+type cmpNode struct {
+	op          string
+	left, right condNode
+}
+
+func (n cmpNode) eval(req *PolicyRequest) any {
+	l, r := normalize(n.left.eval(req)), normalize(n.right.eval(req))
+	switch n.op {
+	case "==":
+		return valuesEqual(l, r)
+	case "!=":
+		return !valuesEqual(l, r)
+	}
+
+	var c int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return false
+		}
+		c = compareOrdered(lv, rv)
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(lv, rv)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+type inNode struct{ item, list condNode }
+
+func (n inNode) eval(req *PolicyRequest) any {
+	item := normalize(n.item.eval(req))
+	switch list := normalize(n.list.eval(req)).(type) {
+	case []any:
+		for _, v := range list {
+			if valuesEqual(item, normalize(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type cidrNode struct {
+	ip     condNode
+	prefix netip.Prefix
+}
+
+func (n cidrNode) eval(req *PolicyRequest) any {
+	s, ok := n.ip.eval(req).(string)
+	if !ok {
+		return false
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return false
+	}
+	return n.prefix.Contains(addr.Unmap())
+}
+
+type varNode struct {
+	get  func(req *PolicyRequest) any
+	list bool // the value may be a list
+}
+
+func (n varNode) eval(req *PolicyRequest) any { return n.get(req) }
+
+func newVarNode(name string) (condNode, error) {
+	requestTime := func(req *PolicyRequest) time.Time {
+		if req.Request.Time.IsZero() {
+			return time.Now()
+		}
+		return req.Request.Time
+	}
+
+	switch name {
+	case "action":
+		return varNode{get: func(r *PolicyRequest) any { return r.Action }}, nil
+	case "resource":
+		return varNode{get: func(r *PolicyRequest) any { return r.Resource }}, nil
+	case "subject.id":
+		return varNode{get: func(r *PolicyRequest) any { return r.SubjectID }}, nil
+	case "subject.scopes":
+		return varNode{get: func(r *PolicyRequest) any { return r.Scopes }, list: true}, nil
+	case "tenant.id":
+		return varNode{get: func(r *PolicyRequest) any { return r.TenantID }}, nil
+	case "actor.id":
+		return varNode{get: func(r *PolicyRequest) any {
+			if len(r.Actors) == 0 {
+				return ""
+			}
+			return r.Actors[0]
+		}}, nil
+	case "actor.chain":
+		return varNode{get: func(r *PolicyRequest) any { return r.Actors }, list: true}, nil
+	case "request.ip":
+		return varNode{get: func(r *PolicyRequest) any { return r.Request.IP }}, nil
+	case "request.method":
+		return varNode{get: func(r *PolicyRequest) any { return r.Request.Method }}, nil
+	case "request.path":
+		return varNode{get: func(r *PolicyRequest) any { return r.Request.Path }}, nil
+	case "request.time":
+		return varNode{get: func(r *PolicyRequest) any { return float64(requestTime(r).Unix()) }}, nil
+	case "request.hour":
+		return varNode{get: func(r *PolicyRequest) any { return float64(requestTime(r).Hour()) }}, nil
+	case "request.weekday":
+		return varNode{get: func(r *PolicyRequest) any {
+			wd := requestTime(r).Weekday()
+			if wd == time.Sunday {
+				return float64(7)
+			}
+			return float64(wd)
+		}}, nil
+	}
+
+	if attr, ok := strings.CutPrefix(name, "resource."); ok && attr != "" {
+		path := strings.Split(attr, ".")
+		for _, seg := range path {
+			if seg == "" {
+				return nil, fmt.Errorf("invalid variable %q", name)
+			}
+		}
+		return varNode{get: func(r *PolicyRequest) any { return lookupAttr(r.ResourceAttributes, path) }, list: true}, nil
+	}
+	return nil, fmt.Errorf("unknown variable %q", name)
+}
+
+func lookupAttr(attrs map[string]any, path []string) any {
+	var cur any = attrs
+	for _, seg := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[seg]
+	}
+	return cur
+}
+
+func truthy(v any) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// normalize maps attribute values onto the expression types: string, float64, bool, nil, []any.
+func normalize(v any) any {
+	switch x := v.(type) {
+	case nil, string, float64, bool, []any:
+		return x
+	case []string:
+		out := make([]any, len(x))
+		for i := range x {
+			out[i] = x[i]
+		}
+		return out
+	case fmt.Stringer:
+		return x.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = rv.Index(i).Interface()
+		}
+		return out
+	}
+	return v
+}
+
+func valuesEqual(a, b any) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCondition_Eval(t *testing.T) {
+	t.Parallel()
+
+	// Wednesday 10:30 UTC
+	at := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	req := PolicyRequest{
+		SubjectID: "u1",
+		TenantID:  "t1",
+		Scopes:    []string{"orders:read", "orders:admin"},
+		Action:    "orders.update",
+		Resource:  "tenant:t1:orders:42",
+		ResourceAttributes: map[string]any{
+			"owner_id": "u1",
+			"amount":   250,
+			"tags":     []string{"vip"},
+			"shipping": map[string]any{"country": "ID"},
+			"locked":   false,
+		},
+		Request: RequestAttributes{IP: "10.1.2.3", Method: "PATCH", Path: "/orders/42", Time: at},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`resource.owner_id == subject.id`, true},
+		{`resource.owner_id != subject.id`, false},
+		{`request.hour >= 9 && request.hour < 17 && request.weekday <= 5`, true},
+		{`request.weekday == 3`, true},
+		{`request.method in ["GET", "PATCH"]`, true},
+		{`"orders:admin" in subject.scopes`, true},
+		{`"vip" in resource.tags`, true},
+		{`resource.amount > 100 && resource.amount <= 250`, true},
+		{`resource.amount < -1`, false},
+		{`resource.shipping.country == 'ID'`, true},
+		{`resource.missing == null`, true},
+		{`!resource.locked`, true},
+		{`cidr(request.ip, "10.0.0.0/8")`, true},
+		{`cidr(request.ip, "192.168.0.0/16")`, false},
+		{`tenant.id == "t1" && (action == "orders.read" || action == "orders.update")`, true},
+		{`resource == "tenant:t1:orders:42"`, true},
+		{`"vip" in resource.owner_id`, false},
+		{`request.path == "/orders/42" && request.time > 0`, true},
+		{`resource.owner_id > 1`, false},
+		{`resource.amount`, false},
+		{`true`, true},
+	}
+	for _, tt := range tests {
+		c, err := CompileCondition(tt.expr)
+		if err != nil {
+			t.Fatalf("compile %q: %v", tt.expr, err)
+		}
+		if got := c.Eval(req); got != tt.want {
+			t.Fatalf("%q: got=%v want=%v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileCondition_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		``,
+		`subject.name == "x"`,
+		`resource. == 1`,
+		`unknown == 1`,
+		`a == `,
+		`(subject.id == "u1"`,
+		`subject.id == "u1")`,
+		`"unterminated`,
+		`subject.id = "u1"`,
+		`exec("rm")`,
+		`cidr(request.ip, "not-a-cidr")`,
+		`cidr(request.ip, subject.id)`,
+		`cidr(request.ip)`,
+		`[1, 2`,
+		`in`,
+		`"t1:orders" in resource`,
+		`"u" in subject.id`,
+		`"a" in "abc"`,
+		`1.2.3 == 1`,
+		strings.Repeat("(", 100) + "true" + strings.Repeat(")", 100),
+		strings.Repeat("x", maxConditionLen+1),
+	}
+	for _, src := range tests {
+		if _, err := CompileCondition(src); err == nil {
+			t.Fatalf("expected compile error for %q", src)
+		}
+	}
+}
+
+func TestRBAC_Conditions(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseRBACPolicy([]byte(`
+timezone: Asia/Jakarta
+roles:
+  customer:
+    allow:
+      - action: orders.update
+        when: resource.owner_id == subject.id
+      - action: orders.export
+        when: request.hour >= 9 && request.hour < 17
+    deny:
+      - action: orders.update
+        when: resource.status == "shipped"
+bindings:
+  - subject: u1
+    roles: [customer]
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rbac, err := NewRBAC(p)
+	if err != nil {
+		t.Fatalf("NewRBAC: %v", err)
+	}
+
+	check := func(req PolicyRequest) bool {
+		dec, err := rbac.Check(t.Context(), req)
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		return dec.IsAllow()
+	}
+
+	own := PolicyRequest{SubjectID: "u1", Action: "orders.update", ResourceAttributes: map[string]any{"owner_id": "u1"}}
+	if !check(own) {
+		t.Fatalf("owner should be allowed")
+	}
+	other := PolicyRequest{SubjectID: "u1", Action: "orders.update", ResourceAttributes: map[string]any{"owner_id": "u2"}}
+	if check(other) {
+		t.Fatalf("non-owner should be denied")
+	}
+	shipped := PolicyRequest{SubjectID: "u1", Action: "orders.update", ResourceAttributes: map[string]any{"owner_id": "u1", "status": "shipped"}}
+	if check(shipped) {
+		t.Fatalf("conditional deny should override")
+	}
+
+	// 03:00 UTC is 10:00 in Jakarta (UTC+7)
+	export := PolicyRequest{SubjectID: "u1", Action: "orders.export", Request: RequestAttributes{Time: time.Date(2024, 5, 15, 3, 0, 0, 0, time.UTC)}}
+	if !check(export) {
+		t.Fatalf("export within business hours should be allowed")
+	}
+	export.Request.Time = time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	if check(export) {
+		t.Fatalf("export outside business hours should be denied")
+	}
+
+	bad := []string{
+		`roles: {r: {allow: [{action: a, when: "subject.nme == 1"}]}}`,
+		`timezone: Nowhere/City`,
+	}
+	for _, doc := range bad {
+		p, err := ParseRBACPolicy([]byte(doc))
+		if err == nil {
+			_, err = NewRBAC(p)
+		}
+		if err == nil {
+			t.Fatalf("expected error for %q", doc)
+		}
+	}
+}
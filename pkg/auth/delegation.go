@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxActorChain bounds delegation depth (service -> service -> ...).
+const maxActorChain = 8
+
+// ErrTokenActorChain indicates an "act" chain nested deeper than 8 actors. Such tokens
+// are rejected rather than truncated, so no actor is silently dropped from logs and
+// policy checks. It wraps ErrInvalidToken.
+var ErrTokenActorChain = fmt.Errorf("%w: actor chain too long", ErrInvalidToken)
+
+// Actor is the RFC 8693 "act" claim. A nested Act records the previous actor.
+type Actor struct {
+	Subject string `json:"sub"`
+	Issuer  string `json:"iss,omitempty"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// ActorChain returns the subjects acting on behalf of c.Subject, current actor first.
+// It is nil for tokens that are not delegated. Verified claims never hold more than
+// maxActorChain actors (see ErrTokenActorChain).
+func (c *Claims) ActorChain() []string {
+	var chain []string
+	for a := c.Act; a != nil && len(chain) < maxActorChain; a = a.Act {
+		chain = append(chain, a.Subject)
+	}
+	return chain
+}
+
+// checkActorChain rejects chains longer than maxActorChain.
+func (c *Claims) checkActorChain() error {
+	depth := 0
+	for a := c.Act; a != nil; a = a.Act {
+		if depth++; depth > maxActorChain {
+			return ErrTokenActorChain
+		}
+	}
+	return nil
+}
+
+// Delegate returns claims for a token that lets actor act on behalf of c.Subject, as
+// issued by a token exchange. The current chain is nested under actor. Scopes are
+// downscoped: every requested scope must be granted by c (nil keeps c.Scopes).
+// Registered claims other than sub are left for the Issuer to fill.
+func (c *Claims) Delegate(actor Actor, scopes []string) (Claims, error) {
+	if actor.Subject == "" {
+		return Claims{}, errors.New("auth: delegation requires actor subject")
+	}
+	if len(c.ActorChain()) >= maxActorChain {
+		return Claims{}, fmt.Errorf("auth: delegation chain exceeds %d actors", maxActorChain)
+	}
+
+	if scopes == nil {
+		scopes = c.Scopes
+	}
+	for _, s := range scopes {
+		if !HasAll(c.Scopes, Scope(s)) {
+			return Claims{}, fmt.Errorf("auth: delegation cannot grant scope %q", s)
+		}
+	}
+
+	actor.Act = c.Act
+	return Claims{
+		TenantID:         c.TenantID,
+		Scopes:           append([]string(nil), scopes...),
+		Act:              &actor,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: c.Subject},
+	}, nil
+}
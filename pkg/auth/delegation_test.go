@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestClaims_Delegate(t *testing.T) {
+	t.Parallel()
+
+	user := &Claims{
+		TenantID:         "t1",
+		Scopes:           []string{"orders:*", "payments:read"},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", ID: "j1", Issuer: "id"},
+	}
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{"keep scopes", nil, []string{"orders:*", "payments:read"}, false},
+		{"downscope", []string{"orders:read"}, []string{"orders:read"}, false},
+		{"no scopes", []string{}, []string{}, false},
+		{"escalation", []string{"payments:write"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := user.Delegate(Actor{Subject: "svc-orders"}, tt.scopes)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", tt.name, err)
+		}
+		if got.Subject != "u1" || got.TenantID != "t1" || got.ID != "" || got.Issuer != "" {
+			t.Fatalf("%s: unexpected claims %+v", tt.name, got)
+		}
+		if !reflect.DeepEqual(got.Scopes, tt.want) && !(len(got.Scopes) == 0 && len(tt.want) == 0) {
+			t.Fatalf("%s: scopes=%v want %v", tt.name, got.Scopes, tt.want)
+		}
+	}
+
+	if _, err := user.Delegate(Actor{}, nil); err == nil {
+		t.Fatalf("expected error without actor subject")
+	}
+
+	// chains nest, current actor first
+	first, _ := user.Delegate(Actor{Subject: "svc-orders"}, nil)
+	second, err := first.Delegate(Actor{Subject: "svc-payments"}, []string{"payments:read"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := second.ActorChain(); !reflect.DeepEqual(got, []string{"svc-payments", "svc-orders"}) {
+		t.Fatalf("chain=%v", got)
+	}
+	if user.ActorChain() != nil {
+		t.Fatalf("direct token should have no chain")
+	}
+
+	deep := *user
+	for i := 0; i < maxActorChain; i++ {
+		deep, err = deep.Delegate(Actor{Subject: "svc"}, nil)
+		if err != nil {
+			t.Fatalf("depth %d: %v", i, err)
+		}
+	}
+	if _, err := deep.Delegate(Actor{Subject: "svc"}, nil); err == nil {
+		t.Fatalf("expected chain limit error")
+	}
+}
+
+func TestVerifier_RejectsLongActorChain(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	v := Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+	sign := func(depth int) string {
+		claims := Claims{TenantID: "t1", RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}}
+		for i := 0; i < depth; i++ {
+			claims.Act = &Actor{Subject: "svc", Act: claims.Act}
+		}
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	got, err := v.VerifyContext(context.Background(), sign(maxActorChain))
+	if err != nil || len(got.ActorChain()) != maxActorChain {
+		t.Fatalf("expected chain of %d accepted, got %v", maxActorChain, err)
+	}
+	_, err = v.VerifyContext(context.Background(), sign(maxActorChain+1))
+	if !errors.Is(err, ErrTokenActorChain) || !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrTokenActorChain, got %v", err)
+	}
+	if got := VerifyErrorReason(err); got != "actor_chain_too_long" {
+		t.Fatalf("reason=%q", got)
+	}
+}
+
+func TestDelegatedToken_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	iss, err := NewIssuer(IssuerConfig{Issuer: "id", Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodHS256, Key: secret}}})
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	user := &Claims{TenantID: "t1", Scopes: []string{"orders:read"}, RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}}
+	delegated, _ := user.Delegate(Actor{Subject: "svc-orders", Issuer: "id"}, nil)
+
+	tok, err := iss.Issue(delegated)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	got, err := (Verifier{KeyFunc: iss.KeyFunc}).VerifyContext(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if got.Subject != "u1" || got.Act == nil || got.Act.Subject != "svc-orders" || got.Act.Issuer != "id" {
+		t.Fatalf("unexpected claims: %+v act=%+v", got, got.Act)
+	}
+}
+
+func TestCondition_Actors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src    string
+		actors []string
+		want   bool
+	}{
+		{`actor.id == ""`, nil, true},
+		{`actor.id == "svc-orders"`, []string{"svc-orders"}, true},
+		{`"svc-orders" in actor.chain`, []string{"svc-payments", "svc-orders"}, true},
+		{`!("svc-batch" in actor.chain)`, []string{"svc-orders"}, true},
+	}
+	for _, tt := range tests {
+		c, err := CompileCondition(tt.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		if got := c.Eval(PolicyRequest{Actors: tt.actors}); got != tt.want {
+			t.Fatalf("%s: got %v want %v", tt.src, got, tt.want)
+		}
+	}
+}
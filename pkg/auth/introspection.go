@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/httpx"
+)
+
+var (
+	// ErrTokenInactive indicates the introspection endpoint reported the token as inactive
+	// (unknown, expired or revoked). It wraps ErrInvalidToken.
+	ErrTokenInactive = fmt.Errorf("%w: inactive", ErrInvalidToken)
+
+	// ErrIntrospectionUnavailable indicates the introspection endpoint could not be consulted.
+	// Verification fails closed.
+	ErrIntrospectionUnavailable = errors.New("auth: introspection unavailable")
+)
+
+// IntrospectionConfig configures an Introspector.
+type IntrospectionConfig struct {
+	// URL is the RFC 7662 introspection endpoint. Required.
+	URL string
+
+	// ClientID and ClientSecret authenticate this service (client_secret_basic).
+	ClientID     string
+	ClientSecret string
+
+	// HTTPClient defaults to httpx.NewClient with a 5s timeout.
+	HTTPClient *http.Client
+
+	// Optional checks of the introspection response.
+	Issuer   string
+	Audience string
+
+	// Claims maps tenant and scopes from response fields. Scopes defaults to the
+	// space-separated RFC 7662 "scope" field; tenant defaults to "tenant_id".
+	// "memberships" are only kept with Claims.TrustMemberships.
+	Claims ClaimMapping
+
+	// MaxCacheTTL bounds how long an active result is cached; results are never cached
+	// beyond the token's exp. Defaults to 5m; negative disables caching.
+	// Inactive results are never cached.
+	MaxCacheTTL time.Duration
+
+	// MaxEntries bounds the cache. Defaults to 10000.
+	MaxEntries int
+}
+
+// Introspector verifies opaque access tokens by asking the issuer (RFC 7662).
+// It implements TokenVerifier, so it plugs into middleware.Auth like a JWT verifier.
+type Introspector struct {
+	endpoint tokenEndpoint
+	cfg      IntrospectionConfig
+	now      func() time.Time
+	cache    *lru[*Claims]
+}
+
+// NewIntrospector validates cfg and returns an introspector.
+func NewIntrospector(cfg IntrospectionConfig) (*Introspector, error) {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, errors.New("auth: introspection requires URL")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = httpx.NewClient(httpx.ClientConfig{Timeout: 5 * time.Second})
+	}
+	if cfg.Claims.Scopes == "" {
+		cfg.Claims.Scopes = "scope"
+	}
+	if cfg.MaxCacheTTL == 0 {
+		cfg.MaxCacheTTL = 5 * time.Minute
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	return &Introspector{
+		endpoint: tokenEndpoint{
+			url:          cfg.URL,
+			clientID:     cfg.ClientID,
+			clientSecret: cfg.ClientSecret,
+			client:       cfg.HTTPClient,
+			now:          time.Now,
+		},
+		cfg:   cfg,
+		now:   time.Now,
+		cache: newLRU[*Claims](cfg.MaxEntries),
+	}, nil
+}
+
+// VerifyContext implements TokenVerifier.
+func (i *Introspector) VerifyContext(ctx context.Context, token string) (*Claims, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	// Raw tokens are never kept in memory as cache keys.
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	now := i.now()
+	if c, exp, ok := i.cache.get(key); ok {
+		if now.Before(exp) {
+			return cloneClaims(c), nil
+		}
+		i.cache.remove(key)
+	}
+
+	claims, err := i.introspect(ctx, token, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if i.cfg.MaxCacheTTL > 0 {
+		exp := now.Add(i.cfg.MaxCacheTTL)
+		if claims.ExpiresAt != nil && claims.ExpiresAt.Before(exp) {
+			exp = claims.ExpiresAt.Time
+		}
+		i.cache.set(key, cloneClaims(claims), exp)
+	}
+	return claims, nil
+}
+
+// Invalidate drops all cached results, e.g. after a logout-everywhere.
+func (i *Introspector) Invalidate() {
+	i.cache.clear()
+}
+
+func (i *Introspector) introspect(ctx context.Context, token string, now time.Time) (*Claims, error) {
+	body, err := i.endpoint.post(ctx, url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionUnavailable, err)
+	}
+
+	var resp struct {
+		Active bool `json:"active"`
+		Claims
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: decode response: %v", ErrIntrospectionUnavailable, err)
+	}
+	if !resp.Active {
+		return nil, ErrTokenInactive
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("%w: decode response: %v", ErrIntrospectionUnavailable, err)
+	}
+	claims := resp.Claims
+	i.cfg.Claims.apply(&claims, raw)
+
+	switch {
+	case claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Time):
+		return nil, ErrTokenExpired
+	case claims.NotBefore != nil && now.Before(claims.NotBefore.Time):
+		return nil, ErrTokenNotYetValid
+	case i.cfg.Issuer != "" && claims.Issuer != i.cfg.Issuer:
+		return nil, ErrTokenIssuer
+	case i.cfg.Audience != "" && !slices.Contains(claims.Audience, i.cfg.Audience):
+		return nil, ErrTokenAudience
+	case strings.TrimSpace(claims.Subject) == "":
+		return nil, ErrMissingSubject
+	case !claims.hasTenant():
+		return nil, ErrMissingTenantID
+	}
+	if err := claims.checkActorChain(); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func cloneClaims(c *Claims) *Claims {
+	cp := *c
+	cp.Scopes = slices.Clone(c.Scopes)
+	cp.Audience = slices.Clone(c.Audience)
+	cp.AMR = slices.Clone(c.AMR)
+	cp.Memberships = slices.Clone(c.Memberships)
+	for i := range cp.Memberships {
+		cp.Memberships[i].Roles = slices.Clone(cp.Memberships[i].Roles)
+		cp.Memberships[i].Scopes = slices.Clone(cp.Memberships[i].Scopes)
+	}
+	return &cp
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospector(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "api" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if r.PostForm.Get("token_type_hint") != "access_token" {
+			t.Errorf("unexpected form: %v", r.PostForm)
+		}
+		exp := now.Add(time.Hour).Unix()
+		var body string
+		switch r.PostForm.Get("token") {
+		case "good":
+			body = fmt.Sprintf(`{"active":true,"sub":"u1","org":{"id":"t1"},"scope":"a b","aud":"api","exp":%d}`, exp)
+		case "short":
+			body = fmt.Sprintf(`{"active":true,"sub":"u1","org":{"id":"t1"},"aud":["api"],"exp":%d}`, now.Add(30*time.Second).Unix())
+		case "expired":
+			body = fmt.Sprintf(`{"active":true,"sub":"u1","org":{"id":"t1"},"aud":"api","exp":%d}`, now.Add(-time.Second).Unix())
+		case "future":
+			body = fmt.Sprintf(`{"active":true,"sub":"u1","org":{"id":"t1"},"aud":"api","nbf":%d}`, now.Add(time.Minute).Unix())
+		case "other-aud":
+			body = `{"active":true,"sub":"u1","org":{"id":"t1"},"aud":"billing"}`
+		case "no-sub":
+			body = `{"active":true,"org":{"id":"t1"},"aud":"api"}`
+		case "no-tenant":
+			body = `{"active":true,"sub":"u1","aud":"api"}`
+		case "deep-act":
+			body = `{"active":true,"sub":"u1","org":{"id":"t1"},"aud":"api","act":` +
+				strings.Repeat(`{"sub":"svc","act":`, maxActorChain) + `{"sub":"svc"}` + strings.Repeat("}", maxActorChain) + `}`
+		case "broken":
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case "garbage":
+			body = `{`
+		default:
+			body = `{"active":false}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	in, err := NewIntrospector(IntrospectionConfig{
+		URL:          srv.URL,
+		ClientID:     "api",
+		ClientSecret: "s3cret",
+		Audience:     "api",
+		Claims:       ClaimMapping{TenantID: "org.id"},
+	})
+	if err != nil {
+		t.Fatalf("NewIntrospector: %v", err)
+	}
+	in.now = func() time.Time { return now }
+
+	tests := []struct {
+		token string
+		want  error
+	}{
+		{"good", nil},
+		{"unknown", ErrTokenInactive},
+		{"expired", ErrTokenExpired},
+		{"future", ErrTokenNotYetValid},
+		{"other-aud", ErrTokenAudience},
+		{"no-sub", ErrMissingSubject},
+		{"no-tenant", ErrMissingTenantID},
+		{"deep-act", ErrTokenActorChain},
+		{"broken", ErrIntrospectionUnavailable},
+		{"garbage", ErrIntrospectionUnavailable},
+		{" ", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			c, err := in.VerifyContext(context.Background(), tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if tt.want != nil {
+				return
+			}
+			if c.Subject != "u1" || c.TenantID != "t1" || !HasAll(c.Scopes, "a", "b") {
+				t.Fatalf("unexpected claims: %+v", c)
+			}
+		})
+	}
+
+	if !errors.Is(ErrTokenInactive, ErrInvalidToken) || VerifyErrorReason(ErrTokenInactive) != "inactive" {
+		t.Fatalf("ErrTokenInactive must be an invalid token")
+	}
+	if VerifyErrorReason(fmt.Errorf("%w: x", ErrIntrospectionUnavailable)) != "introspection_unavailable" {
+		t.Fatalf("unexpected reason for ErrIntrospectionUnavailable")
+	}
+}
+
+func TestIntrospector_Cache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+	var calls atomic.Int32
+	var active atomic.Bool
+	active.Store(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !active.Load() {
+			_, _ = w.Write([]byte(`{"active":false}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"active":true,"sub":"u1","tenant_id":"t1","scope":"a","exp":%d}`, now.Add(2*time.Minute).Unix())
+	}))
+	defer srv.Close()
+
+	in, err := NewIntrospector(IntrospectionConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewIntrospector: %v", err)
+	}
+	clock := now
+	in.now = func() time.Time { return clock }
+
+	c, err := in.VerifyContext(context.Background(), "tok")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	c.Scopes[0] = "mutated"
+
+	active.Store(false)
+	c, err = in.VerifyContext(context.Background(), "tok")
+	if err != nil || calls.Load() != 1 {
+		t.Fatalf("expected cached result, calls=%d err=%v", calls.Load(), err)
+	}
+	if c.Scopes[0] != "a" {
+		t.Fatalf("cached claims were mutated: %v", c.Scopes)
+	}
+
+	// Cached until exp (2m), even though MaxCacheTTL is 5m.
+	clock = now.Add(2 * time.Minute)
+	if _, err := in.VerifyContext(context.Background(), "tok"); !errors.Is(err, ErrTokenInactive) || calls.Load() != 2 {
+		t.Fatalf("expected refetch after exp, calls=%d err=%v", calls.Load(), err)
+	}
+
+	// Inactive results are not cached.
+	active.Store(true)
+	if _, err := in.VerifyContext(context.Background(), "tok"); err == nil || calls.Load() != 3 {
+		t.Fatalf("expected refetch, calls=%d err=%v", calls.Load(), err)
+	}
+
+	clock = now
+	if _, err := in.VerifyContext(context.Background(), "tok"); err != nil || calls.Load() != 4 {
+		t.Fatalf("expected refetch, calls=%d err=%v", calls.Load(), err)
+	}
+	in.Invalidate()
+	if _, err := in.VerifyContext(context.Background(), "tok"); err != nil || calls.Load() != 5 {
+		t.Fatalf("expected refetch after Invalidate, calls=%d err=%v", calls.Load(), err)
+	}
+}
+
+func TestNewIntrospector_RequiresURL(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewIntrospector(IntrospectionConfig{}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SigningKey is a kid-tagged key used by Issuer to sign tokens.
+//
+// Key must match Method:
+//   - HS256/384/512: []byte (at least 32 bytes)
+//   - RS*/PS*: *rsa.PrivateKey
+//   - ES256/384/512: *ecdsa.PrivateKey on the matching curve
+//   - EdDSA: ed25519.PrivateKey
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    any
+}
+
+// verificationKey returns the key Verifier needs: the secret for HMAC, the public half otherwise.
+func (k SigningKey) verificationKey() any {
+	if s, ok := k.Key.(crypto.Signer); ok {
+		return s.Public()
+	}
+	return k.Key
+}
+
+func (k SigningKey) validate() error {
+	if strings.TrimSpace(k.ID) == "" {
+		return errors.New("auth: signing key requires id")
+	}
+	if k.Method == nil {
+		return fmt.Errorf("auth: signing key %q requires method", k.ID)
+	}
+
+	ok := false
+	switch m := k.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		b, isBytes := k.Key.([]byte)
+		ok = isBytes && len(b) >= 32
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = k.Key.(*rsa.PrivateKey)
+	case *jwt.SigningMethodECDSA:
+		ec, isEC := k.Key.(*ecdsa.PrivateKey)
+		ok = isEC && ec.Curve.Params().BitSize == m.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok = k.Key.(ed25519.PrivateKey)
+	}
+	if !ok {
+		return fmt.Errorf("auth: signing key %q does not match method %s", k.ID, k.Method.Alg())
+	}
+	return nil
+}
+
+// IssuerConfig controls the registered claims of minted tokens.
+type IssuerConfig struct {
+	// Issuer is written to "iss". Optional.
+	Issuer string
+
+	// Audience is written to "aud" when the claims carry none. Optional.
+	Audience []string
+
+	// TTL defaults to 15 minutes.
+	TTL time.Duration
+
+	// NotBeforeSkew backdates "nbf" to tolerate clock skew on verifiers. Defaults to 0 (nbf = iat).
+	NotBeforeSkew time.Duration
+
+	// Keys is the signing keyring. All keys are accepted by Issuer.KeyFunc;
+	// tokens are signed with ActiveKeyID, or with the first key if ActiveKeyID is empty.
+	Keys        []SigningKey
+	ActiveKeyID string
+
+	// Keyring, if set, replaces Keys and ActiveKeyID: tokens are signed with its active key
+	// and key rotations (Keyring.Reload, Keyring.Watch) apply without a new Issuer.
+	Keyring *Keyring
+}
+
+// Issuer mints JWTs compatible with Verifier.
+type Issuer struct {
+	cfg    IssuerConfig
+	keys   map[string]SigningKey
+	active SigningKey
+	now    func() time.Time
+}
+
+// NewIssuer validates cfg and returns an Issuer.
+func NewIssuer(cfg IssuerConfig) (*Issuer, error) {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 15 * time.Minute
+	}
+	if cfg.NotBeforeSkew < 0 {
+		cfg.NotBeforeSkew = 0
+	}
+	if cfg.Keyring != nil {
+		if len(cfg.Keys) > 0 || cfg.ActiveKeyID != "" {
+			return nil, errors.New("auth: issuer accepts either Keys or Keyring")
+		}
+		if _, err := cfg.Keyring.Active(); err != nil {
+			return nil, err
+		}
+		return &Issuer{cfg: cfg, now: time.Now}, nil
+	}
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("auth: issuer requires at least one signing key")
+	}
+
+	keys := make(map[string]SigningKey, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+		if _, dup := keys[k.ID]; dup {
+			return nil, fmt.Errorf("auth: duplicate signing key id %q", k.ID)
+		}
+		keys[k.ID] = k
+	}
+
+	active := cfg.Keys[0]
+	if cfg.ActiveKeyID != "" {
+		k, ok := keys[cfg.ActiveKeyID]
+		if !ok {
+			return nil, fmt.Errorf("auth: unknown active key id %q", cfg.ActiveKeyID)
+		}
+		active = k
+	}
+
+	return &Issuer{cfg: cfg, keys: keys, active: active, now: time.Now}, nil
+}
+
+// Issue signs claims with the active key.
+//
+// Registered claims left empty are filled from config: iss, aud, iat, nbf, exp and jti.
+// Subject and TenantID (or Memberships) are required, matching what Verifier enforces.
+func (i *Issuer) Issue(claims Claims) (string, error) {
+	if strings.TrimSpace(claims.Subject) == "" {
+		return "", ErrMissingSubject
+	}
+	if !claims.hasTenant() {
+		return "", ErrMissingTenantID
+	}
+
+	now := i.now()
+	rc := &claims.RegisteredClaims
+	if rc.Issuer == "" {
+		rc.Issuer = i.cfg.Issuer
+	}
+	if len(rc.Audience) == 0 && len(i.cfg.Audience) > 0 {
+		rc.Audience = append(jwt.ClaimStrings(nil), i.cfg.Audience...)
+	}
+	if rc.IssuedAt == nil {
+		rc.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if rc.NotBefore == nil {
+		rc.NotBefore = jwt.NewNumericDate(now.Add(-i.cfg.NotBeforeSkew))
+	}
+	if rc.ExpiresAt == nil {
+		rc.ExpiresAt = jwt.NewNumericDate(now.Add(i.cfg.TTL))
+	}
+	if rc.ID == "" {
+		rc.ID = uuid.NewString()
+	}
+
+	active := i.active
+	if i.cfg.Keyring != nil {
+		k, err := i.cfg.Keyring.Active()
+		if err != nil {
+			return "", err
+		}
+		active = k
+	}
+
+	tok := jwt.NewWithClaims(active.Method, claims)
+	tok.Header["kid"] = active.ID
+
+	s, err := tok.SignedString(active.Key)
+	if err != nil {
+		return "", fmt.Errorf("auth: sign token: %w", err)
+	}
+	return s, nil
+}
+
+// KeyFunc returns the verification key for tokens minted by this Issuer, selected by "kid".
+func (i *Issuer) KeyFunc(t *jwt.Token) (any, error) {
+	if i.cfg.Keyring != nil {
+		return i.cfg.Keyring.KeyFunc(t)
+	}
+	kid, _ := t.Header["kid"].(string)
+	k, ok := i.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if t.Method == nil || t.Method.Alg() != k.Method.Alg() {
+		return nil, ErrUnknownKeyID
+	}
+	return k.verificationKey(), nil
+}
+
+// Methods returns the signing algorithms used by the keyring, suitable for VerifyConfig.AllowedMethods.
+func (i *Issuer) Methods() []string {
+	if i.cfg.Keyring != nil {
+		return i.cfg.Keyring.Methods()
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range i.cfg.Keys {
+		alg := k.Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// JWKS returns the public keys of the keyring as a JWKS document.
+// HMAC keys are secret and never published, nor are retired Keyring keys.
+func (i *Issuer) JWKS() (JWKSet, error) {
+	keys := i.cfg.Keys
+	if i.cfg.Keyring != nil {
+		keys = nil
+		for _, k := range i.cfg.Keyring.Keys() {
+			if k.State != KeyRetired {
+				keys = append(keys, k.SigningKey)
+			}
+		}
+	}
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range keys {
+		if _, hmac := k.Method.(*jwt.SigningMethodHMAC); hmac {
+			continue
+		}
+		jwk, err := NewJWK(k.ID, k.Method.Alg(), k.verificationKey())
+		if err != nil {
+			return JWKSet{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
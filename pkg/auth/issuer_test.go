@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIssuer_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	keys := []SigningKey{
+		{ID: "hs", Method: jwt.SigningMethodHS256, Key: secret},
+		{ID: "rs", Method: jwt.SigningMethodRS256, Key: rsaKey},
+		{ID: "es", Method: jwt.SigningMethodES384, Key: ecKey},
+		{ID: "ed", Method: jwt.SigningMethodEdDSA, Key: edKey},
+	}
+
+	for _, k := range keys {
+		k := k
+		t.Run(k.ID, func(t *testing.T) {
+			t.Parallel()
+
+			iss, err := NewIssuer(IssuerConfig{
+				Issuer:      "identity",
+				Audience:    []string{"api"},
+				TTL:         time.Minute,
+				Keys:        keys,
+				ActiveKeyID: k.ID,
+			})
+			if err != nil {
+				t.Fatalf("NewIssuer: %v", err)
+			}
+
+			tok, err := iss.Issue(Claims{
+				TenantID:         "t1",
+				Scopes:           []string{"orders:read"},
+				RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+			})
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+
+			v := Verifier{
+				KeyFunc: iss.KeyFunc,
+				Config: VerifyConfig{
+					AllowedMethods:  iss.Methods(),
+					Issuer:          "identity",
+					RequireIssuer:   true,
+					Audience:        "api",
+					RequireAudience: true,
+				},
+			}
+			got, err := v.Verify(tok)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got.Subject != "u1" || got.TenantID != "t1" || got.ID == "" {
+				t.Fatalf("unexpected claims: %+v", got)
+			}
+			if got.NotBefore == nil || got.ExpiresAt == nil || got.ExpiresAt.Sub(got.IssuedAt.Time) != time.Minute {
+				t.Fatalf("unexpected times: %+v", got.RegisteredClaims)
+			}
+		})
+	}
+}
+
+func TestIssuer_JWKSRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	iss, err := NewIssuer(IssuerConfig{Keys: []SigningKey{
+		{ID: "rs", Method: jwt.SigningMethodRS256, Key: rsaKey},
+		{ID: "hs", Method: jwt.SigningMethodHS256, Key: []byte("0123456789abcdef0123456789abcdef")},
+	}})
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+
+	set, err := iss.JWKS()
+	if err != nil {
+		t.Fatalf("JWKS: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kid != "rs" {
+		t.Fatalf("hmac keys must not be published: %+v", set)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer srv.Close()
+
+	jwks, _ := NewJWKS(JWKSConfig{URL: srv.URL})
+	tok, err := iss.Issue(Claims{TenantID: "t1", RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := (Verifier{KeyFunc: jwks.KeyFunc}).Verify(tok); err != nil {
+		t.Fatalf("Verify via JWKS: %v", err)
+	}
+}
+
+func TestIssuer_Validation(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name string
+		cfg  IssuerConfig
+	}{
+		{"no keys", IssuerConfig{}},
+		{"missing id", IssuerConfig{Keys: []SigningKey{{Method: jwt.SigningMethodHS256, Key: secret}}}},
+		{"missing method", IssuerConfig{Keys: []SigningKey{{ID: "k", Key: secret}}}},
+		{"short hmac secret", IssuerConfig{Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodHS256, Key: []byte("short")}}}},
+		{"rsa key for ec method", IssuerConfig{Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodES256, Key: rsaKey}}}},
+		{"ec curve mismatch", IssuerConfig{Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodES384, Key: ecKey}}}},
+		{"duplicate id", IssuerConfig{Keys: []SigningKey{
+			{ID: "k", Method: jwt.SigningMethodHS256, Key: secret},
+			{ID: "k", Method: jwt.SigningMethodHS256, Key: secret},
+		}}},
+		{"unknown active", IssuerConfig{ActiveKeyID: "x", Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodHS256, Key: secret}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewIssuer(tt.cfg); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+	}
+
+	iss, _ := NewIssuer(IssuerConfig{Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodHS256, Key: secret}}})
+	if _, err := iss.Issue(Claims{TenantID: "t1"}); err != ErrMissingSubject {
+		t.Fatalf("expected ErrMissingSubject, got %v", err)
+	}
+	if _, err := iss.Issue(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}}); err != ErrMissingTenantID {
+		t.Fatalf("expected ErrMissingTenantID, got %v", err)
+	}
+	if _, err := iss.KeyFunc(&jwt.Token{Header: map[string]any{"kid": "other"}, Method: jwt.SigningMethodHS256}); err != ErrUnknownKeyID {
+		t.Fatalf("expected ErrUnknownKeyID, got %v", err)
+	}
+	if _, err := iss.KeyFunc(&jwt.Token{Header: map[string]any{"kid": "k"}, Method: jwt.SigningMethodHS512}); err != ErrUnknownKeyID {
+		t.Fatalf("expected alg mismatch ErrUnknownKeyID, got %v", err)
+	}
+}
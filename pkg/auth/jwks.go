@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/httpx"
+)
+
+var (
+	// ErrJWKSUnavailable indicates the JWKS document could not be fetched or parsed.
+	// It wraps ErrKeySourceUnavailable.
+	ErrJWKSUnavailable = fmt.Errorf("%w: jwks", ErrKeySourceUnavailable)
+
+	// ErrUnknownKeyID indicates no verification key matches the token "kid".
+	ErrUnknownKeyID = errors.New("auth: unknown key id")
+)
+
+const maxJWKSBytes = 1 << 20
+
+// JWK is a single JSON Web Key (RFC 7517). Only public key members are modeled.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC / OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JWKS document: {"keys": [...]}.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK builds a JWK from an RSA, ECDSA or Ed25519 public key.
+func NewJWK(kid, alg string, pub crypto.PublicKey) (JWK, error) {
+	k := JWK{Kid: kid, Alg: alg, Use: "sig"}
+
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = b64(p.N.Bytes())
+		k.E = b64(big.NewInt(int64(p.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (p.Curve.Params().BitSize + 7) / 8
+		k.Kty = "EC"
+		k.Crv = p.Curve.Params().Name
+		k.X = b64(p.X.FillBytes(make([]byte, size)))
+		k.Y = b64(p.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = b64(p)
+	default:
+		return JWK{}, fmt.Errorf("auth: unsupported public key type %T", pub)
+	}
+	return k, nil
+}
+
+// PublicKey decodes the JWK into *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := unb64(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("auth: invalid RSA modulus")
+		}
+		e, err := unb64(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("auth: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var (
+			curve elliptic.Curve
+			check ecdh.Curve
+		)
+		switch k.Crv {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, check = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("auth: unsupported EC curve %q", k.Crv)
+		}
+		x, errX := unb64(k.X)
+		y, errY := unb64(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("auth: invalid EC point")
+		}
+		// crypto/ecdh validates that the point is on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := check.NewPublicKey(point); err != nil {
+			return nil, errors.New("auth: invalid EC point")
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("auth: unsupported OKP curve %q", k.Crv)
+		}
+		x, err := unb64(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("auth: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("auth: unsupported key type %q", k.Kty)
+	}
+}
+
+// JWKSConfig controls fetching and caching of a remote JWKS document.
+type JWKSConfig struct {
+	// URL of the JWKS document, e.g. https://identity.internal/.well-known/jwks.json.
+	URL string
+
+	// HTTPClient defaults to httpx.NewClient with a 5s timeout.
+	HTTPClient *http.Client
+
+	// TTL controls how long a fetched key set is considered fresh. Defaults to 10 minutes.
+	// A stale key set keeps serving if a refresh fails.
+	TTL time.Duration
+
+	// MinRefreshInterval rate-limits refreshes triggered by an unknown kid. Defaults to 30 seconds.
+	MinRefreshInterval time.Duration
+}
+
+type jwksKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKS provides verification keys from a remote JWKS document.
+// Use JWKS.KeyFunc as Verifier.KeyFunc.
+type JWKS struct {
+	cfg JWKSConfig
+	now func() time.Time
+
+	mu          sync.RWMutex
+	keys        map[string]jwksKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+
+	refreshMu sync.Mutex
+}
+
+// NewJWKS creates a JWKS provider. Keys are fetched lazily on first use.
+func NewJWKS(cfg JWKSConfig) (*JWKS, error) {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, errors.New("auth: missing jwks url")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = httpx.NewClient(httpx.ClientConfig{Timeout: 5 * time.Second})
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 10 * time.Minute
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = 30 * time.Second
+	}
+	return &JWKS{cfg: cfg, now: time.Now}, nil
+}
+
+// KeyFunc implements jwt.Keyfunc. Keys are selected by the "kid" header.
+// A token without "kid" is accepted only when the key set holds exactly one key.
+func (j *JWKS) KeyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	ctx := context.Background()
+	if j.stale() && j.canRetry() {
+		// On failure keep serving the previous key set (if any).
+		_ = j.refresh(ctx, false)
+	}
+
+	k, ok := j.lookup(kid)
+	if !ok && j.canRetry() {
+		if err := j.refresh(ctx, true); err != nil {
+			return nil, err
+		}
+		k, ok = j.lookup(kid)
+	}
+	if !ok {
+		if !j.loaded() {
+			// no key set yet and the last fetch failed recently: an outage, not a bad kid
+			return nil, fmt.Errorf("%w: no key set loaded", ErrJWKSUnavailable)
+		}
+		return nil, ErrUnknownKeyID
+	}
+
+	if k.alg != "" && t.Method != nil && k.alg != t.Method.Alg() {
+		return nil, ErrUnknownKeyID
+	}
+	return k.key, nil
+}
+
+// Refresh fetches the JWKS document immediately.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	return j.refresh(ctx, true)
+}
+
+func (j *JWKS) lookup(kid string) (jwksKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if kid == "" {
+		if len(j.keys) != 1 {
+			return jwksKey{}, false
+		}
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+func (j *JWKS) loaded() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.keys != nil
+}
+
+func (j *JWKS) stale() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.keys == nil || j.now().Sub(j.fetchedAt) >= j.cfg.TTL
+}
+
+func (j *JWKS) canRetry() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.now().Sub(j.lastAttempt) >= j.cfg.MinRefreshInterval
+}
+
+// refresh fetches the key set. Concurrent callers share a single fetch:
+// a caller that waited for an in-flight refresh returns without fetching again.
+func (j *JWKS) refresh(ctx context.Context, force bool) error {
+	j.mu.RLock()
+	started := j.lastAttempt
+	j.mu.RUnlock()
+
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	j.mu.RLock()
+	done := j.lastAttempt != started
+	j.mu.RUnlock()
+	if done || (!force && !j.stale()) {
+		return nil
+	}
+
+	j.mu.Lock()
+	j.lastAttempt = j.now()
+	j.mu.Unlock()
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = j.now()
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]jwksKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.cfg.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWKSUnavailable, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWKSUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrJWKSUnavailable, resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWKSUnavailable, err)
+	}
+
+	keys := make(map[string]jwksKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			// Skip keys we cannot use instead of failing the whole set.
+			continue
+		}
+		keys[k.Kid] = jwksKey{alg: k.Alg, key: pub}
+	}
+	return keys, nil
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func unb64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type jwksServer struct {
+	mu    sync.Mutex
+	set   JWKSet
+	calls int32
+	srv   *httptest.Server
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+	s := &jwksServer{}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(s.set)
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *jwksServer) publish(t *testing.T, kid, alg string, pub crypto.PublicKey) {
+	t.Helper()
+	k, err := NewJWK(kid, alg, pub)
+	if err != nil {
+		t.Fatalf("NewJWK: %v", err)
+	}
+	s.mu.Lock()
+	s.set.Keys = append(s.set.Keys, k)
+	s.mu.Unlock()
+}
+
+func signWithKID(t *testing.T, m jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(m, Claims{
+		TenantID: "t1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return s
+}
+
+func TestJWKS_KeyTypes(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	s := newJWKSServer(t)
+	s.publish(t, "rsa", "RS256", &rsaKey.PublicKey)
+	s.publish(t, "ec", "ES256", &ecKey.PublicKey)
+	s.publish(t, "ed", "EdDSA", edPub)
+
+	jwks, err := NewJWKS(JWKSConfig{URL: s.srv.URL})
+	if err != nil {
+		t.Fatalf("NewJWKS: %v", err)
+	}
+	v := Verifier{
+		KeyFunc: jwks.KeyFunc,
+		Config:  VerifyConfig{AllowedMethods: []string{"RS256", "ES256", "EdDSA"}},
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"rsa", signWithKID(t, jwt.SigningMethodRS256, "rsa", rsaKey)},
+		{"ec", signWithKID(t, jwt.SigningMethodES256, "ec", ecKey)},
+		{"ed25519", signWithKID(t, jwt.SigningMethodEdDSA, "ed", edPriv)},
+	}
+	for _, tt := range tests {
+		if _, err := v.Verify(tt.token); err != nil {
+			t.Fatalf("%s: unexpected err: %v", tt.name, err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&s.calls); got != 1 {
+		t.Fatalf("expected 1 fetch, got %d", got)
+	}
+
+	// alg pinned by the JWK must match the token header
+	bad := signWithKID(t, jwt.SigningMethodRS512, "rsa", rsaKey)
+	v.Config.AllowedMethods = append(v.Config.AllowedMethods, "RS512")
+	if _, err := v.Verify(bad); err == nil {
+		t.Fatalf("expected alg mismatch to fail")
+	}
+}
+
+func TestJWKS_Rotation(t *testing.T) {
+	t.Parallel()
+
+	k1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	k2, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	s := newJWKSServer(t)
+	s.publish(t, "k1", "RS256", &k1.PublicKey)
+
+	jwks, _ := NewJWKS(JWKSConfig{URL: s.srv.URL, MinRefreshInterval: time.Minute})
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+
+	v := Verifier{KeyFunc: jwks.KeyFunc}
+
+	if _, err := v.Verify(signWithKID(t, jwt.SigningMethodRS256, "k1", k1)); err != nil {
+		t.Fatalf("k1: %v", err)
+	}
+
+	// rotate: k2 is published, but refresh is rate-limited
+	s.publish(t, "k2", "RS256", &k2.PublicKey)
+	if _, err := v.Verify(signWithKID(t, jwt.SigningMethodRS256, "k2", k2)); err == nil {
+		t.Fatalf("expected unknown kid within rate limit window")
+	}
+	if got := atomic.LoadInt32(&s.calls); got != 1 {
+		t.Fatalf("expected 1 fetch, got %d", got)
+	}
+
+	// after the rate limit window an unknown kid triggers refresh
+	now = now.Add(time.Minute)
+	if _, err := v.Verify(signWithKID(t, jwt.SigningMethodRS256, "k2", k2)); err != nil {
+		t.Fatalf("k2: %v", err)
+	}
+	if got := atomic.LoadInt32(&s.calls); got != 2 {
+		t.Fatalf("expected 2 fetches, got %d", got)
+	}
+}
+
+func TestJWKS_TTLAndStaleOnError(t *testing.T) {
+	t.Parallel()
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pub, _ := NewJWK("k1", "", &key.PublicKey)
+
+	var fail atomic.Bool
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{pub}})
+	}))
+	defer srv.Close()
+
+	jwks, _ := NewJWKS(JWKSConfig{URL: srv.URL, TTL: time.Minute, MinRefreshInterval: time.Second})
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+
+	v := Verifier{KeyFunc: jwks.KeyFunc}
+	tok := signWithKID(t, jwt.SigningMethodRS256, "", key)
+
+	if _, err := v.Verify(tok); err != nil {
+		t.Fatalf("no kid with single key: %v", err)
+	}
+
+	fail.Store(true)
+	now = now.Add(2 * time.Minute)
+	if _, err := v.Verify(tok); err != nil {
+		t.Fatalf("stale keys should keep serving: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected refresh after ttl, got %d fetches", got)
+	}
+}
+
+func TestJWKS_Errors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewJWKS(JWKSConfig{}); err == nil {
+		t.Fatalf("expected missing url error")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	jwks, _ := NewJWKS(JWKSConfig{URL: srv.URL})
+	if err := jwks.Refresh(t.Context()); !errors.Is(err, ErrJWKSUnavailable) {
+		t.Fatalf("expected ErrJWKSUnavailable, got %v", err)
+	}
+	if _, err := jwks.KeyFunc(&jwt.Token{Header: map[string]any{"kid": "x"}}); !errors.Is(err, ErrJWKSUnavailable) {
+		t.Fatalf("expected ErrJWKSUnavailable before any key set loaded, got %v", err)
+	}
+
+	// an outage is not an invalid token
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1"}).SignedString([]byte("k"))
+	_, err := (&Verifier{KeyFunc: jwks.KeyFunc}).Verify(signed)
+	if !errors.Is(err, ErrKeySourceUnavailable) || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrKeySourceUnavailable, got %v", err)
+	}
+	if got := VerifyErrorReason(err); got != "key_source_unavailable" {
+		t.Fatalf("reason=%q", got)
+	}
+}
+
+func TestJWK_PublicKey_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"unknown kty", JWK{Kty: "oct"}},
+		{"rsa missing n", JWK{Kty: "RSA", E: "AQAB"}},
+		{"ec bad curve", JWK{Kty: "EC", Crv: "P-1"}},
+		{"ec off curve", JWK{Kty: "EC", Crv: "P-256", X: b64(make([]byte, 32)), Y: b64(make([]byte, 32))}},
+		{"okp bad curve", JWK{Kty: "OKP", Crv: "X25519"}},
+		{"okp bad size", JWK{Kty: "OKP", Crv: "Ed25519", X: "AA"}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.jwk.PublicKey(); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+	}
+
+	if _, err := NewJWK("k", "", "not a key"); err == nil {
+		t.Fatalf("expected unsupported key error")
+	}
+}
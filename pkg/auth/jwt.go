@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,13 +23,47 @@ var (
 	// ErrMissingSubject indicates the token has no "sub".
 	ErrMissingSubject = errors.New("auth: missing subject")
 
-	// ErrMissingTenantID indicates the token has no tenant_id.
+	// ErrMissingTenantID indicates the token has neither tenant_id nor memberships.
 	ErrMissingTenantID = errors.New("auth: missing tenant_id")
+
+	// ErrKeySourceUnavailable indicates the verification keys could not be obtained, e.g.
+	// the JWKS endpoint is down. It is an outage, not an invalid token: verification fails
+	// closed and middleware answers 503. Custom KeyFuncs wrap it to signal the same.
+	ErrKeySourceUnavailable = errors.New("auth: key source unavailable")
+)
+
+// Typed verification failures. All of them wrap ErrInvalidToken, so errors.Is(err, ErrInvalidToken)
+// keeps working; use VerifyErrorReason for logs and metrics. Never send them to clients.
+var (
+	ErrTokenMalformed   = fmt.Errorf("%w: malformed", ErrInvalidToken)
+	ErrTokenExpired     = fmt.Errorf("%w: expired", ErrInvalidToken)
+	ErrTokenNotYetValid = fmt.Errorf("%w: not yet valid", ErrInvalidToken)
+	ErrTokenSignature   = fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	ErrTokenAudience    = fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	ErrTokenIssuer      = fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	ErrTokenAlgorithm   = fmt.Errorf("%w: unsupported alg", ErrInvalidToken)
 )
 
 type Claims struct {
 	TenantID string   `json:"tenant_id"`
 	Scopes   []string `json:"scopes,omitempty"`
+
+	// Memberships lists the tenants the subject belongs to, for users in several
+	// workspaces. TenantID is then the default tenant and may be empty.
+	Memberships []Membership `json:"memberships,omitempty"`
+
+	// Act is the RFC 8693 actor: the party acting on behalf of Subject, if delegated.
+	Act *Actor `json:"act,omitempty"`
+
+	// Impersonator is the real subject (e.g. a support engineer) of a token issued to act
+	// as Subject; see middleware.Impersonation.
+	Impersonator string `json:"impersonator,omitempty"`
+
+	// How and when the user authenticated (OpenID Connect); see StepUp.
+	ACR      string           `json:"acr,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
@@ -42,12 +80,51 @@ type VerifyConfig struct {
 	RequireIssuer   bool
 	Audience        string
 	RequireAudience bool
+
+	// Claims optionally maps tenant and scopes from non-standard claim names.
+	Claims ClaimMapping
+}
+
+// ClaimMapping reads Claims.TenantID and Claims.Scopes from other token claims,
+// e.g. for an external IdP that does not emit tenant_id.
+//
+// Claim names are looked up as-is first (so namespaced claims such as
+// "https://example.com/tenant" work), then as a dot-separated path into nested objects.
+type ClaimMapping struct {
+	// TenantID is the claim holding the tenant id. Defaults to "tenant_id".
+	TenantID string
+
+	// FixedTenantID, if set, assigns every token to this tenant and ignores tenant claims.
+	// Use it for a customer IdP that can only speak for its own tenant.
+	FixedTenantID string
+
+	// Scopes is the claim holding scopes, either a list or a space-separated string
+	// (as in the OAuth "scope" claim). Defaults to "scopes".
+	Scopes string
+
+	// TrustMemberships keeps the "memberships" claim of tokens verified with this mapping.
+	// Without it, a non-empty mapping drops memberships, so a foreign IdP cannot grant
+	// access to other tenants. With FixedTenantID only that tenant's membership is kept.
+	TrustMemberships bool
+}
+
+func (m ClaimMapping) isZero() bool {
+	return m == ClaimMapping{}
+}
+
+// TokenVerifier verifies a raw bearer token. Verifier, MultiVerifier and Introspector implement it.
+type TokenVerifier interface {
+	VerifyContext(ctx context.Context, token string) (*Claims, error)
 }
 
 type Verifier struct {
 	// KeyFunc is used to provide the verification key based on token header (kid, alg, etc).
 	KeyFunc jwt.Keyfunc
 	Config  VerifyConfig
+
+	// Revocation optionally rejects revoked tokens by jti and subject-wide cutoff.
+	// Store failures fail closed with ErrRevocationUnavailable.
+	Revocation RevocationStore
 }
 
 // ParseBearer extracts the raw JWT from an Authorization header value.
@@ -71,14 +148,29 @@ func ParseBearer(authorization string) (string, error) {
 	return tok, nil
 }
 
+// Verify is VerifyContext with context.Background().
 func (v Verifier) Verify(token string) (*Claims, error) {
+	return v.VerifyContext(context.Background(), token)
+}
+
+// VerifyContext parses and validates token. ctx is used for revocation lookups.
+func (v Verifier) VerifyContext(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	if err := v.verifyInto(ctx, token, claims, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifyInto parses token into target and validates it. claims is the Claims embedded in target.
+func (v Verifier) verifyInto(ctx context.Context, token string, target jwt.Claims, claims *Claims) error {
 	if v.KeyFunc == nil {
-		return nil, ErrMissingKeyFunc
+		return ErrMissingKeyFunc
 	}
 
 	token = strings.TrimSpace(token)
 	if token == "" {
-		return nil, ErrInvalidToken
+		return ErrInvalidToken
 	}
 
 	methods := v.Config.AllowedMethods
@@ -90,40 +182,56 @@ func (v Verifier) Verify(token string) (*Claims, error) {
 		}
 	}
 
+	// The alg allowlist is enforced here rather than with jwt.WithValidMethods so that an
+	// unsupported alg can be told apart from a bad signature.
+	keyFuncCalled := false
+	keyFunc := func(t *jwt.Token) (any, error) {
+		keyFuncCalled = true
+		if !slices.Contains(methods, t.Method.Alg()) {
+			return nil, ErrTokenAlgorithm
+		}
+		return v.KeyFunc(t)
+	}
+
 	parsed, err := jwt.ParseWithClaims(
 		token,
-		&Claims{},
-		v.KeyFunc,
+		target,
+		keyFunc,
 		jwt.WithLeeway(v.Config.Leeway),
-		jwt.WithValidMethods(methods),
 	)
 	if err != nil {
-		return nil, ErrInvalidToken
+		return classifyParseError(err, keyFuncCalled)
 	}
 	if !parsed.Valid {
-		return nil, ErrInvalidToken
+		return ErrInvalidToken
 	}
 
-	claims, ok := parsed.Claims.(*Claims)
-	if !ok || claims == nil {
-		return nil, ErrInvalidToken
+	if !v.Config.Claims.isZero() {
+		raw, err := rawClaims(token)
+		if err != nil {
+			return ErrTokenMalformed
+		}
+		v.Config.Claims.apply(claims, raw)
 	}
 
 	if strings.TrimSpace(claims.Subject) == "" {
-		return nil, ErrMissingSubject
+		return ErrMissingSubject
+	}
+	if !claims.hasTenant() {
+		return ErrMissingTenantID
 	}
-	if strings.TrimSpace(claims.TenantID) == "" {
-		return nil, ErrMissingTenantID
+	if err := claims.checkActorChain(); err != nil {
+		return err
 	}
 
 	// Optional issuer check
 	if v.Config.RequireIssuer {
 		if strings.TrimSpace(v.Config.Issuer) == "" {
 			// misconfiguration: treat as invalid token, but don't leak details
-			return nil, ErrInvalidToken
+			return ErrInvalidToken
 		}
 		if claims.Issuer != v.Config.Issuer {
-			return nil, ErrInvalidToken
+			return ErrTokenIssuer
 		}
 	}
 
@@ -131,7 +239,7 @@ func (v Verifier) Verify(token string) (*Claims, error) {
 	if v.Config.RequireAudience {
 		aud := strings.TrimSpace(v.Config.Audience)
 		if aud == "" {
-			return nil, ErrInvalidToken
+			return ErrInvalidToken
 		}
 
 		ok := false
@@ -142,9 +250,158 @@ func (v Verifier) Verify(token string) (*Claims, error) {
 			}
 		}
 		if !ok {
-			return nil, ErrInvalidToken
+			return ErrTokenAudience
 		}
 	}
 
-	return claims, nil
+	if v.Revocation != nil {
+		if err := CheckRevocation(ctx, v.Revocation, claims); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// classifyParseError maps jwt parse errors to the typed errors above.
+func classifyParseError(err error, keyFuncCalled bool) error {
+	switch {
+	case errors.Is(err, ErrTokenAlgorithm):
+		return ErrTokenAlgorithm
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ErrTokenSignature
+	case errors.Is(err, ErrKeySourceUnavailable):
+		return err
+	case errors.Is(err, jwt.ErrTokenUnverifiable) && !keyFuncCalled:
+		// the header names an alg this build does not know
+		return ErrTokenAlgorithm
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		// no key for the token (unknown kid); keep the cause for errors.Is
+		return fmt.Errorf("%w: %w", ErrTokenSignature, err)
+	default:
+		return ErrTokenMalformed
+	}
+}
+
+// VerifyErrorReason returns a stable, low-cardinality label for a verification error,
+// suitable for logs and metric labels.
+func VerifyErrorReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, ErrTokenNotYetValid):
+		return "not_yet_valid"
+	case errors.Is(err, ErrTokenSignature):
+		return "bad_signature"
+	case errors.Is(err, ErrKeySourceUnavailable):
+		return "key_source_unavailable"
+	case errors.Is(err, ErrTokenAudience):
+		return "wrong_audience"
+	case errors.Is(err, ErrTokenIssuer):
+		return "wrong_issuer"
+	case errors.Is(err, ErrUnknownIssuer):
+		return "unknown_issuer"
+	case errors.Is(err, ErrTokenAlgorithm):
+		return "unsupported_alg"
+	case errors.Is(err, ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, ErrTokenActorChain):
+		return "actor_chain_too_long"
+	case errors.Is(err, ErrTokenRevoked):
+		return "revoked"
+	case errors.Is(err, ErrTokenInactive):
+		return "inactive"
+	case errors.Is(err, ErrIntrospectionUnavailable):
+		return "introspection_unavailable"
+	case errors.Is(err, ErrRevocationUnavailable):
+		return "revocation_unavailable"
+	case errors.Is(err, ErrMissingSubject):
+		return "missing_subject"
+	case errors.Is(err, ErrMissingTenantID):
+		return "missing_tenant"
+	case errors.Is(err, ErrInvalidAPIKey):
+		return "invalid_api_key"
+	case errors.Is(err, ErrAPIKeyUnavailable):
+		return "api_key_unavailable"
+	case errors.Is(err, ErrInsufficientAuthentication):
+		return "insufficient_user_authentication"
+	default:
+		return "invalid"
+	}
+}
+
+// rawClaims decodes the payload of an already verified token for ClaimMapping.
+func rawClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	data, err := jwt.NewParser().DecodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (m ClaimMapping) apply(claims *Claims, raw map[string]any) {
+	switch {
+	case m.FixedTenantID != "":
+		claims.TenantID = m.FixedTenantID
+	case m.TenantID != "":
+		claims.TenantID, _ = lookupClaim(raw, m.TenantID).(string)
+	}
+
+	switch {
+	case !m.TrustMemberships:
+		claims.Memberships = nil
+	case m.FixedTenantID != "":
+		var kept []Membership
+		for _, ms := range claims.Memberships {
+			if ms.TenantID == m.FixedTenantID {
+				kept = append(kept, ms)
+			}
+		}
+		claims.Memberships = kept
+	}
+
+	if m.Scopes != "" {
+		claims.Scopes = nil
+		switch v := lookupClaim(raw, m.Scopes).(type) {
+		case string:
+			claims.Scopes = strings.Fields(v)
+		case []any:
+			for _, s := range v {
+				if str, ok := s.(string); ok {
+					claims.Scopes = append(claims.Scopes, str)
+				}
+			}
+		}
+	}
+}
+
+func lookupClaim(raw map[string]any, name string) any {
+	if v, ok := raw[name]; ok {
+		return v
+	}
+	var cur any = raw
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil
+		}
+	}
+	return cur
 }
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -103,8 +105,8 @@ func TestVerifier_Verify_HS256(t *testing.T) {
 		t.Parallel()
 		token := makeToken("u1", "t1", "", nil, time.Now().Add(-time.Hour))
 		_, err := v.Verify(token)
-		if err != ErrInvalidToken {
-			t.Fatalf("expected ErrInvalidToken, got %v", err)
+		if !errors.Is(err, ErrTokenExpired) || !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected ErrTokenExpired, got %v", err)
 		}
 	})
 
@@ -137,8 +139,8 @@ func TestVerifier_Verify_HS256(t *testing.T) {
 		}
 		token := makeToken("u1", "t1", "issuer-b", nil, time.Now().Add(time.Hour))
 		_, err := v2.Verify(token)
-		if err != ErrInvalidToken {
-			t.Fatalf("expected ErrInvalidToken, got %v", err)
+		if !errors.Is(err, ErrTokenIssuer) || !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected ErrTokenIssuer, got %v", err)
 		}
 	})
 
@@ -153,8 +155,8 @@ func TestVerifier_Verify_HS256(t *testing.T) {
 		}
 		token := makeToken("u1", "t1", "", []string{"other"}, time.Now().Add(time.Hour))
 		_, err := v2.Verify(token)
-		if err != ErrInvalidToken {
-			t.Fatalf("expected ErrInvalidToken, got %v", err)
+		if !errors.Is(err, ErrTokenAudience) || !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected ErrTokenAudience, got %v", err)
 		}
 	})
 
@@ -174,3 +176,95 @@ func TestVerifier_Verify_HS256(t *testing.T) {
 		}
 	})
 }
+
+func TestVerifier_TypedErrors(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	v := Verifier{
+		KeyFunc: func(t *jwt.Token) (any, error) {
+			if t.Header["kid"] == "gone" {
+				return nil, ErrUnknownKeyID
+			}
+			return secret, nil
+		},
+		Config: VerifyConfig{Issuer: "iss", RequireIssuer: true, Audience: "api", RequireAudience: true},
+	}
+
+	sign := func(method jwt.SigningMethod, key any, claims jwt.MapClaims, kid string) string {
+		base := jwt.MapClaims{"sub": "u1", "tenant_id": "t1", "iss": "iss", "aud": "api", "exp": time.Now().Add(time.Hour).Unix()}
+		for k, val := range claims {
+			base[k] = val
+		}
+		tok := jwt.NewWithClaims(method, base)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	valid := sign(jwt.SigningMethodHS256, secret, nil, "")
+	parts := strings.Split(valid, ".")
+	unknownAlg := b64([]byte(`{"alg":"XYZ","typ":"JWT"}`)) + "." + parts[1] + "." + parts[2]
+
+	tests := []struct {
+		name   string
+		token  string
+		want   error
+		reason string
+	}{
+		{"expired", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, ""), ErrTokenExpired, "expired"},
+		{"not yet valid", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"nbf": time.Now().Add(time.Hour).Unix()}, ""), ErrTokenNotYetValid, "not_yet_valid"},
+		{"bad signature", sign(jwt.SigningMethodHS256, []byte("other"), nil, ""), ErrTokenSignature, "bad_signature"},
+		{"unknown kid", sign(jwt.SigningMethodHS256, secret, nil, "gone"), ErrUnknownKeyID, "bad_signature"},
+		{"wrong audience", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"aud": "x"}, ""), ErrTokenAudience, "wrong_audience"},
+		{"wrong issuer", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"iss": "x"}, ""), ErrTokenIssuer, "wrong_issuer"},
+		{"alg not allowed", sign(jwt.SigningMethodHS512, secret, nil, ""), ErrTokenAlgorithm, "unsupported_alg"},
+		{"alg none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, nil, ""), ErrTokenAlgorithm, "unsupported_alg"},
+		{"alg unknown", unknownAlg, ErrTokenAlgorithm, "unsupported_alg"},
+		{"malformed", "a.b", ErrTokenMalformed, "malformed"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.want) || !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if got := VerifyErrorReason(err); got != tt.reason {
+				t.Fatalf("reason=%q want %q", got, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyErrorReason(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrUnknownIssuer, "unknown_issuer"},
+		{ErrTokenRevoked, "revoked"},
+		{ErrRevocationUnavailable, "revocation_unavailable"},
+		{ErrJWKSUnavailable, "key_source_unavailable"},
+		{ErrMissingSubject, "missing_subject"},
+		{ErrMissingTenantID, "missing_tenant"},
+		{ErrInvalidAPIKey, "invalid_api_key"},
+		{ErrAPIKeyUnavailable, "api_key_unavailable"},
+		{ErrInvalidToken, "invalid"},
+	}
+	for _, tt := range tests {
+		if got := VerifyErrorReason(tt.err); got != tt.want {
+			t.Fatalf("%v: got %q want %q", tt.err, got, tt.want)
+		}
+	}
+}
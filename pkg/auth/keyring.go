@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyState is the lifecycle state of a keyring key.
+type KeyState int
+
+const (
+	// KeyActive signs new tokens and verifies. At most one key is active.
+	KeyActive KeyState = iota
+	// KeyVerifyOnly verifies but never signs: a new key being rolled out to verifiers,
+	// or an old key whose tokens have not expired yet.
+	KeyVerifyOnly
+	// KeyRetired is kept for bookkeeping only; tokens signed with it are rejected.
+	KeyRetired
+)
+
+func (s KeyState) String() string {
+	switch s {
+	case KeyActive:
+		return "active"
+	case KeyVerifyOnly:
+		return "verify"
+	case KeyRetired:
+		return "retired"
+	default:
+		return fmt.Sprintf("KeyState(%d)", int(s))
+	}
+}
+
+// ParseKeyState parses "active", "verify" (or "verify-only") and "retired".
+func ParseKeyState(s string) (KeyState, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "active":
+		return KeyActive, nil
+	case "verify", "verify-only", "verify_only":
+		return KeyVerifyOnly, nil
+	case "retired":
+		return KeyRetired, nil
+	default:
+		return 0, fmt.Errorf("auth: unknown key state %q", s)
+	}
+}
+
+// KeyringKey is a versioned key: its kid (ID), algorithm, key material and state.
+type KeyringKey struct {
+	SigningKey
+	State KeyState
+}
+
+type keyringSet struct {
+	keys   map[string]KeyringKey
+	order  []string // ids in configuration order
+	active *KeyringKey
+}
+
+// Keyring holds versioned HMAC secrets or signing keys for rotation. Use KeyFunc as
+// Verifier.KeyFunc, and set IssuerConfig.Keyring to sign with the active key.
+//
+// A rotation is: add the new key as verify-only everywhere, make it active (the old one
+// becomes verify-only), then retire the old key once its tokens have expired.
+// Keys can be replaced at runtime (Reload, Watch) without blocking verification.
+type Keyring struct {
+	p atomic.Pointer[keyringSet]
+}
+
+// NewKeyring validates keys and returns a keyring.
+func NewKeyring(keys ...KeyringKey) (*Keyring, error) {
+	k := &Keyring{}
+	if err := k.Reload(keys); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload validates and atomically swaps the keys. On error the previous keys stay in use.
+func (k *Keyring) Reload(keys []KeyringKey) error {
+	if len(keys) == 0 {
+		return errors.New("auth: keyring requires at least one key")
+	}
+
+	set := &keyringSet{keys: make(map[string]KeyringKey, len(keys))}
+	for _, key := range keys {
+		if key.State < KeyActive || key.State > KeyRetired {
+			return fmt.Errorf("auth: key %q has invalid state %d", key.ID, int(key.State))
+		}
+		if err := key.validate(); err != nil {
+			return err
+		}
+		if _, dup := set.keys[key.ID]; dup {
+			return fmt.Errorf("auth: duplicate key id %q", key.ID)
+		}
+		if key.State == KeyActive {
+			if set.active != nil {
+				return fmt.Errorf("auth: keyring has several active keys (%q, %q)", set.active.ID, key.ID)
+			}
+			active := key
+			set.active = &active
+		}
+		set.keys[key.ID] = key
+		set.order = append(set.order, key.ID)
+	}
+	k.p.Store(set)
+	return nil
+}
+
+// Active returns the signing key. It fails if no key is active (a verify-only keyring).
+func (k *Keyring) Active() (SigningKey, error) {
+	set := k.p.Load()
+	if set.active == nil {
+		return SigningKey{}, errors.New("auth: keyring has no active key")
+	}
+	return set.active.SigningKey, nil
+}
+
+// Keys returns all keys in configuration order.
+func (k *Keyring) Keys() []KeyringKey {
+	set := k.p.Load()
+	out := make([]KeyringKey, 0, len(set.order))
+	for _, id := range set.order {
+		out = append(out, set.keys[id])
+	}
+	return out
+}
+
+// Lookup returns the key with id if it can verify (active or verify-only).
+func (k *Keyring) Lookup(id string) (KeyringKey, bool) {
+	key, ok := k.p.Load().keys[id]
+	if !ok || key.State == KeyRetired {
+		return KeyringKey{}, false
+	}
+	return key, true
+}
+
+// KeyFunc implements jwt.Keyfunc. Keys are selected by the "kid" header; active and
+// verify-only keys verify, retired and unknown keys fail with ErrUnknownKeyID.
+// A token without "kid" is accepted only when exactly one key can verify.
+func (k *Keyring) KeyFunc(t *jwt.Token) (any, error) {
+	set := k.p.Load()
+	kid, _ := t.Header["kid"].(string)
+
+	key, ok := set.keys[kid]
+	if kid == "" {
+		ok = false
+		for _, id := range set.order {
+			if set.keys[id].State == KeyRetired {
+				continue
+			}
+			if ok {
+				return nil, ErrUnknownKeyID
+			}
+			key, ok = set.keys[id], true
+		}
+	}
+	if !ok || key.State == KeyRetired {
+		return nil, ErrUnknownKeyID
+	}
+	if t.Method == nil || t.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnknownKeyID
+	}
+	return key.verificationKey(), nil
+}
+
+// Methods returns the algorithms of keys that can verify, suitable for
+// VerifyConfig.AllowedMethods.
+func (k *Keyring) Methods() []string {
+	var out []string
+	for _, key := range k.Keys() {
+		if key.State == KeyRetired {
+			continue
+		}
+		if alg := key.Method.Alg(); !slices.Contains(out, alg) {
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// ParseKeyringSpec parses keys from a single configuration value, e.g. an environment
+// variable: comma-separated "kid:state:secret" entries with base64-encoded HMAC secrets
+// (HS256), e.g. "2024-06:active:c2Vj...,2024-01:verify:b2xk...". Retired entries may
+// omit the secret.
+func ParseKeyringSpec(spec string) ([]KeyringKey, error) {
+	var keys []KeyringKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("auth: keyring entry must be kid:state:secret, got %q", redactKeyEntry(entry))
+		}
+		state, err := ParseKeyState(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		key := KeyringKey{
+			SigningKey: SigningKey{ID: strings.TrimSpace(parts[0]), Method: jwt.SigningMethodHS256},
+			State:      state,
+		}
+		secret, err := decodeKeySecret(strings.TrimSpace(parts[2]))
+		if err != nil {
+			return nil, fmt.Errorf("auth: keyring key %q: secret is not base64", key.ID)
+		}
+		if len(secret) == 0 && state == KeyRetired {
+			// placeholder so that validation passes; retired keys never verify
+			secret = make([]byte, 32)
+		}
+		key.Key = secret
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// LoadKeyringEnv builds a keyring from the environment variable name (see ParseKeyringSpec).
+func LoadKeyringEnv(name string) (*Keyring, error) {
+	spec := os.Getenv(name)
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("auth: keyring env %s is empty", name)
+	}
+	keys, err := ParseKeyringSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(keys...)
+}
+
+// ReadKeyringDir reads keys from a mounted secrets directory with one file per key,
+// named "<kid>.<state>" (e.g. "2024-06.active", "2024-01.verify"). A file holding a PEM
+// private key (PKCS#8, PKCS#1 or SEC 1) becomes an RS256, ES256/384/512 or EdDSA key;
+// any other content is a raw HS256 secret (a trailing newline is ignored).
+// Hidden files (such as Kubernetes' "..data") are skipped.
+func ReadKeyringDir(dir string) ([]KeyringKey, error) {
+	keys, _, err := readKeyringDir(dir)
+	return keys, err
+}
+
+// readKeyringDir also returns a digest of the file names and contents, so Watch can
+// skip unchanged directories.
+func readKeyringDir(dir string) ([]KeyringKey, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, sum, fmt.Errorf("auth: read keyring dir: %w", err)
+	}
+
+	h := sha256.New()
+	var keys []KeyringKey
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || e.IsDir() {
+			continue
+		}
+		kid, stateName, ok := cutLast(name, ".")
+		if !ok || kid == "" {
+			return nil, sum, fmt.Errorf("auth: keyring file %q must be named <kid>.<state>", name)
+		}
+		state, err := ParseKeyState(stateName)
+		if err != nil {
+			return nil, sum, fmt.Errorf("auth: keyring file %q: %w", name, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, sum, fmt.Errorf("auth: read keyring file: %w", err)
+		}
+		key, err := parseKeyMaterial(kid, data)
+		if err != nil {
+			return nil, sum, err
+		}
+		keys = append(keys, KeyringKey{SigningKey: key, State: state})
+
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	copy(sum[:], h.Sum(nil))
+	return keys, sum, nil
+}
+
+// LoadKeyringDir builds a keyring from a secrets directory (see ReadKeyringDir).
+func LoadKeyringDir(dir string) (*Keyring, error) {
+	keys, err := ReadKeyringDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(keys...)
+}
+
+// Watch loads dir immediately, then polls it every interval and reloads the keyring when
+// its content changes. Invalid content is reported to onError (if non-nil) and the
+// previous keys stay in use. It blocks until ctx is done.
+func (k *Keyring) Watch(ctx context.Context, dir string, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	var last [sha256.Size]byte
+	reload := func() {
+		keys, sum, err := readKeyringDir(dir)
+		if err == nil {
+			if sum == last {
+				return
+			}
+			if err = k.Reload(keys); err == nil {
+				last = sum
+			}
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	// Load once up front, so changes made before Watch started are not missed.
+	reload()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			reload()
+		}
+	}
+}
+
+func parseKeyMaterial(kid string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{ID: kid, Method: jwt.SigningMethodHS256, Key: bytes.TrimRight(data, "\r\n")}, nil
+	}
+
+	var (
+		priv any
+		err  error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("auth: keyring key %q: parse private key: %w", kid, err)
+	}
+
+	switch p := priv.(type) {
+	case *rsa.PrivateKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Key: p}, nil
+	case *ecdsa.PrivateKey:
+		switch p.Curve.Params().BitSize {
+		case 256:
+			return SigningKey{ID: kid, Method: jwt.SigningMethodES256, Key: p}, nil
+		case 384:
+			return SigningKey{ID: kid, Method: jwt.SigningMethodES384, Key: p}, nil
+		case 521:
+			return SigningKey{ID: kid, Method: jwt.SigningMethodES512, Key: p}, nil
+		}
+	case ed25519.PrivateKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Key: p}, nil
+	}
+	return SigningKey{}, fmt.Errorf("auth: keyring key %q: unsupported key type %T", kid, priv)
+}
+
+func decodeKeySecret(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
+
+// redactKeyEntry keeps the kid of a malformed entry for error messages, never the secret.
+func redactKeyEntry(entry string) string {
+	kid, _, _ := strings.Cut(entry, ":")
+	return kid + ":..."
+}
+
+func cutLast(s, sep string) (before, after string, ok bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
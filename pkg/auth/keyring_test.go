@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func hmacKey(id string, state KeyState, secret string) KeyringKey {
+	return KeyringKey{
+		SigningKey: SigningKey{ID: id, Method: jwt.SigningMethodHS256, Key: []byte(secret)},
+		State:      state,
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	t.Parallel()
+
+	oldKey := hmacKey("k1", KeyActive, strings.Repeat("a", 32))
+	newKey := hmacKey("k2", KeyVerifyOnly, strings.Repeat("b", 32))
+
+	ring, err := NewKeyring(oldKey, newKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	iss, err := NewIssuer(IssuerConfig{Keyring: ring})
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	v := &Verifier{KeyFunc: ring.KeyFunc, Config: VerifyConfig{AllowedMethods: ring.Methods()}}
+	claims := Claims{TenantID: "t1", RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}}
+
+	signedOld, err := iss.Issue(claims)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// promote k2, keep k1 for verification
+	oldKey.State, newKey.State = KeyVerifyOnly, KeyActive
+	if err := ring.Reload([]KeyringKey{oldKey, newKey}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	signedNew, err := iss.Issue(claims)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if tok, _, _ := jwt.NewParser().ParseUnverified(signedNew, &Claims{}); tok.Header["kid"] != "k2" {
+		t.Fatalf("expected new tokens signed with k2, got %v", tok.Header["kid"])
+	}
+
+	for _, s := range []string{signedOld, signedNew} {
+		if _, err := v.Verify(s); err != nil {
+			t.Fatalf("verify during rotation: %v", err)
+		}
+	}
+
+	// retire k1
+	oldKey.State = KeyRetired
+	if err := ring.Reload([]KeyringKey{oldKey, newKey}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := v.Verify(signedOld); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected retired key rejected, got %v", err)
+	}
+	if _, err := v.Verify(signedNew); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// a verify-only keyring cannot sign
+	newKey.State = KeyVerifyOnly
+	if err := ring.Reload([]KeyringKey{newKey}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := iss.Issue(claims); err == nil {
+		t.Fatalf("expected error without active key")
+	}
+}
+
+func TestKeyring_KeyFunc(t *testing.T) {
+	t.Parallel()
+
+	secret := strings.Repeat("s", 32)
+	single, _ := NewKeyring(hmacKey("k1", KeyActive, secret), hmacKey("old", KeyRetired, strings.Repeat("o", 32)))
+	multi, _ := NewKeyring(hmacKey("k1", KeyActive, secret), hmacKey("k2", KeyVerifyOnly, strings.Repeat("b", 32)))
+
+	tests := []struct {
+		name   string
+		ring   *Keyring
+		method jwt.SigningMethod
+		kid    any
+		ok     bool
+	}{
+		{"by kid", multi, jwt.SigningMethodHS256, "k2", true},
+		{"unknown kid", multi, jwt.SigningMethodHS256, "k3", false},
+		{"retired kid", single, jwt.SigningMethodHS256, "old", false},
+		{"alg mismatch", multi, jwt.SigningMethodHS384, "k1", false},
+		{"no kid single verifying key", single, jwt.SigningMethodHS256, nil, true},
+		{"no kid ambiguous", multi, jwt.SigningMethodHS256, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := jwt.New(tt.method)
+			if tt.kid != nil {
+				tok.Header["kid"] = tt.kid
+			}
+			_, err := tt.ring.KeyFunc(tok)
+			if tt.ok != (err == nil) {
+				t.Fatalf("ok=%v, got %v", tt.ok, err)
+			}
+			if err != nil && !errors.Is(err, ErrUnknownKeyID) {
+				t.Fatalf("expected ErrUnknownKeyID, got %v", err)
+			}
+		})
+	}
+
+	if m := single.Methods(); len(m) != 1 || m[0] != "HS256" {
+		t.Fatalf("Methods()=%v", m)
+	}
+}
+
+func TestKeyring_ReloadValidation(t *testing.T) {
+	t.Parallel()
+
+	ring, err := NewKeyring(hmacKey("k1", KeyActive, strings.Repeat("a", 32)))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	bad := [][]KeyringKey{
+		nil,
+		{hmacKey("k1", KeyActive, "short")},
+		{hmacKey("k1", KeyActive, strings.Repeat("a", 32)), hmacKey("k2", KeyActive, strings.Repeat("b", 32))},
+		{hmacKey("k1", KeyVerifyOnly, strings.Repeat("a", 32)), hmacKey("k1", KeyVerifyOnly, strings.Repeat("b", 32))},
+		{hmacKey("k1", KeyState(7), strings.Repeat("a", 32))},
+	}
+	for i, keys := range bad {
+		if err := ring.Reload(keys); err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+	}
+	if k, err := ring.Active(); err != nil || k.ID != "k1" {
+		t.Fatalf("previous keys must stay in use, got %+v %v", k, err)
+	}
+
+	if _, err := NewIssuer(IssuerConfig{Keyring: ring, ActiveKeyID: "k1"}); err == nil {
+		t.Fatalf("expected error for Keys and Keyring together")
+	}
+}
+
+func TestParseKeyringSpec(t *testing.T) {
+	t.Parallel()
+
+	a := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	b := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+
+	keys, err := ParseKeyringSpec(" k2:active:" + a + ", k1:verify-only:" + b + ",k0:retired:")
+	if err != nil {
+		t.Fatalf("ParseKeyringSpec: %v", err)
+	}
+	if len(keys) != 3 || keys[0].ID != "k2" || keys[0].State != KeyActive || keys[1].State != KeyVerifyOnly ||
+		string(keys[1].Key.([]byte)) != strings.Repeat("b", 32) || keys[2].State != KeyRetired {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+	if _, err := NewKeyring(keys...); err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	for _, spec := range []string{"k1:active", "k1:pending:" + a, "k1:active:%%%"} {
+		_, err := ParseKeyringSpec(spec)
+		if err == nil {
+			t.Fatalf("%q: expected error", spec)
+		}
+		if strings.Contains(err.Error(), a) {
+			t.Fatalf("secret leaked in error: %v", err)
+		}
+	}
+}
+
+func TestLoadKeyringEnv(t *testing.T) {
+	a := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	t.Setenv("TEST_AUTH_KEYRING", "k1:active:"+a)
+
+	ring, err := LoadKeyringEnv("TEST_AUTH_KEYRING")
+	if err != nil {
+		t.Fatalf("LoadKeyringEnv: %v", err)
+	}
+	if k, _ := ring.Active(); k.ID != "k1" {
+		t.Fatalf("active=%q", k.ID)
+	}
+	if _, err := LoadKeyringEnv("TEST_AUTH_KEYRING_UNSET"); err == nil {
+		t.Fatalf("expected error for empty env")
+	}
+	t.Setenv("TEST_AUTH_KEYRING", "k1")
+	if _, err := LoadKeyringEnv("TEST_AUTH_KEYRING"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
+
+func TestKeyringDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+
+	write("2024-06.active", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))
+	write("2024-01.verify", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}))
+	write("hs.v1.retired", []byte(strings.Repeat("h", 32)+"\n"))
+	write("..data", []byte("ignored"))
+
+	ring, err := LoadKeyringDir(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyringDir: %v", err)
+	}
+	active, _ := ring.Active()
+	if active.ID != "2024-06" || active.Method != jwt.SigningMethodES256 {
+		t.Fatalf("unexpected active key %s %s", active.ID, active.Method.Alg())
+	}
+	keys := ring.Keys()
+	if len(keys) != 3 || keys[0].Method != jwt.SigningMethodEdDSA || keys[2].ID != "hs.v1" ||
+		len(keys[2].Key.([]byte)) != 32 {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	iss, err := NewIssuer(IssuerConfig{Keyring: ring})
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	set, err := iss.JWKS()
+	if err != nil || len(set.Keys) != 2 {
+		t.Fatalf("expected the two public keys, got %+v %v", set, err)
+	}
+
+	for name, data := range map[string][]byte{
+		"nokind":     []byte("x"),
+		"k.unknown":  []byte("x"),
+		"k.active":   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("junk")}),
+		".k.ignored": []byte("x"),
+	} {
+		bad := t.TempDir()
+		if err := os.WriteFile(filepath.Join(bad, name), data, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_, err := LoadKeyringDir(bad)
+		if name == ".k.ignored" {
+			if err == nil {
+				t.Fatalf("expected error for empty keyring")
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if _, err := LoadKeyringDir(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("expected error for missing dir")
+	}
+}
+
+func TestKeyring_Watch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, secret string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(secret), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write("k1.active", strings.Repeat("a", 32))
+
+	ring, err := LoadKeyringDir(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyringDir: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var errs atomic.Int32
+	go ring.Watch(ctx, dir, 5*time.Millisecond, func(error) { errs.Add(1) })
+
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// rotate: k2 becomes active, k1 verify-only
+	write("k2.active", strings.Repeat("b", 32))
+	_ = os.Rename(filepath.Join(dir, "k1.active"), filepath.Join(dir, "k1.verify"))
+	waitFor(func() bool { k, _ := ring.Active(); return k.ID == "k2" })
+
+	// an invalid change is reported and ignored
+	write("k3.active", strings.Repeat("c", 32))
+	waitFor(func() bool { return errs.Load() > 0 })
+	if k, _ := ring.Active(); k.ID != "k2" {
+		t.Fatalf("previous keys must stay in use, got %q", k.ID)
+	}
+}
+
+func TestKeyring_WatchLoadsImmediately(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, secret string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(secret), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write("k1.active", strings.Repeat("a", 32))
+	ring, err := LoadKeyringDir(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyringDir: %v", err)
+	}
+
+	// rotated between load and Watch: picked up without waiting for the first tick
+	write("k2.active", strings.Repeat("b", 32))
+	_ = os.Rename(filepath.Join(dir, "k1.active"), filepath.Join(dir, "k1.verify"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ring.Watch(ctx, dir, time.Hour, nil)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if k, _ := ring.Active(); k.ID == "k2" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("keyring not reloaded before the first interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a size-bounded, least-recently-used cache with per-entry expiry.
+// Expiry is only recorded; callers decide whether an expired entry is still usable.
+type lru[V any] struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key       string
+	val       V
+	expiresAt time.Time
+}
+
+func newLRU[V any](maxEntries int) *lru[V] {
+	return &lru[V]{max: maxEntries, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lru[V]) get(key string) (V, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, time.Time{}, false
+	}
+	c.ll.MoveToFront(el)
+	e := el.Value.(*lruEntry[V])
+	return e.val, e.expiresAt, true
+}
+
+func (c *lru[V]) set(key string, val V, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry[V])
+		e.val, e.expiresAt = val, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry[V]{key: key, val: val, expiresAt: expiresAt})
+	for c.ll.Len() > c.max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+func (c *lru[V]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru[V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = map[string]*list.Element{}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Membership grants the subject access to one tenant (workspace), optionally with
+// tenant-specific roles and scopes. Tokens for users in several tenants carry them in
+// the "memberships" claim; middleware.Tenant selects one per request.
+type Membership struct {
+	TenantID string   `json:"tenant_id"`
+	Roles    []string `json:"roles,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// Membership returns the membership for tenantID. A token without memberships is a
+// member of its TenantID only, with the token scopes.
+func (c *Claims) Membership(tenantID string) (Membership, bool) {
+	if tenantID == "" {
+		return Membership{}, false
+	}
+	if len(c.Memberships) == 0 {
+		if tenantID != c.TenantID {
+			return Membership{}, false
+		}
+		return Membership{TenantID: c.TenantID, Scopes: slices.Clone(c.Scopes)}, true
+	}
+	for _, m := range c.Memberships {
+		if m.TenantID == tenantID {
+			m.Roles = slices.Clone(m.Roles)
+			m.Scopes = slices.Clone(m.Scopes)
+			return m, true
+		}
+	}
+	return Membership{}, false
+}
+
+// hasTenant reports whether claims name a tenant: a default tenant_id or at least
+// one membership.
+func (c *Claims) hasTenant() bool {
+	if strings.TrimSpace(c.TenantID) != "" {
+		return true
+	}
+	for _, m := range c.Memberships {
+		if strings.TrimSpace(m.TenantID) != "" {
+			return true
+		}
+	}
+	return false
+}
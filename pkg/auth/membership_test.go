@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestClaims_Membership(t *testing.T) {
+	t.Parallel()
+
+	multi := &Claims{
+		TenantID: "t1",
+		Scopes:   []string{"profile:read"},
+		Memberships: []Membership{
+			{TenantID: "t1", Roles: []string{"owner"}},
+			{TenantID: "t2", Roles: []string{"viewer"}, Scopes: []string{"orders:read"}},
+		},
+	}
+	single := &Claims{TenantID: "t1", Scopes: []string{"orders:*"}}
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		tenant string
+		ok     bool
+		roles  int
+		scopes int
+	}{
+		{"member default", multi, "t1", true, 1, 0},
+		{"member other", multi, "t2", true, 1, 1},
+		{"not a member", multi, "t3", false, 0, 0},
+		{"empty tenant", multi, "", false, 0, 0},
+		{"single tenant", single, "t1", true, 0, 1},
+		{"single tenant other", single, "t2", false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := tt.claims.Membership(tt.tenant)
+			if ok != tt.ok || len(m.Roles) != tt.roles || len(m.Scopes) != tt.scopes {
+				t.Fatalf("Membership(%q)=%+v, %v", tt.tenant, m, ok)
+			}
+		})
+	}
+
+	m, _ := multi.Membership("t2")
+	m.Scopes[0] = "x"
+	if multi.Memberships[1].Scopes[0] != "orders:read" {
+		t.Fatalf("Membership must return a copy")
+	}
+}
+
+func TestVerifier_MembershipsWithoutTenant(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	v := &Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+	sign := func(c Claims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	claims, err := v.Verify(sign(Claims{
+		Memberships:      []Membership{{TenantID: "t2", Roles: []string{"admin"}}},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(claims.Memberships) != 1 || claims.Memberships[0].Roles[0] != "admin" {
+		t.Fatalf("unexpected memberships: %+v", claims.Memberships)
+	}
+
+	_, err = v.Verify(sign(Claims{
+		Memberships:      []Membership{{TenantID: " "}},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+	}))
+	if !errors.Is(err, ErrMissingTenantID) {
+		t.Fatalf("expected ErrMissingTenantID, got %v", err)
+	}
+}
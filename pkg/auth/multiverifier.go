@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownIssuer indicates the token's "iss" is not configured on a MultiVerifier.
+// It wraps ErrInvalidToken.
+var ErrUnknownIssuer = fmt.Errorf("%w: unknown issuer", ErrInvalidToken)
+
+// MultiVerifier routes tokens to a per-issuer Verifier by the "iss" claim.
+//
+// The issuer is read from the unverified payload only to select the configuration;
+// the selected Verifier then checks the signature and enforces the same issuer.
+type MultiVerifier struct {
+	issuers map[string]Verifier
+}
+
+// NewMultiVerifier builds a MultiVerifier keyed by each verifier's Config.Issuer.
+// Every verifier needs a KeyFunc and a unique, non-empty Issuer; RequireIssuer is forced on.
+func NewMultiVerifier(verifiers ...Verifier) (*MultiVerifier, error) {
+	if len(verifiers) == 0 {
+		return nil, errors.New("auth: multi verifier requires at least one issuer")
+	}
+
+	m := &MultiVerifier{issuers: make(map[string]Verifier, len(verifiers))}
+	for _, v := range verifiers {
+		iss := strings.TrimSpace(v.Config.Issuer)
+		if iss == "" {
+			return nil, errors.New("auth: multi verifier requires Config.Issuer on every verifier")
+		}
+		if v.KeyFunc == nil {
+			return nil, fmt.Errorf("auth: issuer %q: %w", iss, ErrMissingKeyFunc)
+		}
+		if _, dup := m.issuers[iss]; dup {
+			return nil, fmt.Errorf("auth: duplicate issuer %q", iss)
+		}
+		v.Config.Issuer = iss
+		v.Config.RequireIssuer = true
+		m.issuers[iss] = v
+	}
+	return m, nil
+}
+
+// VerifyContext implements TokenVerifier.
+func (m *MultiVerifier) VerifyContext(ctx context.Context, token string) (*Claims, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var peek jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &peek); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	v, ok := m.issuers[peek.Issuer]
+	if !ok {
+		return nil, ErrUnknownIssuer
+	}
+	return v.VerifyContext(ctx, token)
+}
+
+// Verify is VerifyContext with context.Background().
+func (m *MultiVerifier) Verify(token string) (*Claims, error) {
+	return m.VerifyContext(context.Background(), token)
+}
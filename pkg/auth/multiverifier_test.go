@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMultiVerifier(t *testing.T) {
+	t.Parallel()
+
+	ownSecret := []byte("0123456789abcdef0123456789abcdef")
+	idpKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+
+	mv, err := NewMultiVerifier(
+		Verifier{
+			KeyFunc: func(*jwt.Token) (any, error) { return ownSecret, nil },
+			Config:  VerifyConfig{Issuer: "https://id.example.com", AllowedMethods: []string{"HS256"}},
+		},
+		Verifier{
+			KeyFunc: func(*jwt.Token) (any, error) { return &idpKey.PublicKey, nil },
+			Config: VerifyConfig{
+				Issuer:          "https://idp.customer.com",
+				AllowedMethods:  []string{"ES256"},
+				Audience:        "saas-api",
+				RequireAudience: true,
+				Leeway:          time.Minute,
+				Claims:          ClaimMapping{TenantID: "https://customer.com/org", Scopes: "scp"},
+			},
+		},
+		Verifier{
+			KeyFunc: func(*jwt.Token) (any, error) { return &idpKey.PublicKey, nil },
+			Config: VerifyConfig{
+				Issuer:         "https://fixed.customer.com",
+				AllowedMethods: []string{"ES256"},
+				Claims:         ClaimMapping{FixedTenantID: "t-fixed", Scopes: "ext.perms"},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewMultiVerifier: %v", err)
+	}
+
+	sign := func(method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = time.Now().Add(time.Hour).Unix()
+		}
+		s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		tenant  string
+		scopes  []string
+		wantErr error
+	}{
+		{
+			name:   "own issuer",
+			token:  sign(jwt.SigningMethodHS256, ownSecret, jwt.MapClaims{"iss": "https://id.example.com", "sub": "u1", "tenant_id": "t1", "scopes": []string{"a"}}),
+			tenant: "t1", scopes: []string{"a"},
+		},
+		{
+			name:   "customer idp with mapped claims",
+			token:  sign(jwt.SigningMethodES256, idpKey, jwt.MapClaims{"iss": "https://idp.customer.com", "aud": "saas-api", "sub": "u2", "https://customer.com/org": "t2", "scp": "orders:read orders:write"}),
+			tenant: "t2", scopes: []string{"orders:read", "orders:write"},
+		},
+		{
+			name:   "leeway is per issuer",
+			token:  sign(jwt.SigningMethodES256, idpKey, jwt.MapClaims{"iss": "https://idp.customer.com", "aud": "saas-api", "sub": "u2", "https://customer.com/org": "t2", "exp": time.Now().Add(-30 * time.Second).Unix()}),
+			tenant: "t2",
+		},
+		{
+			name:   "fixed tenant ignores token tenant",
+			token:  sign(jwt.SigningMethodES256, idpKey, jwt.MapClaims{"iss": "https://fixed.customer.com", "sub": "u3", "tenant_id": "t-other", "ext": map[string]any{"perms": []string{"x"}}}),
+			tenant: "t-fixed", scopes: []string{"x"},
+		},
+		{
+			name:    "unknown issuer",
+			token:   sign(jwt.SigningMethodHS256, ownSecret, jwt.MapClaims{"iss": "https://evil.example.com", "sub": "u1", "tenant_id": "t1"}),
+			wantErr: ErrUnknownIssuer,
+		},
+		{
+			name:    "missing issuer",
+			token:   sign(jwt.SigningMethodHS256, ownSecret, jwt.MapClaims{"sub": "u1", "tenant_id": "t1"}),
+			wantErr: ErrUnknownIssuer,
+		},
+		{
+			name:    "customer idp cannot use hmac",
+			token:   sign(jwt.SigningMethodHS256, ownSecret, jwt.MapClaims{"iss": "https://idp.customer.com", "aud": "saas-api", "sub": "u1", "https://customer.com/org": "t1"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "audience per issuer",
+			token:   sign(jwt.SigningMethodES256, idpKey, jwt.MapClaims{"iss": "https://idp.customer.com", "aud": "other", "sub": "u2", "https://customer.com/org": "t2"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "mapped tenant missing",
+			token:   sign(jwt.SigningMethodES256, idpKey, jwt.MapClaims{"iss": "https://idp.customer.com", "aud": "saas-api", "sub": "u2", "tenant_id": "t2"}),
+			wantErr: ErrMissingTenantID,
+		},
+		{
+			name:    "garbage",
+			token:   "not.a.jwt",
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			claims, err := mv.VerifyContext(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if claims.TenantID != tt.tenant {
+				t.Fatalf("tenant=%q want %q", claims.TenantID, tt.tenant)
+			}
+			if len(claims.Scopes) != len(tt.scopes) {
+				t.Fatalf("scopes=%v want %v", claims.Scopes, tt.scopes)
+			}
+			for i := range tt.scopes {
+				if claims.Scopes[i] != tt.scopes[i] {
+					t.Fatalf("scopes=%v want %v", claims.Scopes, tt.scopes)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMultiVerifier_Errors(t *testing.T) {
+	t.Parallel()
+
+	kf := func(*jwt.Token) (any, error) { return nil, nil }
+	tests := []struct {
+		name string
+		in   []Verifier
+	}{
+		{"empty", nil},
+		{"no issuer", []Verifier{{KeyFunc: kf}}},
+		{"no keyfunc", []Verifier{{Config: VerifyConfig{Issuer: "a"}}}},
+		{"duplicate", []Verifier{{KeyFunc: kf, Config: VerifyConfig{Issuer: "a"}}, {KeyFunc: kf, Config: VerifyConfig{Issuer: " a "}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewMultiVerifier(tt.in...); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestLookupClaim(t *testing.T) {
+	t.Parallel()
+
+	raw := map[string]any{
+		"https://x.com/tenant": "t1",
+		"org":                  map[string]any{"id": "t2"},
+		"flat":                 "v",
+	}
+	tests := []struct {
+		name string
+		want any
+	}{
+		{"https://x.com/tenant", "t1"},
+		{"org.id", "t2"},
+		{"flat", "v"},
+		{"flat.sub", nil},
+		{"org.missing", nil},
+	}
+	for _, tt := range tests {
+		if got := lookupClaim(raw, tt.name); got != tt.want {
+			t.Fatalf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxTokenResponse bounds token endpoint responses.
+const maxTokenResponse = 1 << 20
+
+// ErrTokenEndpoint indicates the token endpoint could not be reached or answered garbage.
+var ErrTokenEndpoint = errors.New("auth: token endpoint unavailable")
+
+// OAuthError is an error response from an OAuth 2.0 token endpoint (RFC 6749 section 5.2).
+type OAuthError struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("auth: token endpoint: %s: %s", e.Code, e.Description)
+	}
+	return "auth: token endpoint: " + e.Code
+}
+
+// Token is a successful token endpoint response.
+type Token struct {
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	ExpiresIn       int64  `json:"expires_in,omitempty"`
+
+	// Expiry is computed from ExpiresIn when the response is received. Zero if unknown.
+	Expiry time.Time `json:"-"`
+}
+
+// Scopes returns the granted scopes (the space-separated "scope" field).
+func (t *Token) Scopes() []string {
+	return strings.Fields(t.Scope)
+}
+
+// tokenEndpoint posts grant requests with client_secret_basic authentication.
+type tokenEndpoint struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	now          func() time.Time
+}
+
+func (e *tokenEndpoint) request(ctx context.Context, form url.Values) (*Token, error) {
+	body, err := e.post(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+
+	var tok Token
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("%w: decode response: %v", ErrTokenEndpoint, err)
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("%w: response has no access_token", ErrTokenEndpoint)
+	}
+	if tok.ExpiresIn > 0 {
+		tok.Expiry = e.now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+	return &tok, nil
+}
+
+// post sends form and returns the body of a 200 response. Error responses become
+// *OAuthError when the server sent one, ErrTokenEndpoint otherwise.
+func (e *tokenEndpoint) post(ctx context.Context, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("auth: token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if e.clientID != "" {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before Basic encoding.
+		req.SetBasicAuth(url.QueryEscape(e.clientID), url.QueryEscape(e.clientSecret))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenEndpoint, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenResponse))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenEndpoint, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		oerr := &OAuthError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, oerr) == nil && oerr.Code != "" {
+			return nil, oerr
+		}
+		return nil, fmt.Errorf("%w: status %d", ErrTokenEndpoint, resp.StatusCode)
+	}
+	return body, nil
+}
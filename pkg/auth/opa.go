@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/httpx"
+	wslog "github.com/hanzy-dev/saas-ws-lib/pkg/log"
+)
+
+// ErrPolicyUnavailable indicates the policy decision point could not be consulted
+// (network error, timeout, non-200 status or malformed response).
+var ErrPolicyUnavailable = errors.New("auth: policy decision point unavailable")
+
+// maxPolicyResponse bounds decision responses.
+const maxPolicyResponse = 1 << 20
+
+// OPAConfig configures an OPAPolicy.
+type OPAConfig struct {
+	// URL is the decision endpoint, e.g. "http://opa:8181/v1/data/httpapi/authz". Required.
+	URL string
+
+	// HTTPClient defaults to httpx.NewClient, which propagates request IDs and traces.
+	HTTPClient *http.Client
+
+	// Timeout bounds each decision call. Defaults to 500ms.
+	Timeout time.Duration
+
+	// FailOpen lists the actions allowed while the decision point is unavailable, e.g.
+	// read-only actions. An entry ending in '*' matches by prefix ("orders.read.*");
+	// "*" fails open for every action. All other actions fail closed with
+	// ErrPolicyUnavailable.
+	FailOpen []string
+
+	// Logger optionally logs every decision with its decision_id, and fail-open
+	// decisions with their cause.
+	Logger *wslog.Logger
+}
+
+// OPAPolicy is a PolicyChecker that asks an OPA-compatible decision point.
+//
+// It POSTs {"input": <PolicyRequest>} and accepts either a boolean "result" or a
+// "result" object with a boolean "allow". An undefined result denies.
+type OPAPolicy struct {
+	cfg OPAConfig
+}
+
+// NewOPAPolicy validates cfg and returns a checker.
+func NewOPAPolicy(cfg OPAConfig) (*OPAPolicy, error) {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, errors.New("auth: opa policy requires URL")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 500 * time.Millisecond
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = httpx.NewClient(httpx.ClientConfig{Timeout: cfg.Timeout})
+	}
+	return &OPAPolicy{cfg: cfg}, nil
+}
+
+// Check implements PolicyChecker.
+func (p *OPAPolicy) Check(ctx context.Context, req PolicyRequest) (Decision, error) {
+	dec, id, err := p.query(ctx, req)
+	if err != nil {
+		if p.failOpen(req.Action) {
+			if p.cfg.Logger != nil {
+				p.cfg.Logger.With(ctx).Warn("policy failed open",
+					"action", req.Action, "resource", req.Resource, "error", err.Error())
+			}
+			return DecisionAllow, nil
+		}
+		return DecisionDeny, err
+	}
+
+	if p.cfg.Logger != nil {
+		p.cfg.Logger.With(ctx).Info("policy decision",
+			"decision_id", id, "action", req.Action, "resource", req.Resource, "allow", dec.IsAllow())
+	}
+	return dec, nil
+}
+
+func (p *OPAPolicy) query(ctx context.Context, req PolicyRequest) (Decision, string, error) {
+	payload, err := json.Marshal(struct {
+		Input PolicyRequest `json:"input"`
+	}{req})
+	if err != nil {
+		return DecisionDeny, "", fmt.Errorf("auth: encode policy input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		return DecisionDeny, "", fmt.Errorf("auth: policy request: %w", err)
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("Accept", "application/json")
+
+	resp, err := p.cfg.HTTPClient.Do(hreq)
+	if err != nil {
+		return DecisionDeny, "", fmt.Errorf("%w: %v", ErrPolicyUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPolicyResponse))
+	if err != nil {
+		return DecisionDeny, "", fmt.Errorf("%w: %v", ErrPolicyUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return DecisionDeny, "", fmt.Errorf("%w: status %d", ErrPolicyUnavailable, resp.StatusCode)
+	}
+
+	var out struct {
+		Result     json.RawMessage `json:"result"`
+		DecisionID string          `json:"decision_id"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return DecisionDeny, "", fmt.Errorf("%w: %v", ErrPolicyUnavailable, err)
+	}
+
+	allow, err := parsePolicyResult(out.Result)
+	if err != nil {
+		return DecisionDeny, out.DecisionID, fmt.Errorf("%w: %v", ErrPolicyUnavailable, err)
+	}
+	if allow {
+		return DecisionAllow, out.DecisionID, nil
+	}
+	return DecisionDeny, out.DecisionID, nil
+}
+
+// parsePolicyResult reads true/false, {"allow": bool}, or an undefined result (deny).
+func parsePolicyResult(raw json.RawMessage) (bool, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false, nil
+	}
+	var allow bool
+	if err := json.Unmarshal(raw, &allow); err == nil {
+		return allow, nil
+	}
+	var obj struct {
+		Allow *bool `json:"allow"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return false, errors.New("result is neither a boolean nor an object")
+	}
+	return obj.Allow != nil && *obj.Allow, nil
+}
+
+func (p *OPAPolicy) failOpen(action string) bool {
+	for _, pattern := range p.cfg.FailOpen {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(action, prefix) {
+				return true
+			}
+		} else if pattern == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+	wslog "github.com/hanzy-dev/saas-ws-lib/pkg/log"
+)
+
+func TestOPAPolicy(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input map[string]any `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode input: %v", err)
+		}
+		if r.Header.Get("X-Request-ID") != "req-1" {
+			t.Errorf("request id not propagated: %q", r.Header.Get("X-Request-ID"))
+		}
+		in := body.Input
+		if in["subject_id"] != "u1" || in["tenant_id"] != "t1" {
+			t.Errorf("unexpected input: %v", in)
+		}
+
+		var resp string
+		switch in["action"] {
+		case "orders.read":
+			resp = `{"result":true,"decision_id":"d-1"}`
+		case "orders.list":
+			if in["resource_attributes"].(map[string]any)["owner_id"] != "u1" {
+				t.Errorf("missing resource attributes: %v", in)
+			}
+			resp = `{"result":{"allow":true,"reason":"owner"},"decision_id":"d-2"}`
+		case "orders.write":
+			resp = `{"result":false,"decision_id":"d-3"}`
+		case "orders.undefined":
+			resp = `{"decision_id":"d-4"}`
+		case "orders.bad-result":
+			resp = `{"result":"yes"}`
+		case "orders.slow", "reports.slow":
+			time.Sleep(200 * time.Millisecond)
+			resp = `{"result":true}`
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(resp))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	p, err := NewOPAPolicy(OPAConfig{
+		URL:      srv.URL,
+		Timeout:  50 * time.Millisecond,
+		FailOpen: []string{"reports.*"},
+		Logger:   wslog.NewJSON(wslog.Options{Out: &logs}),
+	})
+	if err != nil {
+		t.Fatalf("NewOPAPolicy: %v", err)
+	}
+
+	tests := []struct {
+		action  string
+		want    Decision
+		wantErr bool
+	}{
+		{"orders.read", DecisionAllow, false},
+		{"orders.list", DecisionAllow, false},
+		{"orders.write", DecisionDeny, false},
+		{"orders.undefined", DecisionDeny, false},
+		{"orders.bad-result", DecisionDeny, true},
+		{"orders.broken", DecisionDeny, true},
+		{"orders.slow", DecisionDeny, true},
+		{"reports.broken", DecisionAllow, false},
+		{"reports.slow", DecisionAllow, false},
+	}
+
+	ctx := wsctx.WithRequestID(context.Background(), "req-1")
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			dec, err := p.Check(ctx, PolicyRequest{
+				SubjectID:          "u1",
+				TenantID:           "t1",
+				Action:             tt.action,
+				Resource:           "orders",
+				ResourceAttributes: map[string]any{"owner_id": "u1"},
+			})
+			if dec != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, dec)
+			}
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("wantErr=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrPolicyUnavailable) {
+				t.Fatalf("expected ErrPolicyUnavailable, got %v", err)
+			}
+		})
+	}
+
+	out := logs.String()
+	for _, want := range []string{`"decision_id":"d-1"`, `"decision_id":"d-3"`, `"msg":"policy failed open"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in logs: %s", want, out)
+		}
+	}
+}
+
+func TestNewOPAPolicy_RequiresURL(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewOPAPolicy(OPAConfig{URL: " "}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+)
+
+var (
+	// ErrPasswordMismatch indicates the password does not match the stored hash.
+	ErrPasswordMismatch = errors.New("auth: password mismatch")
+
+	// ErrInvalidPasswordHash indicates the stored hash is malformed or uses an unknown scheme.
+	ErrInvalidPasswordHash = errors.New("auth: invalid password hash")
+)
+
+// Upper bounds for argon2id parameters, in configs and stored hashes alike, so a tampered
+// hash cannot make Verify exhaust memory or CPU. The memory cap admits the RFC 9106 first
+// recommendation (2 GiB).
+const (
+	maxArgon2Memory      = 2 * 1024 * 1024 // KiB
+	maxArgon2Iterations  = 64
+	maxArgon2Parallelism = 64
+)
+
+// PasswordConfig controls PasswordHasher. Zero fields use the defaults, which follow the
+// RFC 9106 recommendation for memory-constrained environments.
+type PasswordConfig struct {
+	// Argon2id parameters: Memory in KiB (default 64 MiB, at most 2 GiB), Iterations
+	// (default 3, at most 64), Parallelism (default 4, at most 64).
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+
+	// SaltLength and KeyLength in bytes. Default 16 and 32.
+	SaltLength uint32
+	KeyLength  uint32
+
+	// MinLength and MaxLength bound passwords in characters. Default 8 and 256.
+	// MinLength only applies to new passwords, so older short passwords still verify.
+	MinLength int
+	MaxLength int
+}
+
+// PasswordHasher hashes passwords with argon2id into PHC strings, e.g.
+// "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>", and verifies argon2id and legacy
+// bcrypt hashes.
+type PasswordHasher struct {
+	cfg PasswordConfig
+}
+
+// NewPasswordHasher validates cfg and returns a hasher.
+func NewPasswordHasher(cfg PasswordConfig) (*PasswordHasher, error) {
+	if cfg.Memory == 0 {
+		cfg.Memory = 64 * 1024
+	}
+	if cfg.Iterations == 0 {
+		cfg.Iterations = 3
+	}
+	if cfg.Parallelism == 0 {
+		cfg.Parallelism = 4
+	}
+	if cfg.SaltLength == 0 {
+		cfg.SaltLength = 16
+	}
+	if cfg.KeyLength == 0 {
+		cfg.KeyLength = 32
+	}
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = 8
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = 256
+	}
+
+	if cfg.Memory < 8*uint32(cfg.Parallelism) {
+		return nil, errors.New("auth: password Memory must be at least 8 KiB per thread")
+	}
+	if cfg.Memory > maxArgon2Memory || cfg.Iterations > maxArgon2Iterations || cfg.Parallelism > maxArgon2Parallelism {
+		return nil, errors.New("auth: password Memory, Iterations or Parallelism too large")
+	}
+	if cfg.SaltLength < 8 || cfg.KeyLength < 16 {
+		return nil, errors.New("auth: password SaltLength must be >= 8 and KeyLength >= 16")
+	}
+	if cfg.MinLength > cfg.MaxLength {
+		return nil, errors.New("auth: password MinLength exceeds MaxLength")
+	}
+	return &PasswordHasher{cfg: cfg}, nil
+}
+
+// Hash returns the PHC-encoded argon2id hash of password.
+// Passwords outside the length limits return a *wserr.Error (INVALID_ARGUMENT).
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if n := utf8.RuneCountInString(password); n < h.cfg.MinLength {
+		return "", wserr.New(wserr.CodeInvalidArgument,
+			fmt.Sprintf("password must be at least %d characters", h.cfg.MinLength),
+			map[string]any{"field": "password", "min_length": h.cfg.MinLength})
+	}
+	if err := h.checkMax(password); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, h.cfg.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("auth: generate salt: %w", err)
+	}
+	p := argon2Params{
+		memory:      h.cfg.Memory,
+		iterations:  h.cfg.Iterations,
+		parallelism: h.cfg.Parallelism,
+		salt:        salt,
+	}
+	p.key = p.derive(password, h.cfg.KeyLength)
+	return p.encode(), nil
+}
+
+// Verify checks password against an encoded argon2id or bcrypt hash in constant time.
+// It returns ErrPasswordMismatch or ErrInvalidPasswordHash on failure. On success,
+// rehash reports that the hash should be replaced with Hash(password), e.g. for bcrypt
+// hashes or outdated argon2id parameters.
+func (h *PasswordHasher) Verify(password, encoded string) (rehash bool, err error) {
+	if err := h.checkMax(password); err != nil {
+		return false, err
+	}
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, err := parseArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare(p.derive(password, uint32(len(p.key))), p.key) != 1 {
+			return false, ErrPasswordMismatch
+		}
+		return h.outdated(p), nil
+
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrPasswordMismatch
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrInvalidPasswordHash, err)
+		}
+		return true, nil
+
+	default:
+		return false, ErrInvalidPasswordHash
+	}
+}
+
+// NeedsRehash reports whether encoded is not an argon2id hash with the current parameters.
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	return err != nil || h.outdated(p)
+}
+
+func (h *PasswordHasher) checkMax(password string) error {
+	if utf8.RuneCountInString(password) > h.cfg.MaxLength {
+		return wserr.New(wserr.CodeInvalidArgument,
+			fmt.Sprintf("password must be at most %d characters", h.cfg.MaxLength),
+			map[string]any{"field": "password", "max_length": h.cfg.MaxLength})
+	}
+	return nil
+}
+
+func (h *PasswordHasher) outdated(p argon2Params) bool {
+	return p.memory != h.cfg.Memory ||
+		p.iterations != h.cfg.Iterations ||
+		p.parallelism != h.cfg.Parallelism ||
+		uint32(len(p.salt)) != h.cfg.SaltLength ||
+		uint32(len(p.key)) != h.cfg.KeyLength
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (p argon2Params) derive(password string, keyLen uint32) []byte {
+	return argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, keyLen)
+}
+
+func (p argon2Params) encode() string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(p.salt),
+		base64.RawStdEncoding.EncodeToString(p.key),
+	)
+}
+
+func parseArgon2id(encoded string) (argon2Params, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return argon2Params{}, ErrInvalidPasswordHash
+	}
+
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return argon2Params{}, ErrInvalidPasswordHash
+	}
+
+	// Sscanf ignores trailing input: require the canonical encoding instead
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil ||
+		parts[3] != fmt.Sprintf("m=%d,t=%d,p=%d", p.memory, p.iterations, p.parallelism) {
+		return argon2Params{}, ErrInvalidPasswordHash
+	}
+	if p.iterations == 0 || p.parallelism == 0 || p.memory < 8*uint32(p.parallelism) ||
+		p.memory > maxArgon2Memory || p.iterations > maxArgon2Iterations || p.parallelism > maxArgon2Parallelism {
+		return argon2Params{}, ErrInvalidPasswordHash
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(p.salt) == 0 {
+		return argon2Params{}, ErrInvalidPasswordHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return argon2Params{}, ErrInvalidPasswordHash
+	}
+	return p, nil
+}
+
+func isBcrypt(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+)
+
+// cheap parameters keep tests fast; defaults are covered by TestNewPasswordHasher.
+var testPasswordConfig = PasswordConfig{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestPasswordHasher_HashVerify(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewPasswordHasher(testPasswordConfig)
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+
+	encoded, err := h.Hash("correct horse battery")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected encoding %q", encoded)
+	}
+	if other, _ := h.Hash("correct horse battery"); other == encoded {
+		t.Fatalf("expected random salt")
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("legacy password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	stronger, _ := NewPasswordHasher(PasswordConfig{Memory: 128, Iterations: 1, Parallelism: 1})
+
+	tests := []struct {
+		name     string
+		h        *PasswordHasher
+		password string
+		encoded  string
+		rehash   bool
+		err      error
+	}{
+		{"argon2id match", h, "correct horse battery", encoded, false, nil},
+		{"argon2id mismatch", h, "wrong horse battery", encoded, false, ErrPasswordMismatch},
+		{"argon2id outdated params", stronger, "correct horse battery", encoded, true, nil},
+		{"bcrypt match needs rehash", h, "legacy password", string(legacy), true, nil},
+		{"bcrypt mismatch", h, "legacy passwort", string(legacy), false, ErrPasswordMismatch},
+		{"bcrypt corrupt", h, "legacy password", "$2a$xx$", false, ErrInvalidPasswordHash},
+		{"unknown scheme", h, "x", "$scrypt$ln=16,r=8,p=1$aM15713r3Xsvxbi31lqr1Q$nFNh2CVHVjNldFVKDHDlm4CbdRSCdEBsjjJxD+iCs5E", false, ErrInvalidPasswordHash},
+		{"wrong version", h, "x", strings.Replace(encoded, "v=19", "v=16", 1), false, ErrInvalidPasswordHash},
+		{"bad params", h, "x", strings.Replace(encoded, "m=64,t=1,p=1", "m=64,t=0,p=1", 1), false, ErrInvalidPasswordHash},
+		{"truncated", h, "x", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", false, ErrInvalidPasswordHash},
+		{"bad salt", h, "x", "$argon2id$v=19$m=64,t=1,p=1$!!$aGFzaA", false, ErrInvalidPasswordHash},
+		// tampered parameters must fail before deriving a key
+		{"memory too large", h, "x", strings.Replace(encoded, "m=64,", "m=4194304,", 1), false, ErrInvalidPasswordHash},
+		{"iterations too large", h, "x", strings.Replace(encoded, "t=1,", "t=4294967295,", 1), false, ErrInvalidPasswordHash},
+		{"parallelism too large", h, "x", strings.Replace(encoded, "p=1$", "p=255$", 1), false, ErrInvalidPasswordHash},
+		{"trailing version bytes", h, "x", strings.Replace(encoded, "v=19", "v=19junk", 1), false, ErrInvalidPasswordHash},
+		{"trailing param bytes", h, "x", strings.Replace(encoded, "p=1$", "p=1,x=9$", 1), false, ErrInvalidPasswordHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := tt.h.Verify(tt.password, tt.encoded)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if rehash != tt.rehash {
+				t.Fatalf("rehash=%v want %v", rehash, tt.rehash)
+			}
+		})
+	}
+
+	if h.NeedsRehash(encoded) || !stronger.NeedsRehash(encoded) || !h.NeedsRehash(string(legacy)) {
+		t.Fatalf("unexpected NeedsRehash")
+	}
+}
+
+func TestPasswordHasher_LengthLimits(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewPasswordHasher(PasswordConfig{Memory: 64, Iterations: 1, Parallelism: 1, MinLength: 4, MaxLength: 10})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+	}{
+		{"too short", "abc", false},
+		{"min", "abcd", true},
+		{"multibyte counts characters", "ääääääääää", true},
+		{"too long", "abcdefghijk", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Hash(tt.password)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			e, ok := wserr.As(err)
+			if !ok || e.Code != wserr.CodeInvalidArgument {
+				t.Fatalf("expected INVALID_ARGUMENT, got %v", err)
+			}
+		})
+	}
+
+	// Verify skips MinLength (policy changes must not lock users out) but enforces MaxLength.
+	if _, err := h.Verify("abc", "$argon2id$"); !errors.Is(err, ErrInvalidPasswordHash) {
+		t.Fatalf("expected hash error, got %v", err)
+	}
+	if _, err := h.Verify(strings.Repeat("a", 11), "$argon2id$"); err == nil {
+		t.Fatalf("expected length error")
+	} else if e, ok := wserr.As(err); !ok || e.Code != wserr.CodeInvalidArgument {
+		t.Fatalf("expected INVALID_ARGUMENT, got %v", err)
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewPasswordHasher(PasswordConfig{})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+	if h.cfg.Memory != 64*1024 || h.cfg.Iterations != 3 || h.cfg.Parallelism != 4 ||
+		h.cfg.SaltLength != 16 || h.cfg.KeyLength != 32 || h.cfg.MinLength != 8 || h.cfg.MaxLength != 256 {
+		t.Fatalf("unexpected defaults: %+v", h.cfg)
+	}
+
+	for _, cfg := range []PasswordConfig{
+		{Memory: 8, Parallelism: 2},
+		{SaltLength: 4},
+		{KeyLength: 8},
+		{MinLength: 20, MaxLength: 10},
+		{Memory: maxArgon2Memory + 1},
+		{Iterations: maxArgon2Iterations + 1},
+		{Parallelism: maxArgon2Parallelism + 1},
+	} {
+		if _, err := NewPasswordHasher(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package auth
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Decision represents the result of a policy evaluation.
 type Decision int
@@ -17,13 +20,34 @@ func (d Decision) IsAllow() bool { return d == DecisionAllow }
 
 // PolicyRequest is a normalized policy check input.
 // Action/Resource should be stable strings, e.g. "tenant.members.invite", "orders.create".
+// The JSON form is the input document sent to remote checkers (see OPAPolicy).
 type PolicyRequest struct {
-	SubjectID string
-	TenantID  string
-	Scopes    []string
+	SubjectID string   `json:"subject_id"`
+	TenantID  string   `json:"tenant_id"`
+	Scopes    []string `json:"scopes"`
+
+	// Actors is the delegation chain acting on behalf of SubjectID, current actor first.
+	// Empty when the subject calls directly.
+	Actors []string `json:"actors,omitempty"`
+
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+
+	// ResourceAttributes optionally describes the target object for attribute-based rules,
+	// e.g. {"owner_id": "u1", "status": "open"}. Keep it small; it may be sent to a remote checker.
+	ResourceAttributes map[string]any `json:"resource_attributes,omitempty"`
+
+	// Request describes the inbound request being authorized.
+	Request RequestAttributes `json:"request"`
+}
 
-	Action   string
-	Resource string
+// RequestAttributes are request-level attributes available to policy rules.
+type RequestAttributes struct {
+	// IP is the client address as seen by the service (no proxy headers are trusted).
+	IP     string    `json:"ip,omitempty"`
+	Method string    `json:"method,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Time   time.Time `json:"time"`
 }
 
 // PolicyChecker is implemented by a service adapter (HTTP/gRPC) that knows how to
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// PolicyCacheConfig controls CachedPolicy.
+type PolicyCacheConfig struct {
+	// AllowTTL defaults to 30s. DenyTTL defaults to 5s; a negative DenyTTL disables caching denies.
+	AllowTTL time.Duration
+	DenyTTL  time.Duration
+
+	// MaxEntries bounds the cache (least recently used entries are evicted). Defaults to 10000.
+	MaxEntries int
+
+	// StaleOnError, if > 0, serves the last known decision for up to this long past its
+	// expiry when the underlying checker fails.
+	StaleOnError time.Duration
+
+	// Key derives the cache key; an empty key bypasses the cache. Defaults to subject,
+	// tenant, sorted scopes, actor chain, action, resource and the request IP, method
+	// and path, and bypasses the cache for requests with ResourceAttributes.
+	//
+	// Request.Time is never part of the default key: do not cache a checker whose
+	// decisions depend on the time (e.g. request.hour conditions), or supply a Key that
+	// returns "" for those requests.
+	Key func(req PolicyRequest) string
+}
+
+// CachedPolicy decorates a PolicyChecker with a bounded decision cache.
+// Concurrent checks for the same key share a single call to the underlying checker.
+type CachedPolicy struct {
+	next PolicyChecker
+	cfg  PolicyCacheConfig
+	now  func() time.Time
+
+	group singleflight.Group
+	cache *lru[Decision]
+}
+
+// NewCachedPolicy wraps next. Panics if next is nil.
+func NewCachedPolicy(next PolicyChecker, cfg PolicyCacheConfig) *CachedPolicy {
+	if next == nil {
+		panic("auth.NewCachedPolicy requires non-nil PolicyChecker")
+	}
+	if cfg.AllowTTL <= 0 {
+		cfg.AllowTTL = 30 * time.Second
+	}
+	if cfg.DenyTTL == 0 {
+		cfg.DenyTTL = 5 * time.Second
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	if cfg.Key == nil {
+		cfg.Key = defaultPolicyKey
+	}
+	return &CachedPolicy{
+		next:  next,
+		cfg:   cfg,
+		now:   time.Now,
+		cache: newLRU[Decision](cfg.MaxEntries),
+	}
+}
+
+// Check implements PolicyChecker.
+func (c *CachedPolicy) Check(ctx context.Context, req PolicyRequest) (Decision, error) {
+	key := c.cfg.Key(req)
+	if key == "" {
+		return c.next.Check(ctx, req)
+	}
+
+	if dec, ok := c.lookup(key, 0); ok {
+		return dec, nil
+	}
+
+	// The shared call must not be cancelled by whichever caller happened to start it.
+	ch := c.group.DoChan(key, func() (any, error) {
+		dec, err := c.next.Check(context.WithoutCancel(ctx), req)
+		if err != nil {
+			return DecisionDeny, err
+		}
+		c.store(key, dec)
+		return dec, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return DecisionDeny, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			if dec, ok := c.lookup(key, c.cfg.StaleOnError); ok {
+				return dec, nil
+			}
+			return DecisionDeny, res.Err
+		}
+		return res.Val.(Decision), nil
+	}
+}
+
+// Invalidate drops all cached decisions, e.g. after a policy change.
+func (c *CachedPolicy) Invalidate() {
+	c.cache.clear()
+}
+
+// lookup returns a cached decision that has not expired more than grace ago.
+func (c *CachedPolicy) lookup(key string, grace time.Duration) (Decision, bool) {
+	dec, exp, ok := c.cache.get(key)
+	if !ok {
+		return DecisionDeny, false
+	}
+	now := c.now()
+	if !now.Before(exp.Add(grace)) {
+		// Keep expired entries around while they may still serve stale.
+		if !now.Before(exp.Add(c.cfg.StaleOnError)) {
+			c.cache.remove(key)
+		}
+		return DecisionDeny, false
+	}
+	return dec, true
+}
+
+func (c *CachedPolicy) store(key string, dec Decision) {
+	ttl := c.cfg.AllowTTL
+	if !dec.IsAllow() {
+		ttl = c.cfg.DenyTTL
+	}
+	if ttl < 0 {
+		return
+	}
+	c.cache.set(key, dec, c.now().Add(ttl))
+}
+
+func defaultPolicyKey(req PolicyRequest) string {
+	// Decisions about a specific object are not shared between requests.
+	if len(req.ResourceAttributes) > 0 {
+		return ""
+	}
+	// A downscoped or delegated token must not reuse a decision made for the full token.
+	scopes := slices.Clone(req.Scopes)
+	slices.Sort(scopes)
+
+	// NUL and US cannot appear in well-formed identifiers, so the fields cannot collide.
+	// Request attributes are part of the key, as conditions may check them (cidr, method).
+	return strings.Join([]string{
+		req.SubjectID,
+		req.TenantID,
+		strings.Join(scopes, "\x1f"),
+		strings.Join(req.Actors, "\x1f"),
+		req.Action,
+		req.Resource,
+		req.Request.IP,
+		req.Request.Method,
+		req.Request.Path,
+	}, "\x00")
+}
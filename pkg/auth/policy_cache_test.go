@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingPolicy struct {
+	calls atomic.Int32
+	dec   atomic.Int32
+	fail  atomic.Bool
+	delay time.Duration
+}
+
+func (p *countingPolicy) Check(ctx context.Context, req PolicyRequest) (Decision, error) {
+	p.calls.Add(1)
+	if p.delay > 0 {
+		time.Sleep(p.delay)
+	}
+	if p.fail.Load() {
+		return DecisionDeny, errors.New("policy service down")
+	}
+	return Decision(p.dec.Load()), nil
+}
+
+func TestCachedPolicy_TTLs(t *testing.T) {
+	t.Parallel()
+
+	next := &countingPolicy{}
+	next.dec.Store(int32(DecisionAllow))
+	c := NewCachedPolicy(next, PolicyCacheConfig{AllowTTL: time.Minute, DenyTTL: time.Second})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	req := PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "a", Resource: "r"}
+	for i := 0; i < 3; i++ {
+		dec, err := c.Check(context.Background(), req)
+		if err != nil || !dec.IsAllow() {
+			t.Fatalf("dec=%v err=%v", dec, err)
+		}
+	}
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 call, got %d", got)
+	}
+
+	// different resource is a different key
+	if _, err := c.Check(context.Background(), PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "a", Resource: "r2"}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := next.calls.Load(); got != 2 {
+		t.Fatalf("expected 2 calls, got %d", got)
+	}
+
+	// allow expires after AllowTTL; deny is cached for DenyTTL only
+	now = now.Add(time.Minute)
+	next.dec.Store(int32(DecisionDeny))
+	if dec, _ := c.Check(context.Background(), req); dec.IsAllow() {
+		t.Fatalf("expected deny after allow ttl")
+	}
+	_, _ = c.Check(context.Background(), req)
+	if got := next.calls.Load(); got != 3 {
+		t.Fatalf("expected deny cached, got %d calls", got)
+	}
+	now = now.Add(time.Second)
+	_, _ = c.Check(context.Background(), req)
+	if got := next.calls.Load(); got != 4 {
+		t.Fatalf("expected deny expired, got %d calls", got)
+	}
+
+	c.Invalidate()
+	_, _ = c.Check(context.Background(), req)
+	if got := next.calls.Load(); got != 5 {
+		t.Fatalf("expected miss after Invalidate, got %d calls", got)
+	}
+}
+
+func TestCachedPolicy_KeyCoversScopesActorsAndAttributes(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	next := policyFunc(func(ctx context.Context, req PolicyRequest) (Decision, error) {
+		calls.Add(1)
+		if HasAll(req.Scopes, "orders:write") && len(req.Actors) == 0 {
+			return DecisionAllow, nil
+		}
+		return DecisionDeny, nil
+	})
+	c := NewCachedPolicy(next, PolicyCacheConfig{})
+
+	full := PolicyRequest{SubjectID: "u1", TenantID: "t1", Scopes: []string{"orders:write", "orders:read"}, Action: "a", Resource: "r"}
+	if dec, _ := c.Check(context.Background(), full); !dec.IsAllow() {
+		t.Fatalf("expected allow")
+	}
+
+	reordered := full
+	reordered.Scopes = []string{"orders:read", "orders:write"}
+	if dec, _ := c.Check(context.Background(), reordered); !dec.IsAllow() || calls.Load() != 1 {
+		t.Fatalf("expected cached allow for the same scopes, got %v after %d calls", dec, calls.Load())
+	}
+
+	downscoped := full
+	downscoped.Scopes = []string{"orders:read"}
+	if dec, _ := c.Check(context.Background(), downscoped); dec.IsAllow() {
+		t.Fatalf("downscoped token must not hit the cached allow")
+	}
+
+	delegated := full
+	delegated.Actors = []string{"svc-a"}
+	if dec, _ := c.Check(context.Background(), delegated); dec.IsAllow() {
+		t.Fatalf("delegated call must not hit the cached allow")
+	}
+
+	withAttrs := full
+	withAttrs.ResourceAttributes = map[string]any{"owner_id": "u2"}
+	before := calls.Load()
+	_, _ = c.Check(context.Background(), withAttrs)
+	_, _ = c.Check(context.Background(), withAttrs)
+	if got := calls.Load() - before; got != 2 {
+		t.Fatalf("expected attribute-based checks not cached, got %d calls", got)
+	}
+}
+
+func TestCachedPolicy_KeyCoversRequestAttributes(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseRBACPolicy([]byte(`
+roles:
+  office:
+    allow:
+      - action: "payouts.approve"
+        when: cidr(request.ip, "10.0.0.0/8")
+bindings:
+  - subject: "u1"
+    roles: [office]
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rbac, err := NewRBAC(p)
+	if err != nil {
+		t.Fatalf("NewRBAC: %v", err)
+	}
+	c := NewCachedPolicy(rbac, PolicyCacheConfig{})
+
+	inside := PolicyRequest{SubjectID: "u1", Action: "payouts.approve", Request: RequestAttributes{IP: "10.1.2.3"}}
+	outside := inside
+	outside.Request.IP = "203.0.113.7"
+
+	if dec, _ := c.Check(context.Background(), inside); !dec.IsAllow() {
+		t.Fatalf("expected allow inside the network")
+	}
+	if dec, _ := c.Check(context.Background(), outside); dec.IsAllow() {
+		t.Fatalf("request from another IP must not reuse the cached allow")
+	}
+}
+
+type policyFunc func(ctx context.Context, req PolicyRequest) (Decision, error)
+
+func (f policyFunc) Check(ctx context.Context, req PolicyRequest) (Decision, error) {
+	return f(ctx, req)
+}
+
+func TestCachedPolicy_DenyCachingDisabled(t *testing.T) {
+	t.Parallel()
+
+	next := &countingPolicy{}
+	c := NewCachedPolicy(next, PolicyCacheConfig{DenyTTL: -1})
+	req := PolicyRequest{SubjectID: "u1", Action: "a"}
+	_, _ = c.Check(context.Background(), req)
+	_, _ = c.Check(context.Background(), req)
+	if got := next.calls.Load(); got != 2 {
+		t.Fatalf("expected denies not cached, got %d calls", got)
+	}
+}
+
+func TestCachedPolicy_Singleflight(t *testing.T) {
+	t.Parallel()
+
+	next := &countingPolicy{delay: 50 * time.Millisecond}
+	next.dec.Store(int32(DecisionAllow))
+	c := NewCachedPolicy(next, PolicyCacheConfig{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dec, err := c.Check(context.Background(), PolicyRequest{SubjectID: "u1", Action: "a"})
+			if err != nil || !dec.IsAllow() {
+				t.Errorf("dec=%v err=%v", dec, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 shared call, got %d", got)
+	}
+}
+
+func TestCachedPolicy_CallerCancellation(t *testing.T) {
+	t.Parallel()
+
+	next := &countingPolicy{delay: 100 * time.Millisecond}
+	c := NewCachedPolicy(next, PolicyCacheConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Check(ctx, PolicyRequest{SubjectID: "u1", Action: "a"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestCachedPolicy_StaleOnError(t *testing.T) {
+	t.Parallel()
+
+	next := &countingPolicy{}
+	next.dec.Store(int32(DecisionAllow))
+	c := NewCachedPolicy(next, PolicyCacheConfig{AllowTTL: time.Second, StaleOnError: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	req := PolicyRequest{SubjectID: "u1", Action: "a"}
+	_, _ = c.Check(context.Background(), req)
+
+	next.fail.Store(true)
+	now = now.Add(30 * time.Second)
+	dec, err := c.Check(context.Background(), req)
+	if err != nil || !dec.IsAllow() {
+		t.Fatalf("expected stale allow, dec=%v err=%v", dec, err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.Check(context.Background(), req); err == nil {
+		t.Fatalf("expected error past grace window")
+	}
+}
+
+func TestCachedPolicy_MaxEntries(t *testing.T) {
+	t.Parallel()
+
+	next := &countingPolicy{}
+	next.dec.Store(int32(DecisionAllow))
+	c := NewCachedPolicy(next, PolicyCacheConfig{MaxEntries: 2})
+
+	check := func(res string) {
+		_, _ = c.Check(context.Background(), PolicyRequest{SubjectID: "u1", Action: "a", Resource: res})
+	}
+	check("r1")
+	check("r2")
+	check("r1") // r1 most recently used
+	check("r3") // evicts r2
+	if got := next.calls.Load(); got != 3 {
+		t.Fatalf("expected 3 calls, got %d", got)
+	}
+	check("r1")
+	if got := next.calls.Load(); got != 3 {
+		t.Fatalf("r1 should still be cached, got %d calls", got)
+	}
+	check("r2")
+	if got := next.calls.Load(); got != 4 {
+		t.Fatalf("r2 should have been evicted, got %d calls", got)
+	}
+}
+
+func TestNewCachedPolicy_NilPanics(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	NewCachedPolicy(nil, PolicyCacheConfig{})
+}
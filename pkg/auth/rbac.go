@@ -0,0 +1,410 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RBACPolicy is the declarative role/permission model loaded by RBAC.
+//
+// Example (YAML; JSON with the same field names is accepted too):
+//
+//	roles:
+//	  orders.viewer:
+//	    allow:
+//	      - action: "orders.read"
+//	  orders.admin:
+//	    inherits: [orders.viewer]
+//	    allow:
+//	      - action: "orders.*"
+//	        resource: "tenant:{tenant}:*"
+//	      - action: "orders.update"
+//	        when: resource.owner_id == subject.id && request.hour >= 9 && request.hour < 17
+//	    deny:
+//	      - action: "orders.delete"
+//	bindings:
+//	  - subject: "u1"
+//	    tenant: "t1"
+//	    roles: [orders.admin]
+type RBACPolicy struct {
+	Roles    map[string]RBACRole `json:"roles" yaml:"roles"`
+	Bindings []RBACBinding       `json:"bindings" yaml:"bindings"`
+
+	// Timezone is the IANA location used for request.hour/request.weekday in conditions.
+	// Defaults to the location of PolicyRequest.Request.Time.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+// RBACRole groups permissions. Deny rules override allow rules from any role.
+type RBACRole struct {
+	Inherits []string   `json:"inherits,omitempty" yaml:"inherits,omitempty"`
+	Allow    []RBACRule `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny     []RBACRule `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// RBACRule matches PolicyRequest.Action and PolicyRequest.Resource.
+//
+// Both are glob patterns where '*' matches any sequence of characters.
+// Empty Resource matches any resource. The placeholders {tenant} and {subject}
+// are replaced with the request's TenantID and SubjectID before matching; the values
+// match literally, so a '*' inside an ID is not a wildcard.
+//
+// When is an optional Condition; the rule only applies if it evaluates to true.
+// Conditions are compiled when the policy is loaded, so a typo fails the load.
+type RBACRule struct {
+	Action   string `json:"action" yaml:"action"`
+	Resource string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	When     string `json:"when,omitempty" yaml:"when,omitempty"`
+}
+
+// RBACBinding grants roles to a subject in a tenant. Empty Tenant or "*" applies to every tenant.
+type RBACBinding struct {
+	Subject string   `json:"subject" yaml:"subject"`
+	Tenant  string   `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	Roles   []string `json:"roles" yaml:"roles"`
+}
+
+// ParseRBACPolicy decodes a YAML or JSON policy document. Unknown fields are rejected.
+func ParseRBACPolicy(data []byte) (RBACPolicy, error) {
+	var p RBACPolicy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return RBACPolicy{}, fmt.Errorf("auth: parse rbac policy: %w", err)
+	}
+	return p, nil
+}
+
+type rbacRule struct {
+	RBACRule
+	cond *Condition
+}
+
+type rbacPermissions struct {
+	allow []rbacRule
+	deny  []rbacRule
+}
+
+type compiledRBAC struct {
+	// tenant -> subject -> effective permissions ("*" tenant applies everywhere)
+	bindings map[string]map[string][]*rbacPermissions
+	loc      *time.Location
+}
+
+// RBAC is a PolicyChecker backed by an RBACPolicy.
+// The policy can be replaced at runtime (Reload, Watch) without blocking Check.
+type RBAC struct {
+	p atomic.Pointer[compiledRBAC]
+}
+
+// NewRBAC validates policy and returns a ready checker.
+func NewRBAC(policy RBACPolicy) (*RBAC, error) {
+	r := &RBAC{}
+	if err := r.Reload(policy); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadRBACFile reads and compiles a policy file.
+func LoadRBACFile(path string) (*RBAC, error) {
+	p, err := readRBACFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRBAC(p)
+}
+
+// Reload validates and atomically swaps the policy. On error the previous policy stays active.
+func (r *RBAC) Reload(policy RBACPolicy) error {
+	c, err := compileRBAC(policy)
+	if err != nil {
+		return err
+	}
+	r.p.Store(c)
+	return nil
+}
+
+// Watch loads path immediately, then polls it every interval and reloads the policy when
+// the file content changes. Invalid files are reported to onError (if non-nil) and the
+// previous policy stays active. It blocks until ctx is done.
+func (r *RBAC) Watch(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	var last [sha256.Size]byte
+	reload := func() {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			sum := sha256.Sum256(data)
+			if sum == last {
+				return
+			}
+			last = sum
+
+			var p RBACPolicy
+			if p, err = ParseRBACPolicy(data); err == nil {
+				err = r.Reload(p)
+			}
+		} else {
+			err = fmt.Errorf("auth: read rbac policy: %w", err)
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	// Load once up front, so changes made before Watch started are not missed.
+	reload()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			reload()
+		}
+	}
+}
+
+// Check implements PolicyChecker. Deny rules override allow rules; no matching rule means deny.
+func (r *RBAC) Check(ctx context.Context, req PolicyRequest) (Decision, error) {
+	c := r.p.Load()
+	if c == nil {
+		return DecisionDeny, errors.New("auth: rbac policy not loaded")
+	}
+	if req.SubjectID == "" || req.Action == "" {
+		return DecisionDeny, nil
+	}
+	if c.loc != nil {
+		if req.Request.Time.IsZero() {
+			req.Request.Time = time.Now()
+		}
+		req.Request.Time = req.Request.Time.In(c.loc)
+	}
+
+	var perms []*rbacPermissions
+	for _, tenant := range []string{req.TenantID, "*"} {
+		if subjects, ok := c.bindings[tenant]; ok {
+			perms = append(perms, subjects[req.SubjectID]...)
+		}
+	}
+
+	allowed := false
+	for _, p := range perms {
+		for _, rule := range p.deny {
+			if rule.matches(req) {
+				return DecisionDeny, nil
+			}
+		}
+		if !allowed {
+			for _, rule := range p.allow {
+				if rule.matches(req) {
+					allowed = true
+					break
+				}
+			}
+		}
+	}
+	if allowed {
+		return DecisionAllow, nil
+	}
+	return DecisionDeny, nil
+}
+
+func (rule rbacRule) matches(req PolicyRequest) bool {
+	if !matchPattern(rule.Action, req, req.Action) {
+		return false
+	}
+	if rule.Resource != "" && !matchPattern(rule.Resource, req, req.Resource) {
+		return false
+	}
+	return rule.cond == nil || rule.cond.Eval(req)
+}
+
+// matchPattern matches s against pattern after expanding {tenant} and {subject}.
+func matchPattern(pattern string, req PolicyRequest, s string) bool {
+	if !strings.Contains(pattern, "{") {
+		return globMatch(pattern, s)
+	}
+	expanded, literal := expandPlaceholders(pattern, req)
+	return globMatchLiteral(expanded, literal, s)
+}
+
+// expandPlaceholders replaces {tenant} and {subject} in pattern. literal marks the bytes
+// that came from a placeholder value and must not act as wildcards.
+func expandPlaceholders(pattern string, req PolicyRequest) (expanded string, literal []bool) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); {
+		value, n := "", 0
+		switch {
+		case strings.HasPrefix(pattern[i:], "{tenant}"):
+			value, n = req.TenantID, len("{tenant}")
+		case strings.HasPrefix(pattern[i:], "{subject}"):
+			value, n = req.SubjectID, len("{subject}")
+		default:
+			b.WriteByte(pattern[i])
+			literal = append(literal, false)
+			i++
+			continue
+		}
+		b.WriteString(value)
+		for range len(value) {
+			literal = append(literal, true)
+		}
+		i += n
+	}
+	return b.String(), literal
+}
+
+func readRBACFile(path string) (RBACPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RBACPolicy{}, fmt.Errorf("auth: read rbac policy: %w", err)
+	}
+	return ParseRBACPolicy(data)
+}
+
+func compileRBAC(policy RBACPolicy) (*compiledRBAC, error) {
+	resolved := make(map[string]*rbacPermissions, len(policy.Roles))
+
+	var resolve func(name string, path []string) (*rbacPermissions, error)
+	resolve = func(name string, path []string) (*rbacPermissions, error) {
+		if p, ok := resolved[name]; ok {
+			return p, nil
+		}
+		for _, seen := range path {
+			if seen == name {
+				return nil, fmt.Errorf("auth: rbac role inheritance cycle: %s -> %s", strings.Join(path, " -> "), name)
+			}
+		}
+		role, ok := policy.Roles[name]
+		if !ok {
+			return nil, fmt.Errorf("auth: unknown rbac role %q", name)
+		}
+
+		p := &rbacPermissions{}
+		for _, parent := range role.Inherits {
+			pp, err := resolve(parent, append(path, name))
+			if err != nil {
+				return nil, err
+			}
+			p.allow = append(p.allow, pp.allow...)
+			p.deny = append(p.deny, pp.deny...)
+		}
+		for _, rule := range role.Allow {
+			r, err := compileRBACRule(name, rule)
+			if err != nil {
+				return nil, err
+			}
+			p.allow = append(p.allow, r)
+		}
+		for _, rule := range role.Deny {
+			r, err := compileRBACRule(name, rule)
+			if err != nil {
+				return nil, err
+			}
+			p.deny = append(p.deny, r)
+		}
+		resolved[name] = p
+		return p, nil
+	}
+
+	for name := range policy.Roles {
+		if strings.TrimSpace(name) == "" {
+			return nil, errors.New("auth: rbac role requires a name")
+		}
+		if _, err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &compiledRBAC{bindings: map[string]map[string][]*rbacPermissions{}}
+	if policy.Timezone != "" {
+		loc, err := time.LoadLocation(policy.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("auth: rbac timezone: %w", err)
+		}
+		c.loc = loc
+	}
+	for i, b := range policy.Bindings {
+		if strings.TrimSpace(b.Subject) == "" {
+			return nil, fmt.Errorf("auth: rbac binding %d requires subject", i)
+		}
+		tenant := b.Tenant
+		if tenant == "" {
+			tenant = "*"
+		}
+		if c.bindings[tenant] == nil {
+			c.bindings[tenant] = map[string][]*rbacPermissions{}
+		}
+		for _, role := range b.Roles {
+			p, ok := resolved[role]
+			if !ok {
+				return nil, fmt.Errorf("auth: rbac binding %d references unknown role %q", i, role)
+			}
+			c.bindings[tenant][b.Subject] = append(c.bindings[tenant][b.Subject], p)
+		}
+	}
+	return c, nil
+}
+
+func compileRBACRule(role string, rule RBACRule) (rbacRule, error) {
+	if strings.TrimSpace(rule.Action) == "" {
+		return rbacRule{}, fmt.Errorf("auth: rbac role %q has a rule without action", role)
+	}
+	out := rbacRule{RBACRule: rule}
+	if strings.TrimSpace(rule.When) != "" {
+		cond, err := CompileCondition(rule.When)
+		if err != nil {
+			return rbacRule{}, fmt.Errorf("auth: rbac role %q: %w", role, err)
+		}
+		out.cond = cond
+	}
+	return out, nil
+}
+
+// globMatch reports whether s matches pattern, where '*' matches any sequence of characters.
+func globMatch(pattern, s string) bool {
+	return globMatchLiteral(pattern, nil, s)
+}
+
+// globMatchLiteral is globMatch where a '*' at pattern[i] with literal[i] set only
+// matches itself. literal is either nil or as long as pattern.
+func globMatchLiteral(pattern string, literal []bool, s string) bool {
+	wildcard := func(i int) bool { return pattern[i] == '*' && (literal == nil || !literal[i]) }
+	px, sx := 0, 0
+	starP, starS := -1, 0
+	for sx < len(s) {
+		switch {
+		case px < len(pattern) && wildcard(px):
+			starP, starS = px, sx
+			px++
+		case px < len(pattern) && pattern[px] == s[sx]:
+			px++
+			sx++
+		case starP >= 0:
+			starS++
+			px, sx = starP+1, starS
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && wildcard(px) {
+		px++
+	}
+	return px == len(pattern)
+}
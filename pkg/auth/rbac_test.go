@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testRBACYAML = `
+roles:
+  orders.viewer:
+    allow:
+      - action: "orders.read"
+  orders.admin:
+    inherits: [orders.viewer]
+    allow:
+      - action: "orders.*"
+        resource: "tenant:{tenant}:*"
+    deny:
+      - action: "orders.delete"
+  payments.admin:
+    allow:
+      - action: "payments.*"
+bindings:
+  - subject: "u1"
+    tenant: "t1"
+    roles: [orders.admin]
+  - subject: "u2"
+    tenant: "t1"
+    roles: [orders.viewer]
+  - subject: "svc-billing"
+    roles: [payments.admin]
+`
+
+func TestRBAC_Check(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseRBACPolicy([]byte(testRBACYAML))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rbac, err := NewRBAC(p)
+	if err != nil {
+		t.Fatalf("NewRBAC: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  PolicyRequest
+		want Decision
+	}{
+		{"admin update own tenant", PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "orders.update", Resource: "tenant:t1:orders"}, DecisionAllow},
+		{"admin other tenant resource", PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "orders.update", Resource: "tenant:t2:orders"}, DecisionDeny},
+		{"admin inherits viewer", PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "orders.read", Resource: "anything"}, DecisionAllow},
+		{"deny overrides allow", PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "orders.delete", Resource: "tenant:t1:orders"}, DecisionDeny},
+		{"binding is per tenant", PolicyRequest{SubjectID: "u1", TenantID: "t2", Action: "orders.read"}, DecisionDeny},
+		{"viewer cannot update", PolicyRequest{SubjectID: "u2", TenantID: "t1", Action: "orders.update", Resource: "tenant:t1:orders"}, DecisionDeny},
+		{"global binding", PolicyRequest{SubjectID: "svc-billing", TenantID: "t9", Action: "payments.refund"}, DecisionAllow},
+		{"unknown subject", PolicyRequest{SubjectID: "u3", TenantID: "t1", Action: "orders.read"}, DecisionDeny},
+		{"empty action", PolicyRequest{SubjectID: "u1", TenantID: "t1"}, DecisionDeny},
+	}
+	for _, tt := range tests {
+		got, err := rbac.Check(context.Background(), tt.req)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: got=%v want=%v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRBAC_JSON(t *testing.T) {
+	t.Parallel()
+
+	doc := `{"roles":{"r":{"allow":[{"action":"a.*"}]}},"bindings":[{"subject":"u1","tenant":"t1","roles":["r"]}]}`
+	p, err := ParseRBACPolicy([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rbac, err := NewRBAC(p)
+	if err != nil {
+		t.Fatalf("NewRBAC: %v", err)
+	}
+	dec, _ := rbac.Check(context.Background(), PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "a.b"})
+	if !dec.IsAllow() {
+		t.Fatalf("expected allow")
+	}
+}
+
+func TestRBAC_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"unknown field", `roles: {r: {allow: [{action: a, verb: x}]}}`},
+		{"cycle", `roles: {a: {inherits: [b]}, b: {inherits: [a]}}`},
+		{"unknown parent", `roles: {a: {inherits: [x]}}`},
+		{"rule without action", `roles: {a: {allow: [{resource: r}]}}`},
+		{"binding unknown role", `bindings: [{subject: u1, roles: [x]}]`},
+		{"binding without subject", `roles: {a: {}}
+bindings: [{roles: [a]}]`},
+	}
+	for _, tt := range tests {
+		p, err := ParseRBACPolicy([]byte(tt.doc))
+		if err == nil {
+			_, err = NewRBAC(p)
+		}
+		if err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+	}
+
+	var empty RBAC
+	if _, err := empty.Check(context.Background(), PolicyRequest{}); err == nil {
+		t.Fatalf("expected error for unloaded policy")
+	}
+}
+
+func TestRBAC_WatchReloads(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(doc string) {
+		if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(`roles: {r: {allow: [{action: a}]}}
+bindings: [{subject: u1, roles: [r]}]`)
+
+	rbac, err := LoadRBACFile(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	go rbac.Watch(ctx, path, 5*time.Millisecond, func(err error) { errs <- err })
+
+	check := func(action string) bool {
+		dec, _ := rbac.Check(context.Background(), PolicyRequest{SubjectID: "u1", Action: action})
+		return dec.IsAllow()
+	}
+	eventually := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("condition not met")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if !check("a") || check("b") {
+		t.Fatalf("unexpected initial policy")
+	}
+
+	write(`roles: {r: {allow: [{action: b}]}}
+bindings: [{subject: u1, roles: [r]}]`)
+	eventually(func() bool { return check("b") && !check("a") })
+
+	// broken file keeps the previous policy
+	write(`roles: {r: {inherits: [missing]}}`)
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected reload error")
+	}
+	if !check("b") {
+		t.Fatalf("previous policy should stay active")
+	}
+}
+
+func TestRBAC_WatchLoadsImmediately(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(doc string) {
+		if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(`roles: {r: {allow: [{action: a}]}}
+bindings: [{subject: u1, roles: [r]}]`)
+	rbac, err := LoadRBACFile(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// changed between load and Watch: picked up without waiting for the first tick
+	write(`roles: {r: {allow: [{action: b}]}}
+bindings: [{subject: u1, roles: [r]}]`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rbac.Watch(ctx, path, time.Hour, nil)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		dec, _ := rbac.Check(context.Background(), PolicyRequest{SubjectID: "u1", Action: "b"})
+		if dec.IsAllow() {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("policy not reloaded before the first interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRBAC_PlaceholdersMatchLiterally(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseRBACPolicy([]byte(`
+roles:
+  self:
+    allow:
+      - action: "profile.*"
+        resource: "tenant:{tenant}:users:{subject}"
+bindings:
+  - subject: "u1"
+    roles: [self]
+  - subject: "*"
+    roles: [self]
+  - subject: "u*"
+    roles: [self]
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rbac, err := NewRBAC(p)
+	if err != nil {
+		t.Fatalf("NewRBAC: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  PolicyRequest
+		want Decision
+	}{
+		{"own profile", PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "profile.read", Resource: "tenant:t1:users:u1"}, DecisionAllow},
+		{"other profile", PolicyRequest{SubjectID: "u1", TenantID: "t1", Action: "profile.read", Resource: "tenant:t1:users:u2"}, DecisionDeny},
+		{"star subject id", PolicyRequest{SubjectID: "*", TenantID: "t1", Action: "profile.read", Resource: "tenant:t1:users:u2"}, DecisionDeny},
+		{"star tenant id", PolicyRequest{SubjectID: "u1", TenantID: "t*", Action: "profile.read", Resource: "tenant:t2:users:u1"}, DecisionDeny},
+		{"star id matches itself", PolicyRequest{SubjectID: "u*", TenantID: "t1", Action: "profile.read", Resource: "tenant:t1:users:u*"}, DecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rbac.Check(context.Background(), tt.req)
+			if err != nil || got != tt.want {
+				t.Fatalf("got %v %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"orders.*", "orders.read", true},
+		{"orders.*", "payments.read", false},
+		{"*.read", "orders.read", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Fatalf("globMatch(%q,%q)=%v want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
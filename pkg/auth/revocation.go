@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTokenRevoked indicates the token was revoked (by jti or subject-wide cutoff).
+	// It wraps ErrInvalidToken.
+	ErrTokenRevoked = fmt.Errorf("%w: revoked", ErrInvalidToken)
+
+	// ErrRevocationUnavailable indicates the revocation store could not be consulted.
+	// Verification fails closed.
+	ErrRevocationUnavailable = errors.New("auth: revocation check unavailable")
+)
+
+// RevocationStore is consulted by Verifier after a token is otherwise valid.
+type RevocationStore interface {
+	// IsRevoked reports whether the token with the given jti has been revoked.
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+
+	// RevokedBefore returns the subject-wide cutoff: tokens for subject issued before it
+	// are revoked (e.g. after logout-everywhere or a disabled user). Zero means no cutoff.
+	// "iat" has second precision, so the cutoff is compared in whole seconds: tokens
+	// issued in the same second as the cutoff stay valid.
+	RevokedBefore(ctx context.Context, subject string) (time.Time, error)
+}
+
+// MemoryRevocationStore is an in-process RevocationStore, suitable for tests and
+// single-instance services. Revoked jtis are forgotten once the token would have expired.
+type MemoryRevocationStore struct {
+	mu       sync.RWMutex
+	jtis     map[string]time.Time
+	subjects map[string]time.Time
+	now      func() time.Time
+}
+
+// NewMemoryRevocationStore returns an empty store.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		jtis:     map[string]time.Time{},
+		subjects: map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Revoke revokes a single token. expiresAt is the token "exp"; after it the entry is dropped.
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("auth: revoke requires jti")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, exp := range s.jtis {
+		if !exp.After(now) {
+			delete(s.jtis, k)
+		}
+	}
+	s.jtis[jti] = expiresAt
+	return nil
+}
+
+// RevokeSubject revokes every token for subject issued before the given time.
+// The cutoff only moves forward.
+func (s *MemoryRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	if subject == "" {
+		return errors.New("auth: revoke requires subject")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.subjects[subject]; !ok || before.After(cur) {
+		s.subjects[subject] = before
+	}
+	return nil
+}
+
+// IsRevoked implements RevocationStore.
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exp, ok := s.jtis[jti]
+	return ok && exp.After(s.now()), nil
+}
+
+// RevokedBefore implements RevocationStore.
+func (s *MemoryRevocationStore) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.subjects[subject], nil
+}
+
+// RevocationCacheConfig controls CachedRevocationStore.
+type RevocationCacheConfig struct {
+	// TTL bounds how long a revocation may take to be observed. Defaults to 30s.
+	TTL time.Duration
+
+	// MaxEntries bounds each of the jti and subject caches. Defaults to 10000.
+	MaxEntries int
+}
+
+// CachedRevocationStore caches lookups of another RevocationStore (e.g. the Postgres store)
+// so that each verification does not hit the database. Errors are never cached.
+type CachedRevocationStore struct {
+	next     RevocationStore
+	ttl      time.Duration
+	now      func() time.Time
+	jtis     *lru[bool]
+	subjects *lru[time.Time]
+}
+
+// NewCachedRevocationStore wraps next. Panics if next is nil.
+func NewCachedRevocationStore(next RevocationStore, cfg RevocationCacheConfig) *CachedRevocationStore {
+	if next == nil {
+		panic("auth.NewCachedRevocationStore requires non-nil RevocationStore")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30 * time.Second
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	return &CachedRevocationStore{
+		next:     next,
+		ttl:      cfg.TTL,
+		now:      time.Now,
+		jtis:     newLRU[bool](cfg.MaxEntries),
+		subjects: newLRU[time.Time](cfg.MaxEntries),
+	}
+}
+
+// IsRevoked implements RevocationStore.
+func (s *CachedRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if v, exp, ok := s.jtis.get(jti); ok && s.now().Before(exp) {
+		return v, nil
+	}
+	v, err := s.next.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	s.jtis.set(jti, v, s.now().Add(s.ttl))
+	return v, nil
+}
+
+// RevokedBefore implements RevocationStore.
+func (s *CachedRevocationStore) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	if v, exp, ok := s.subjects.get(subject); ok && s.now().Before(exp) {
+		return v, nil
+	}
+	v, err := s.next.RevokedBefore(ctx, subject)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s.subjects.set(subject, v, s.now().Add(s.ttl))
+	return v, nil
+}
+
+// CheckRevocation applies store to verified claims, as Verifier does. Use it for
+// principals kept beyond the token, e.g. in a session. It returns ErrTokenRevoked or
+// ErrRevocationUnavailable. The subject-wide cutoff is truncated to whole seconds (see
+// RevocationStore.RevokedBefore).
+func CheckRevocation(ctx context.Context, store RevocationStore, claims *Claims) error {
+	if claims.ID != "" {
+		revoked, err := store.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrRevocationUnavailable, err)
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	cutoff, err := store.RevokedBefore(ctx, claims.Subject)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevocationUnavailable, err)
+	}
+	// iat is in whole seconds: a token issued right after the cutoff, in the same second,
+	// must not be revoked
+	cutoff = cutoff.Truncate(time.Second)
+	if !cutoff.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Before(cutoff)) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
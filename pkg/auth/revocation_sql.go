@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SQLRevocationStore is a Postgres-backed RevocationStore. Open the *sql.DB with db.Open
+// and wrap the store with NewCachedRevocationStore to keep database load off the hot path.
+type SQLRevocationStore struct {
+	db *sql.DB
+}
+
+// NewSQLRevocationStore returns a store on db. Call EnsureRevocationTables once at startup
+// (or ship the equivalent DDL in your migrations).
+func NewSQLRevocationStore(db *sql.DB) *SQLRevocationStore {
+	if db == nil {
+		panic("auth.NewSQLRevocationStore requires non-nil db")
+	}
+	return &SQLRevocationStore{db: db}
+}
+
+// EnsureRevocationTables creates the revocation tables if they do not exist.
+func EnsureRevocationTables(ctx context.Context, db *sql.DB) error {
+	if db == nil {
+		return errors.New("auth: nil db")
+	}
+
+	const ddl = `
+CREATE TABLE IF NOT EXISTS auth_revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS auth_revoked_tokens_expires_at_idx
+	ON auth_revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS auth_revoked_subjects (
+	subject TEXT PRIMARY KEY,
+	revoked_before TIMESTAMPTZ NOT NULL
+);
+`
+	_, err := db.ExecContext(ctx, ddl)
+	return err
+}
+
+// Revoke revokes a single token. expiresAt is the token "exp", used by PurgeExpired.
+func (s *SQLRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("auth: revoke requires jti")
+	}
+
+	const q = `
+INSERT INTO auth_revoked_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING;
+`
+	_, err := s.db.ExecContext(ctx, q, jti, expiresAt.UTC())
+	return err
+}
+
+// RevokeSubject revokes every token for subject issued before the given time.
+// The cutoff only moves forward.
+func (s *SQLRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	if subject == "" {
+		return errors.New("auth: revoke requires subject")
+	}
+
+	const q = `
+INSERT INTO auth_revoked_subjects (subject, revoked_before)
+VALUES ($1, $2)
+ON CONFLICT (subject) DO UPDATE
+SET revoked_before = GREATEST(auth_revoked_subjects.revoked_before, EXCLUDED.revoked_before);
+`
+	_, err := s.db.ExecContext(ctx, q, subject, before.UTC())
+	return err
+}
+
+// PurgeExpired deletes revoked jtis whose tokens have expired anyway.
+func (s *SQLRevocationStore) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM auth_revoked_tokens WHERE expires_at < now();`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// IsRevoked implements RevocationStore.
+func (s *SQLRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM auth_revoked_tokens WHERE jti = $1 AND expires_at > now());`,
+		jti,
+	).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// RevokedBefore implements RevocationStore.
+func (s *SQLRevocationStore) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	var before time.Time
+	err := s.db.QueryRowContext(ctx,
+		`SELECT revoked_before FROM auth_revoked_subjects WHERE subject = $1;`,
+		subject,
+	).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return before, nil
+}
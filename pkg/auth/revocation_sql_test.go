@@ -0,0 +1,59 @@
+//go:build integration
+// +build integration
+
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+	wstest "github.com/hanzy-dev/saas-ws-lib/pkg/testkit"
+)
+
+func TestSQLRevocationStore(t *testing.T) {
+	db := wstest.OpenTestDB(t)
+	ctx := wstest.WithTimeout(t, 5*time.Second)
+
+	if err := auth.EnsureRevocationTables(ctx, db); err != nil {
+		t.Fatalf("ensure tables: %v", err)
+	}
+	s := auth.NewSQLRevocationStore(db)
+
+	jti := uuid.NewString()
+	if ok, err := s.IsRevoked(ctx, jti); err != nil || ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	if err := s.Revoke(ctx, jti, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := s.Revoke(ctx, jti, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("revoke twice: %v", err)
+	}
+	if ok, err := s.IsRevoked(ctx, jti); err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+
+	sub := "u-" + uuid.NewString()
+	if cut, err := s.RevokedBefore(ctx, sub); err != nil || !cut.IsZero() {
+		t.Fatalf("cut=%v err=%v", cut, err)
+	}
+	cutoff := time.Now().UTC().Truncate(time.Second)
+	if err := s.RevokeSubject(ctx, sub, cutoff); err != nil {
+		t.Fatalf("revoke subject: %v", err)
+	}
+	if err := s.RevokeSubject(ctx, sub, cutoff.Add(-time.Hour)); err != nil {
+		t.Fatalf("revoke subject backwards: %v", err)
+	}
+	if cut, err := s.RevokedBefore(ctx, sub); err != nil || !cut.Equal(cutoff) {
+		t.Fatalf("cut=%v err=%v", cut, err)
+	}
+
+	expired := uuid.NewString()
+	_ = s.Revoke(ctx, expired, time.Now().Add(-time.Hour))
+	if n, err := s.PurgeExpired(ctx); err != nil || n < 1 {
+		t.Fatalf("purge n=%d err=%v", n, err)
+	}
+}
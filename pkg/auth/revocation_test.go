@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type flakyRevocation struct {
+	calls atomic.Int32
+	err   error
+	inner RevocationStore
+}
+
+func (f *flakyRevocation) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.inner.IsRevoked(ctx, jti)
+}
+
+func (f *flakyRevocation) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return time.Time{}, f.err
+	}
+	return f.inner.RevokedBefore(ctx, subject)
+}
+
+func TestVerifier_Revocation(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	iss, _ := NewIssuer(IssuerConfig{Keys: []SigningKey{{ID: "k", Method: jwt.SigningMethodHS256, Key: secret}}})
+	store := NewMemoryRevocationStore()
+	v := Verifier{KeyFunc: iss.KeyFunc, Revocation: store}
+	ctx := context.Background()
+
+	issue := func(sub string, iat time.Time) (string, string) {
+		id := "jti-" + sub + iat.String()
+		tok, err := iss.Issue(Claims{
+			TenantID: "t1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:  sub,
+				ID:       id,
+				IssuedAt: jwt.NewNumericDate(iat),
+			},
+		})
+		if err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+		return tok, id
+	}
+
+	tok, jti := issue("u1", time.Now())
+	if _, err := v.VerifyContext(ctx, tok); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := store.Revoke(ctx, jti, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := v.VerifyContext(ctx, tok); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked, got %v", err)
+	}
+
+	// subject-wide cutoff
+	old, _ := issue("u2", time.Now().Add(-time.Hour))
+	fresh, _ := issue("u2", time.Now().Add(time.Minute))
+	if err := store.RevokeSubject(ctx, "u2", time.Now()); err != nil {
+		t.Fatalf("revoke subject: %v", err)
+	}
+	// cutoff never moves backwards
+	_ = store.RevokeSubject(ctx, "u2", time.Now().Add(-24*time.Hour))
+	if _, err := v.VerifyContext(ctx, old); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected old token revoked, got %v", err)
+	}
+	if _, err := v.VerifyContext(ctx, fresh); err != nil {
+		t.Fatalf("token issued after cutoff should pass: %v", err)
+	}
+
+	// store failure fails closed
+	broken := Verifier{KeyFunc: iss.KeyFunc, Revocation: &flakyRevocation{err: errors.New("db down")}}
+	if _, err := broken.VerifyContext(ctx, fresh); !errors.Is(err, ErrRevocationUnavailable) {
+		t.Fatalf("expected ErrRevocationUnavailable, got %v", err)
+	}
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemoryRevocationStore()
+	ctx := context.Background()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if err := s.Revoke(ctx, "", now); err == nil {
+		t.Fatalf("expected error for empty jti")
+	}
+	if err := s.RevokeSubject(ctx, "", now); err == nil {
+		t.Fatalf("expected error for empty subject")
+	}
+
+	_ = s.Revoke(ctx, "a", now.Add(time.Minute))
+	if ok, _ := s.IsRevoked(ctx, "a"); !ok {
+		t.Fatalf("expected revoked")
+	}
+
+	// expired entries are dropped on the next write
+	now = now.Add(2 * time.Minute)
+	if ok, _ := s.IsRevoked(ctx, "a"); ok {
+		t.Fatalf("expired entry should not count")
+	}
+	_ = s.Revoke(ctx, "b", now.Add(time.Minute))
+	if _, ok := s.jtis["a"]; ok {
+		t.Fatalf("expired entry should be pruned")
+	}
+}
+
+func TestCachedRevocationStore(t *testing.T) {
+	t.Parallel()
+
+	mem := NewMemoryRevocationStore()
+	inner := &flakyRevocation{inner: mem}
+	c := NewCachedRevocationStore(inner, RevocationCacheConfig{TTL: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if ok, err := c.IsRevoked(ctx, "j1"); ok || err != nil {
+			t.Fatalf("ok=%v err=%v", ok, err)
+		}
+		if cut, err := c.RevokedBefore(ctx, "u1"); !cut.IsZero() || err != nil {
+			t.Fatalf("cut=%v err=%v", cut, err)
+		}
+	}
+	if got := inner.calls.Load(); got != 2 {
+		t.Fatalf("expected 2 backend calls, got %d", got)
+	}
+
+	_ = mem.Revoke(ctx, "j1", time.Now().Add(time.Hour))
+	if ok, _ := c.IsRevoked(ctx, "j1"); ok {
+		t.Fatalf("cached value should be served within ttl")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := c.IsRevoked(ctx, "j1"); !ok {
+		t.Fatalf("revocation should be observed after ttl")
+	}
+
+	// errors are not cached
+	inner.err = errors.New("down")
+	if _, err := c.RevokedBefore(ctx, "u9"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := c.IsRevoked(ctx, "j9"); err == nil {
+		t.Fatalf("expected error")
+	}
+	inner.err = nil
+	if _, err := c.RevokedBefore(ctx, "u9"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestRevocationStores_NilPanics(t *testing.T) {
+	t.Parallel()
+
+	for name, fn := range map[string]func(){
+		"cached": func() { NewCachedRevocationStore(nil, RevocationCacheConfig{}) },
+		"sql":    func() { NewSQLRevocationStore(nil) },
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("%s: expected panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+
+	if err := EnsureRevocationTables(context.Background(), nil); err == nil {
+		t.Fatalf("expected error for nil db")
+	}
+}
+
+func TestCheckRevocation_SecondPrecision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	cutoff := time.Unix(1_700_000_000, 600_000_000) // logout-everywhere at .6s
+	if err := store.RevokeSubject(ctx, "u1", cutoff); err != nil {
+		t.Fatalf("revoke subject: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		iat  time.Time
+		want error
+	}{
+		{"earlier second", time.Unix(1_699_999_999, 0), ErrTokenRevoked},
+		// a re-login right after the cutoff gets iat truncated to the same second
+		{"same second", time.Unix(1_700_000_000, 0), nil},
+		{"later second", time.Unix(1_700_000_001, 0), nil},
+	}
+	for _, tt := range tests {
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", IssuedAt: jwt.NewNumericDate(tt.iat)}}
+		if err := CheckRevocation(ctx, store, claims); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: err=%v want %v", tt.name, err, tt.want)
+		}
+	}
+}
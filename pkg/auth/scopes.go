@@ -3,85 +3,218 @@ package auth
 import "strings"
 
 // Scope represents an authorization scope (permission string) attached to an identity.
+//
+// Grammar: segments separated by ':' (typically resource:action, e.g. "orders:read"
+// or "billing:invoices:read"). A segment "*" in a granted scope is a wildcard:
+//   - in the middle it matches exactly one segment ("orders:*:read" matches "orders:eu:read")
+//   - as the last segment it matches one or more segments ("orders:*" matches "orders:read"
+//     and "orders:items:read")
+//   - "*" alone matches every scope
+//
+// Required scopes are matched literally; a wildcard in a required scope only matches
+// a granted scope that covers it.
 type Scope string
 
 func (s Scope) String() string { return string(s) }
 
-// Has reports whether scopes contains the required scope.
-// Matching is exact after TrimSpace normalization.
+// Valid reports whether s follows the scope grammar: non-empty segments without
+// whitespace, where '*' may only appear as a whole segment.
+func (s Scope) Valid() bool {
+	str := strings.TrimSpace(s.String())
+	if str == "" {
+		return false
+	}
+	for seg, rest, more := strings.Cut(str, ":"); ; seg, rest, more = strings.Cut(rest, ":") {
+		if seg == "" || strings.ContainsAny(seg, " \t\r\n") {
+			return false
+		}
+		if seg != "*" && strings.Contains(seg, "*") {
+			return false
+		}
+		if !more {
+			return true
+		}
+	}
+}
+
+// Has reports whether scopes grants the required scope.
+// Matching follows the Scope grammar after TrimSpace normalization.
 func Has(scopes []string, required Scope) bool {
 	req := strings.TrimSpace(required.String())
 	if req == "" || len(scopes) == 0 {
 		return false
 	}
 	for _, s := range scopes {
-		if strings.TrimSpace(s) == req {
+		if matchScope(strings.TrimSpace(s), req) {
 			return true
 		}
 	}
 	return false
 }
 
-// HasAll reports whether scopes contains all required scopes.
+// HasAll reports whether scopes grants all required scopes.
 // Empty required values are ignored.
 // If no non-empty required scopes are provided, returns true.
 func HasAll(scopes []string, required ...Scope) bool {
-	reqs := normalizeRequired(required...)
-	if len(reqs) == 0 {
-		return true
-	}
-	set := scopeSet(scopes)
-	for r := range reqs {
-		if !set[r] {
+	for _, r := range required {
+		if strings.TrimSpace(r.String()) == "" {
+			continue
+		}
+		if !Has(scopes, r) {
 			return false
 		}
 	}
 	return true
 }
 
-// HasAny reports whether scopes contains any of the required scopes.
+// HasAny reports whether scopes grants any of the required scopes.
 // Empty required values are ignored.
 // If no non-empty required scopes are provided, returns false.
 func HasAny(scopes []string, required ...Scope) bool {
-	reqs := normalizeRequired(required...)
-	if len(reqs) == 0 {
-		return false
-	}
-	set := scopeSet(scopes)
-	for r := range reqs {
-		if set[r] {
+	for _, r := range required {
+		if Has(scopes, r) {
 			return true
 		}
 	}
 	return false
 }
 
-func scopeSet(scopes []string) map[string]bool {
-	if len(scopes) == 0 {
-		return map[string]bool{}
-	}
-	set := make(map[string]bool, len(scopes))
+// ScopeImplications maps an action (the last scope segment) to the actions it implies,
+// e.g. {"admin": {"write"}, "write": {"read"}}. Implications are transitive.
+type ScopeImplications map[string][]string
+
+// ScopeSet is a compiled set of granted scopes with implications expanded.
+// Compile once per principal and reuse it for multiple checks.
+type ScopeSet struct {
+	exact map[string]struct{}
+	wild  []string
+}
+
+// CompileScopes builds a ScopeSet from granted scopes. implies may be nil.
+func CompileScopes(scopes []string, implies ScopeImplications) ScopeSet {
+	set := ScopeSet{exact: make(map[string]struct{}, len(scopes))}
 	for _, s := range scopes {
 		s = strings.TrimSpace(s)
 		if s == "" {
 			continue
 		}
-		set[s] = true
+		set.add(s)
+
+		if len(implies) == 0 {
+			continue
+		}
+		prefix, action := "", s
+		if i := strings.LastIndexByte(s, ':'); i >= 0 {
+			prefix, action = s[:i+1], s[i+1:]
+		}
+		for _, a := range expandActions(action, implies) {
+			set.add(prefix + a)
+		}
 	}
 	return set
 }
 
-func normalizeRequired(required ...Scope) map[string]bool {
-	if len(required) == 0 {
-		return nil
+func (s *ScopeSet) add(scope string) {
+	if _, ok := s.exact[scope]; ok {
+		return
+	}
+	s.exact[scope] = struct{}{}
+	if strings.Contains(scope, "*") {
+		s.wild = append(s.wild, scope)
+	}
+}
+
+// Has reports whether the set grants required.
+func (s ScopeSet) Has(required Scope) bool {
+	req := strings.TrimSpace(required.String())
+	if req == "" {
+		return false
+	}
+	if _, ok := s.exact[req]; ok {
+		return true
 	}
-	out := make(map[string]bool, len(required))
+	for _, w := range s.wild {
+		if matchScope(w, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAll reports whether the set grants all required scopes. Empty values are ignored.
+func (s ScopeSet) HasAll(required ...Scope) bool {
 	for _, r := range required {
-		s := strings.TrimSpace(r.String())
-		if s == "" {
+		if strings.TrimSpace(r.String()) == "" {
 			continue
 		}
-		out[s] = true
+		if !s.Has(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasAny reports whether the set grants any required scope. Empty values are ignored.
+func (s ScopeSet) HasAny(required ...Scope) bool {
+	for _, r := range required {
+		if s.Has(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandActions returns the transitive closure of actions implied by action (excluding itself).
+func expandActions(action string, implies ScopeImplications) []string {
+	var out []string
+	seen := map[string]bool{action: true}
+	queue := []string{action}
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+		for _, next := range implies[a] {
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			out = append(out, next)
+			queue = append(queue, next)
+		}
 	}
 	return out
 }
+
+// matchScope reports whether granted covers required. It does not allocate.
+func matchScope(granted, required string) bool {
+	if granted == "" {
+		return false
+	}
+	if granted == required {
+		return true
+	}
+	if !strings.Contains(granted, "*") {
+		return false
+	}
+
+	g, r := granted, required
+	for {
+		gseg, grest, gmore := strings.Cut(g, ":")
+		rseg, rrest, rmore := strings.Cut(r, ":")
+
+		if gseg == "*" {
+			if rseg == "" {
+				return false
+			}
+			if !gmore {
+				// trailing wildcard: matches one or more remaining segments
+				return true
+			}
+		} else if gseg != rseg {
+			return false
+		}
+		if !gmore || !rmore {
+			return gmore == rmore
+		}
+		g, r = grest, rrest
+	}
+}
@@ -86,3 +86,114 @@ func TestHasAny(t *testing.T) {
 		})
 	}
 }
+
+func TestHas_Wildcards(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		scopes   []string
+		required Scope
+		want     bool
+	}{
+		{"trailing wildcard", []string{"orders:*"}, "orders:read", true},
+		{"trailing wildcard multi segment", []string{"orders:*"}, "orders:items:read", true},
+		{"trailing wildcard needs a segment", []string{"orders:*"}, "orders", false},
+		{"other resource", []string{"orders:*"}, "payments:read", false},
+		{"middle wildcard", []string{"orders:*:read"}, "orders:eu:read", true},
+		{"middle wildcard single segment", []string{"orders:*:read"}, "orders:eu:x:read", false},
+		{"middle wildcard empty segment", []string{"orders:*:read"}, "orders::read", false},
+		{"global wildcard", []string{"*"}, "anything:at:all", true},
+		{"required wildcard is literal", []string{"orders:read"}, "orders:*", false},
+		{"required wildcard covered", []string{"*"}, "orders:*", true},
+		{"no implication by default", []string{"orders:admin"}, "orders:read", false},
+		{"longer grant", []string{"orders:read:x"}, "orders:read", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := Has(tt.scopes, tt.required); got != tt.want {
+				t.Fatalf("Has()=%v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeSet(t *testing.T) {
+	t.Parallel()
+
+	implies := ScopeImplications{
+		"admin": {"write"},
+		"write": {"read"},
+	}
+	set := CompileScopes([]string{" orders:admin ", "payments:*", ""}, implies)
+
+	tests := []struct {
+		required Scope
+		want     bool
+	}{
+		{"orders:admin", true},
+		{"orders:write", true},
+		{"orders:read", true},
+		{"orders:delete", false},
+		{"payments:refunds:create", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := set.Has(tt.required); got != tt.want {
+			t.Fatalf("Has(%q)=%v, want %v", tt.required, got, tt.want)
+		}
+	}
+
+	if !set.HasAll("orders:read", "payments:read", "") {
+		t.Fatalf("HasAll should be true")
+	}
+	if set.HasAll("orders:read", "core:read") {
+		t.Fatalf("HasAll should be false")
+	}
+	if !set.HasAny("core:read", "orders:read") || set.HasAny("core:read") || set.HasAny() {
+		t.Fatalf("HasAny mismatch")
+	}
+
+	// implications on a wildcard prefix
+	wild := CompileScopes([]string{"*:write"}, implies)
+	if !wild.Has("orders:read") {
+		t.Fatalf("expected *:write to imply *:read")
+	}
+}
+
+func TestScope_Valid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   Scope
+		want bool
+	}{
+		{"orders:read", true},
+		{"orders:*", true},
+		{"*", true},
+		{"a", true},
+		{"", false},
+		{"orders:", false},
+		{":read", false},
+		{"orders::read", false},
+		{"orders:re*d", false},
+		{"orders: read", false},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Valid(); got != tt.want {
+			t.Fatalf("Valid(%q)=%v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScope_NoAlloc(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = Has([]string{"billing:*", "orders:*:read"}, "orders:eu:read")
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
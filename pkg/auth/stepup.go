@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrInsufficientAuthentication indicates a valid token whose authentication is too weak
+// or too old for the operation (RFC 9470). The client should re-authenticate the user and
+// retry; it does not wrap ErrInvalidToken.
+var ErrInsufficientAuthentication = errors.New("auth: insufficient user authentication")
+
+// StepUp describes how strongly and how recently the user must have authenticated,
+// based on the OpenID Connect "acr", "amr" and "auth_time" claims.
+type StepUp struct {
+	// ACR is the minimum acceptable authentication context class.
+	// ACRLevels orders acr values from weakest to strongest; a token passes if its acr
+	// is ACR or listed after it. Without ACRLevels the acr must equal ACR.
+	ACR       string
+	ACRLevels []string
+
+	// AMR lists authentication methods that must all appear in "amr", e.g. "mfa" or "hwk".
+	AMR []string
+
+	// MaxAge bounds the time since "auth_time". Tokens without auth_time fail.
+	MaxAge time.Duration
+}
+
+// IsZero reports whether s has no requirements.
+func (s StepUp) IsZero() bool {
+	return s.ACR == "" && len(s.AMR) == 0 && s.MaxAge <= 0
+}
+
+// Validate reports misconfiguration, e.g. an ACR missing from ACRLevels.
+func (s StepUp) Validate() error {
+	if s.ACR == "" && len(s.ACRLevels) > 0 {
+		return errors.New("auth: step-up ACRLevels requires ACR")
+	}
+	if s.ACR != "" && len(s.ACRLevels) > 0 && !slices.Contains(s.ACRLevels, s.ACR) {
+		return fmt.Errorf("auth: step-up ACR %q not in ACRLevels", s.ACR)
+	}
+	if s.MaxAge < 0 {
+		return errors.New("auth: step-up MaxAge must not be negative")
+	}
+	return nil
+}
+
+// ACRValues returns the acceptable acr values, strongest last, as sent in the
+// "acr_values" challenge parameter.
+func (s StepUp) ACRValues() []string {
+	if s.ACR == "" {
+		return nil
+	}
+	if i := slices.Index(s.ACRLevels, s.ACR); i >= 0 {
+		return slices.Clone(s.ACRLevels[i:])
+	}
+	return []string{s.ACR}
+}
+
+// Check reports whether claims meet s at now. Failures wrap ErrInsufficientAuthentication
+// with the unmet requirement (acr, amr or auth_time) for logs.
+func (s StepUp) Check(claims *Claims, now time.Time) error {
+	if s.ACR != "" && !slices.Contains(s.ACRValues(), claims.ACR) {
+		return fmt.Errorf("%w: acr", ErrInsufficientAuthentication)
+	}
+	for _, m := range s.AMR {
+		if !slices.Contains(claims.AMR, m) {
+			return fmt.Errorf("%w: amr %s", ErrInsufficientAuthentication, m)
+		}
+	}
+	if s.MaxAge > 0 {
+		if claims.AuthTime == nil || now.Sub(claims.AuthTime.Time) > s.MaxAge {
+			return fmt.Errorf("%w: auth_time", ErrInsufficientAuthentication)
+		}
+	}
+	return nil
+}
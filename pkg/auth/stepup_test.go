@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestStepUp_Check(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+	levels := []string{"aal1", "aal2", "aal3"}
+
+	tests := []struct {
+		name   string
+		s      StepUp
+		claims Claims
+		ok     bool
+	}{
+		{"no requirements", StepUp{}, Claims{}, true},
+		{"exact acr", StepUp{ACR: "urn:mace:incommon:iap:silver"}, Claims{ACR: "urn:mace:incommon:iap:silver"}, true},
+		{"other acr without levels", StepUp{ACR: "aal2"}, Claims{ACR: "aal3"}, false},
+		{"stronger acr", StepUp{ACR: "aal2", ACRLevels: levels}, Claims{ACR: "aal3"}, true},
+		{"weaker acr", StepUp{ACR: "aal2", ACRLevels: levels}, Claims{ACR: "aal1"}, false},
+		{"missing acr", StepUp{ACR: "aal2", ACRLevels: levels}, Claims{}, false},
+		{"all amr", StepUp{AMR: []string{"pwd", "otp"}}, Claims{AMR: []string{"otp", "pwd"}}, true},
+		{"missing amr", StepUp{AMR: []string{"pwd", "otp"}}, Claims{AMR: []string{"pwd"}}, false},
+		{"recent", StepUp{MaxAge: time.Minute}, Claims{AuthTime: jwt.NewNumericDate(now.Add(-time.Minute))}, true},
+		{"too old", StepUp{MaxAge: time.Minute}, Claims{AuthTime: jwt.NewNumericDate(now.Add(-61 * time.Second))}, false},
+		{"no auth_time", StepUp{MaxAge: time.Minute}, Claims{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.s.Check(&tt.claims, now)
+			if tt.ok != (err == nil) {
+				t.Fatalf("ok=%v, got %v", tt.ok, err)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInsufficientAuthentication) || errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("unexpected error chain: %v", err)
+				}
+				if VerifyErrorReason(err) != "insufficient_user_authentication" {
+					t.Fatalf("reason=%q", VerifyErrorReason(err))
+				}
+			}
+		})
+	}
+}
+
+func TestStepUp_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		s  StepUp
+		ok bool
+	}{
+		{StepUp{}, true},
+		{StepUp{ACR: "aal2", ACRLevels: []string{"aal1", "aal2"}, AMR: []string{"mfa"}, MaxAge: time.Minute}, true},
+		{StepUp{ACRLevels: []string{"aal1"}}, false},
+		{StepUp{ACR: "aal2", ACRLevels: []string{"aal1"}}, false},
+		{StepUp{MaxAge: -time.Second}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.s.Validate(); tt.ok != (err == nil) {
+			t.Fatalf("%+v: ok=%v, got %v", tt.s, tt.ok, err)
+		}
+	}
+
+	if got := (StepUp{ACR: "aal2", ACRLevels: []string{"aal1", "aal2", "aal3"}}).ACRValues(); len(got) != 2 || got[0] != "aal2" {
+		t.Fatalf("ACRValues=%v", got)
+	}
+	if !(StepUp{ACRLevels: []string{"aal1"}}).IsZero() || (StepUp{MaxAge: time.Second}).IsZero() {
+		t.Fatalf("unexpected IsZero")
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenExchanger(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "svc%3Aorders" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		f := r.PostForm
+		switch {
+		case f.Get("subject_token") == "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"subject token expired"}`))
+			return
+		case f.Get("subject_token") == "broken":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`<html>`))
+			return
+		}
+		if f.Get("grant_type") != GrantTypeTokenExchange || f.Get("subject_token_type") != TokenTypeAccessToken ||
+			f.Get("scope") != "payments:read payments:write" || len(f["audience"]) != 2 ||
+			f.Get("actor_token") != "actor" || f.Get("actor_token_type") != TokenTypeAccessToken ||
+			f.Get("resource") != "https://payments" || f.Get("requested_token_type") != TokenTypeJWT {
+			t.Errorf("unexpected form: %v", f)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"exchanged","token_type":"Bearer","issued_token_type":"urn:ietf:params:oauth:token-type:jwt","expires_in":300,"scope":"payments:read"}`))
+	}))
+	defer srv.Close()
+
+	x, err := NewTokenExchanger(TokenExchangeConfig{TokenURL: srv.URL, ClientID: "svc:orders", ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewTokenExchanger: %v", err)
+	}
+	now := time.Now()
+	x.endpoint.now = func() time.Time { return now }
+
+	tok, err := x.Exchange(context.Background(), ExchangeRequest{
+		SubjectToken:       "user-token",
+		ActorToken:         "actor",
+		RequestedTokenType: TokenTypeJWT,
+		Audience:           []string{"payments", "ledger"},
+		Resource:           []string{"https://payments"},
+		Scopes:             []string{"payments:read", "payments:write"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if tok.AccessToken != "exchanged" || tok.IssuedTokenType != TokenTypeJWT || !tok.Expiry.Equal(now.Add(5*time.Minute)) {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+	if s := tok.Scopes(); len(s) != 1 || s[0] != "payments:read" {
+		t.Fatalf("scopes=%v", s)
+	}
+
+	_, err = x.Exchange(context.Background(), ExchangeRequest{SubjectToken: "bad"})
+	var oerr *OAuthError
+	if !errors.As(err, &oerr) || oerr.Code != "invalid_grant" || oerr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid_grant OAuthError, got %v", err)
+	}
+	if oerr.Error() != "auth: token endpoint: invalid_grant: subject token expired" {
+		t.Fatalf("unexpected message %q", oerr.Error())
+	}
+
+	if _, err := x.Exchange(context.Background(), ExchangeRequest{SubjectToken: "broken"}); !errors.Is(err, ErrTokenEndpoint) {
+		t.Fatalf("expected ErrTokenEndpoint, got %v", err)
+	}
+	if _, err := x.Exchange(context.Background(), ExchangeRequest{}); err == nil {
+		t.Fatalf("expected error without subject token")
+	}
+
+	wrong, _ := NewTokenExchanger(TokenExchangeConfig{TokenURL: srv.URL, ClientID: "other"})
+	if _, err := wrong.Exchange(context.Background(), ExchangeRequest{SubjectToken: "x"}); !errors.As(err, &oerr) || oerr.Error() != "auth: token endpoint: invalid_client" {
+		t.Fatalf("expected invalid_client, got %v", err)
+	}
+
+	down, _ := NewTokenExchanger(TokenExchangeConfig{TokenURL: "http://127.0.0.1:1"})
+	if _, err := down.Exchange(context.Background(), ExchangeRequest{SubjectToken: "x"}); !errors.Is(err, ErrTokenEndpoint) {
+		t.Fatalf("expected ErrTokenEndpoint, got %v", err)
+	}
+
+	if _, err := NewTokenExchanger(TokenExchangeConfig{}); err == nil {
+		t.Fatalf("expected error without TokenURL")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Base returns c. Custom claims types that embed Claims inherit it, which lets
+// TypedVerifier and middleware.Auth reach the standard fields.
+func (c *Claims) Base() *Claims {
+	return c
+}
+
+// CustomClaims is implemented by any claims type that embeds Claims.
+type CustomClaims interface {
+	Base() *Claims
+}
+
+// ClaimsPointer constrains TypedVerifier's PT to *T where T embeds Claims.
+type ClaimsPointer[T any] interface {
+	*T
+	jwt.Claims
+	CustomClaims
+}
+
+// CustomClaimsVerifier is implemented by verifiers that produce custom claims types.
+// middleware.Auth stores the full claims in the request context when available.
+type CustomClaimsVerifier interface {
+	TokenVerifier
+	VerifyCustom(ctx context.Context, token string) (CustomClaims, error)
+}
+
+// TypedVerifier verifies tokens into a custom claims type, e.g.
+//
+//	type AppClaims struct {
+//		auth.Claims
+//		Roles         []string `json:"roles"`
+//		Plan          string   `json:"plan"`
+//		EmailVerified bool     `json:"email_verified"`
+//	}
+//
+//	v := auth.NewTypedVerifier[AppClaims](auth.Verifier{KeyFunc: jwks.KeyFunc})
+//
+// All checks of the embedded Verifier (issuer, audience, claim mapping, revocation) apply.
+type TypedVerifier[T any, PT ClaimsPointer[T]] struct {
+	Verifier
+}
+
+// NewTypedVerifier wraps v. PT is inferred, so only T needs to be given.
+func NewTypedVerifier[T any, PT ClaimsPointer[T]](v Verifier) *TypedVerifier[T, PT] {
+	return &TypedVerifier[T, PT]{Verifier: v}
+}
+
+// VerifyTyped parses and validates token into a new *T.
+func (v *TypedVerifier[T, PT]) VerifyTyped(ctx context.Context, token string) (PT, error) {
+	claims := PT(new(T))
+	if err := v.verifyInto(ctx, token, claims, claims.Base()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// VerifyContext implements TokenVerifier, returning only the standard claims.
+func (v *TypedVerifier[T, PT]) VerifyContext(ctx context.Context, token string) (*Claims, error) {
+	claims, err := v.VerifyTyped(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.Base(), nil
+}
+
+// VerifyCustom implements CustomClaimsVerifier.
+func (v *TypedVerifier[T, PT]) VerifyCustom(ctx context.Context, token string) (CustomClaims, error) {
+	claims, err := v.VerifyTyped(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
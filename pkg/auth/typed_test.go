@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type appClaims struct {
+	Claims
+	Roles         []string `json:"roles"`
+	OrgUnits      []string `json:"org_units"`
+	Plan          string   `json:"plan"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+func TestTypedVerifier(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	keyFunc := func(*jwt.Token) (any, error) { return secret, nil }
+
+	sign := func(claims jwt.MapClaims) string {
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = time.Now().Add(time.Hour).Unix()
+		}
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	v := NewTypedVerifier[appClaims](Verifier{KeyFunc: keyFunc})
+	tok := sign(jwt.MapClaims{
+		"sub": "u1", "tenant_id": "t1", "scopes": []string{"a"},
+		"roles": []string{"admin"}, "org_units": []string{"eu", "sales"}, "plan": "pro", "email_verified": true,
+	})
+
+	got, err := v.VerifyTyped(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got.Subject != "u1" || got.TenantID != "t1" || len(got.Scopes) != 1 {
+		t.Fatalf("unexpected standard claims: %+v", got.Claims)
+	}
+	if len(got.Roles) != 1 || got.Roles[0] != "admin" || len(got.OrgUnits) != 2 || got.Plan != "pro" || !got.EmailVerified {
+		t.Fatalf("unexpected custom claims: %+v", got)
+	}
+
+	base, err := v.VerifyContext(context.Background(), tok)
+	if err != nil || base.Subject != "u1" {
+		t.Fatalf("base=%+v err=%v", base, err)
+	}
+	custom, err := v.VerifyCustom(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if c, ok := custom.(*appClaims); !ok || c.Plan != "pro" {
+		t.Fatalf("expected *appClaims, got %T", custom)
+	}
+
+	// standard validation and claim mapping apply to typed claims too
+	mapped := NewTypedVerifier[appClaims](Verifier{KeyFunc: keyFunc, Config: VerifyConfig{Claims: ClaimMapping{TenantID: "org"}}})
+	got, err = mapped.VerifyTyped(context.Background(), sign(jwt.MapClaims{"sub": "u1", "org": "t9", "plan": "free"}))
+	if err != nil || got.TenantID != "t9" || got.Plan != "free" {
+		t.Fatalf("claims=%+v err=%v", got, err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", sign(jwt.MapClaims{"sub": "u1", "tenant_id": "t1", "exp": time.Now().Add(-time.Hour).Unix()}), ErrTokenExpired},
+		{"missing tenant", sign(jwt.MapClaims{"sub": "u1"}), ErrMissingTenantID},
+		{"wrong claim type", sign(jwt.MapClaims{"sub": "u1", "tenant_id": "t1", "plan": 3}), ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		if _, err := v.VerifyContext(context.Background(), tt.token); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if _, err := v.VerifyCustom(context.Background(), tt.token); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
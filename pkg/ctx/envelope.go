@@ -0,0 +1,212 @@
+package ctx
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EnvelopeVersion is the version written by Seal and accepted by ParseEnvelope.
+const EnvelopeVersion = 1
+
+var (
+	// ErrInvalidEnvelope indicates a malformed, unsupported or tampered envelope.
+	ErrInvalidEnvelope = errors.New("ctx: invalid envelope")
+
+	// ErrEnvelopeExpired indicates an envelope older than the accepted max age, or dated
+	// in the future. It wraps ErrInvalidEnvelope.
+	ErrEnvelopeExpired = fmt.Errorf("%w: expired", ErrInvalidEnvelope)
+)
+
+const (
+	// minEnvelopeKey is the minimum HMAC key length in bytes.
+	minEnvelopeKey = 32
+
+	// envelopeSkew tolerates producer clocks running ahead of the consumer.
+	envelopeSkew = time.Minute
+)
+
+// Envelope is the portable request identity carried across async boundaries, e.g. in a
+// message header or a JSON field of an enqueued job or published event.
+type Envelope struct {
+	Version      int      `json:"v"`
+	RequestID    string   `json:"rid,omitempty"`
+	TenantID     string   `json:"tid,omitempty"`
+	SubjectID    string   `json:"sub,omitempty"`
+	Scopes       []string `json:"scp,omitempty"`
+	Actors       []string `json:"act,omitempty"`
+	Impersonator string   `json:"imp,omitempty"`
+
+	// TraceParent and TraceState are the W3C trace context of the producing span.
+	TraceParent string `json:"tp,omitempty"`
+	TraceState  string `json:"ts,omitempty"`
+
+	// IssuedAt is when the envelope was created, in unix seconds.
+	IssuedAt int64 `json:"iat"`
+}
+
+// NewEnvelope captures request_id, tenant_id, subject_id, scopes, actors, impersonator
+// and the current span context of ctx.
+func NewEnvelope(ctx context.Context) Envelope {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	env := Envelope{
+		Version:      EnvelopeVersion,
+		RequestID:    RequestID(ctx),
+		TenantID:     TenantID(ctx),
+		SubjectID:    SubjectID(ctx),
+		Scopes:       Scopes(ctx),
+		Actors:       Actors(ctx),
+		Impersonator: Impersonator(ctx),
+		IssuedAt:     time.Now().Unix(),
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	env.TraceParent = carrier.Get("traceparent")
+	env.TraceState = carrier.Get("tracestate")
+	return env
+}
+
+// Seal encodes and signs env with HMAC-SHA256 as "v1.<payload>.<signature>" (base64url),
+// safe for message headers and JSON strings. key must be at least 32 bytes.
+func (env Envelope) Seal(key []byte) (string, error) {
+	if len(key) < minEnvelopeKey {
+		return "", fmt.Errorf("ctx: envelope key must be at least %d bytes", minEnvelopeKey)
+	}
+	env.Version = EnvelopeVersion
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return "", fmt.Errorf("ctx: encode envelope: %w", err)
+	}
+	signed := fmt.Sprintf("v%d.%s", EnvelopeVersion, base64.RawURLEncoding.EncodeToString(payload))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(envelopeMAC(key, signed)), nil
+}
+
+// SealEnvelope is NewEnvelope(ctx).Seal(key).
+func SealEnvelope(ctx context.Context, key []byte) (string, error) {
+	return NewEnvelope(ctx).Seal(key)
+}
+
+// ParseEnvelope verifies sealed against keys (the current key first, then previous keys
+// during rotation) and decodes it. Any failure is ErrInvalidEnvelope.
+//
+// maxAge bounds how long ago the envelope may have been sealed, so a leaked envelope
+// cannot be replayed indefinitely; size it to the longest expected queue delay including
+// retries. Envelopes older than maxAge, or issued more than a minute in the future, are
+// ErrEnvelopeExpired. maxAge must be positive.
+func ParseEnvelope(sealed string, maxAge time.Duration, keys ...[]byte) (Envelope, error) {
+	if maxAge <= 0 {
+		return Envelope{}, errors.New("ctx: envelope max age must be positive")
+	}
+	signed, sig, ok := cutLast(strings.TrimSpace(sealed), ".")
+	if !ok {
+		return Envelope{}, ErrInvalidEnvelope
+	}
+	version, payload, ok := strings.Cut(signed, ".")
+	if !ok || version != fmt.Sprintf("v%d", EnvelopeVersion) {
+		return Envelope{}, ErrInvalidEnvelope
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return Envelope{}, ErrInvalidEnvelope
+	}
+
+	verified := false
+	for _, key := range keys {
+		if len(key) >= minEnvelopeKey && hmac.Equal(mac, envelopeMAC(key, signed)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return Envelope{}, ErrInvalidEnvelope
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Envelope{}, ErrInvalidEnvelope
+	}
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil || env.Version != EnvelopeVersion || env.IssuedAt <= 0 {
+		return Envelope{}, ErrInvalidEnvelope
+	}
+
+	issued := time.Unix(env.IssuedAt, 0)
+	now := time.Now()
+	if now.Sub(issued) > maxAge || issued.Sub(now) > envelopeSkew {
+		return Envelope{}, ErrEnvelopeExpired
+	}
+	return env, nil
+}
+
+// Context restores env on top of parent, detached from parent's cancellation and
+// deadline (context.WithoutCancel): the consumer decides how long the work may run.
+//
+// Identity values of parent are replaced, not merged; claims and memberships are not
+// carried and are cleared. The producing span becomes the remote parent, so spans
+// started from the result continue the original trace.
+func (env Envelope) Context(parent context.Context) context.Context {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx := context.WithoutCancel(parent)
+
+	ctx = context.WithValue(ctx, keyRequestID, env.RequestID)
+	ctx = context.WithValue(ctx, keyTenantID, env.TenantID)
+	ctx = context.WithValue(ctx, keySubjectID, env.SubjectID)
+	ctx = context.WithValue(ctx, keyScopes, append([]string(nil), env.Scopes...))
+	ctx = context.WithValue(ctx, keyActors, append([]string(nil), env.Actors...))
+	ctx = context.WithValue(ctx, keyImpersonator, env.Impersonator)
+	ctx = context.WithValue(ctx, keyMemberships, []Membership(nil))
+	ctx = context.WithValue(ctx, keyClaims, nil)
+
+	// the producer's span replaces any span of the consumer's parent
+	return trace.ContextWithRemoteSpanContext(ctx, env.SpanContext())
+}
+
+// SpanContext returns the producing span context (remote), or an invalid one if env
+// carries no trace. Use it for a trace.Link when the consumer starts its own trace.
+func (env Envelope) SpanContext() trace.SpanContext {
+	if env.TraceParent == "" {
+		return trace.SpanContext{}
+	}
+	carrier := propagation.MapCarrier{"traceparent": env.TraceParent}
+	if env.TraceState != "" {
+		carrier["tracestate"] = env.TraceState
+	}
+	return trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+}
+
+// OpenEnvelope is ParseEnvelope followed by Context.
+func OpenEnvelope(parent context.Context, sealed string, maxAge time.Duration, keys ...[]byte) (context.Context, error) {
+	env, err := ParseEnvelope(sealed, maxAge, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return env.Context(parent), nil
+}
+
+func envelopeMAC(key []byte, signed string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(signed))
+	return m.Sum(nil)
+}
+
+func cutLast(s, sep string) (before, after string, ok bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
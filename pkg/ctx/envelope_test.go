@@ -0,0 +1,209 @@
+package ctx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	key := []byte(strings.Repeat("k", 32))
+	oldKey := []byte(strings.Repeat("o", 32))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	state, _ := trace.ParseTraceState("vendor=abc")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+	})
+
+	producer, cancel := context.WithCancel(context.Background())
+	producer = trace.ContextWithSpanContext(producer, sc)
+	producer = WithRequestID(producer, "r1")
+	producer = WithTenantID(producer, "t1")
+	producer = WithSubjectID(producer, "u1")
+	producer = WithScopes(producer, []string{"orders:read", "orders:write"})
+	producer = WithActors(producer, []string{"svc-a"})
+	producer = WithImpersonator(producer, "staff-1")
+
+	sealed, err := SealEnvelope(producer, oldKey)
+	if err != nil {
+		t.Fatalf("SealEnvelope: %v", err)
+	}
+	if strings.ContainsAny(sealed, " \r\n\",;") || !strings.HasPrefix(sealed, "v1.") {
+		t.Fatalf("envelope not header-safe: %q", sealed)
+	}
+	cancel()
+
+	// the consumer's own values must not leak into the restored identity
+	consumer := WithMemberships(WithTenantID(context.Background(), "other"), []Membership{{TenantID: "other"}})
+	consumer = WithClaims(consumer, "claims")
+
+	ctx, err := OpenEnvelope(producer, sealed, time.Hour, key, oldKey)
+	if err != nil {
+		t.Fatalf("OpenEnvelope: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("restored context must be detached from cancellation, got %v", ctx.Err())
+	}
+	if RequestID(ctx) != "r1" || TenantID(ctx) != "t1" || SubjectID(ctx) != "u1" || Impersonator(ctx) != "staff-1" {
+		t.Fatalf("identity not restored")
+	}
+	if !reflect.DeepEqual(Scopes(ctx), []string{"orders:read", "orders:write"}) || !reflect.DeepEqual(Actors(ctx), []string{"svc-a"}) {
+		t.Fatalf("scopes/actors not restored: %v %v", Scopes(ctx), Actors(ctx))
+	}
+	got := trace.SpanContextFromContext(ctx)
+	if got.TraceID() != traceID || got.SpanID() != spanID || !got.IsRemote() || !got.IsSampled() ||
+		got.TraceState().Get("vendor") != "abc" {
+		t.Fatalf("trace not restored: %+v", got)
+	}
+
+	ctx, err = OpenEnvelope(consumer, sealed, time.Hour, oldKey)
+	if err != nil {
+		t.Fatalf("OpenEnvelope: %v", err)
+	}
+	if TenantID(ctx) != "t1" || len(Memberships(ctx)) != 0 {
+		t.Fatalf("consumer identity leaked: %q %v", TenantID(ctx), Memberships(ctx))
+	}
+	if _, ok := Claims[string](ctx); ok {
+		t.Fatalf("consumer claims leaked")
+	}
+}
+
+func TestEnvelope_Empty(t *testing.T) {
+	t.Parallel()
+
+	key := []byte(strings.Repeat("k", 32))
+	var nilCtx context.Context
+	sealed, err := SealEnvelope(nilCtx, key)
+	if err != nil {
+		t.Fatalf("SealEnvelope: %v", err)
+	}
+
+	parent := WithSubjectID(context.Background(), "consumer")
+	parent = trace.ContextWithSpanContext(parent, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1},
+	}))
+	env, err := ParseEnvelope(sealed, time.Hour, key)
+	if err != nil {
+		t.Fatalf("ParseEnvelope: %v", err)
+	}
+	if env.IssuedAt < time.Now().Add(-time.Minute).Unix() {
+		t.Fatalf("unexpected IssuedAt %d", env.IssuedAt)
+	}
+	ctx := env.Context(parent)
+	if SubjectID(ctx) != "" || Scopes(ctx) != nil || trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatalf("expected empty identity and no trace")
+	}
+	if env.Context(nilCtx) == nil {
+		t.Fatalf("expected non-nil context")
+	}
+}
+
+func TestEnvelope_Invalid(t *testing.T) {
+	t.Parallel()
+
+	key := []byte(strings.Repeat("k", 32))
+	if _, err := SealEnvelope(context.Background(), []byte("short")); err == nil {
+		t.Fatalf("expected error for short key")
+	}
+
+	sealed, err := SealEnvelope(WithTenantID(context.Background(), "t1"), key)
+	if err != nil {
+		t.Fatalf("SealEnvelope: %v", err)
+	}
+	forged, _ := Envelope{TenantID: "t2"}.Seal([]byte(strings.Repeat("x", 32)))
+	version, rest, _ := strings.Cut(sealed, ".")
+	payload, sig, _ := strings.Cut(rest, ".")
+	_, forgedRest, _ := strings.Cut(forged, ".")
+	forgedPayload, _, _ := strings.Cut(forgedRest, ".")
+
+	cases := map[string]string{
+		"empty":            "",
+		"no signature":     "v1",
+		"wrong key":        forged,
+		"swapped payload":  version + "." + forgedPayload + "." + sig,
+		"future version":   "v2." + payload + "." + sig,
+		"bad signature":    version + "." + payload + ".%%%",
+		"truncated":        sealed[:len(sealed)-4],
+		"no version":       payload + "." + sig,
+		"garbage payload":  "v1.!!!." + sig,
+		"only short key":   sealed,
+		"missing key list": sealed,
+	}
+	for name, s := range cases {
+		keys := [][]byte{key}
+		switch name {
+		case "only short key":
+			keys = [][]byte{[]byte("short")}
+		case "missing key list":
+			keys = nil
+		}
+		if _, err := ParseEnvelope(s, time.Hour, keys...); !errors.Is(err, ErrInvalidEnvelope) {
+			t.Fatalf("%s: expected ErrInvalidEnvelope, got %v", name, err)
+		}
+	}
+	if _, err := OpenEnvelope(context.Background(), forged, time.Hour, key); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Fatalf("expected ErrInvalidEnvelope, got %v", err)
+	}
+}
+
+func TestEnvelope_Age(t *testing.T) {
+	t.Parallel()
+
+	key := []byte(strings.Repeat("k", 32))
+	now := time.Now()
+	sealedAt := func(issued time.Time) string {
+		t.Helper()
+		sealed, err := Envelope{TenantID: "t1", IssuedAt: issued.Unix()}.Seal(key)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		return sealed
+	}
+
+	tests := []struct {
+		name    string
+		sealed  string
+		maxAge  time.Duration
+		wantErr error
+	}{
+		{"fresh", sealedAt(now), time.Minute, nil},
+		{"within max age", sealedAt(now.Add(-50 * time.Minute)), time.Hour, nil},
+		{"within skew", sealedAt(now.Add(30 * time.Second)), time.Minute, nil},
+		{"expired", sealedAt(now.Add(-2 * time.Hour)), time.Hour, ErrEnvelopeExpired},
+		{"future", sealedAt(now.Add(10 * time.Minute)), time.Hour, ErrEnvelopeExpired},
+		{"no issued at", sealedAt(time.Unix(0, 0)), time.Hour, ErrInvalidEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEnvelope(tt.sealed, tt.maxAge, key)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("ParseEnvelope: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if !errors.Is(ErrEnvelopeExpired, ErrInvalidEnvelope) {
+		t.Fatalf("ErrEnvelopeExpired must wrap ErrInvalidEnvelope")
+	}
+	if _, err := ParseEnvelope(sealedAt(now), 0, key); err == nil || errors.Is(err, ErrInvalidEnvelope) {
+		t.Fatalf("expected configuration error for zero max age, got %v", err)
+	}
+	if _, err := OpenEnvelope(context.Background(), sealedAt(now.Add(-2*time.Hour)), time.Hour, key); !errors.Is(err, ErrEnvelopeExpired) {
+		t.Fatalf("expected ErrEnvelopeExpired, got %v", err)
+	}
+}
@@ -11,6 +11,12 @@ const (
 	// Auth / identity
 	keySubjectID key = "subject_id" // user/service id (sub)
 	keyScopes    key = "scopes"     // []string
+	keyActors    key = "actors"     // []string, RFC 8693 actor chain (current actor first)
+
+	keyImpersonator key = "impersonator" // real subject acting as subject_id (support impersonation)
+
+	// Tenancy
+	keyMemberships key = "memberships" // []Membership
 
 	// Optional: keep it lean; do not store large/untrusted payloads
 	keyClaims key = "claims"
@@ -112,6 +112,18 @@ func WithScopes(ctx context.Context, scopes []string) context.Context {
 	return context.WithValue(ctx, keyScopes, cp)
 }
 
+// ReplaceScopes returns a derived context whose scopes are exactly scopes.
+//
+// Unlike WithScopes, empty scopes clear the scopes set by an outer layer, e.g. when a
+// request switches tenants or is impersonated. The slice is copied on write.
+// Defensive behavior: if ctx is nil, it is treated as context.Background().
+func ReplaceScopes(ctx context.Context, scopes []string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, keyScopes, append([]string(nil), scopes...))
+}
+
 // Scopes returns the scopes stored in ctx.
 //
 // The returned slice is a copy to prevent caller mutation.
@@ -131,6 +143,162 @@ func Scopes(ctx context.Context) []string {
 	return cp
 }
 
+// WithActors returns a derived context carrying the delegation chain: the services acting
+// on behalf of subject_id, current actor first. subject_id stays the effective subject.
+//
+// The slice is copied on write to prevent caller mutation.
+// Defensive behavior: if ctx is nil, it is treated as context.Background().
+// Empty actors is ignored (ctx returned unchanged).
+func WithActors(ctx context.Context, actors []string) context.Context {
+	if len(actors) == 0 {
+		if ctx == nil {
+			return context.Background()
+		}
+		return ctx
+	}
+
+	cp := make([]string, len(actors))
+	copy(cp, actors)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, keyActors, cp)
+}
+
+// Actors returns the actor chain stored in ctx (current actor first), or nil if the
+// request is not delegated. The returned slice is a copy.
+func Actors(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	v, ok := ctx.Value(keyActors).([]string)
+	if !ok || len(v) == 0 {
+		return nil
+	}
+
+	cp := make([]string, len(v))
+	copy(cp, v)
+	return cp
+}
+
+// Actor returns the current actor (the service calling on behalf of subject_id),
+// or empty string if the request is not delegated.
+func Actor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	v, ok := ctx.Value(keyActors).([]string)
+	if !ok || len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// WithImpersonator returns a derived context recording that impersonator (e.g. a support
+// engineer) is acting as subject_id. subject_id stays the impersonated user.
+//
+// Defensive behavior: if ctx is nil, it is treated as context.Background().
+// Empty impersonator is ignored (ctx returned unchanged).
+func WithImpersonator(ctx context.Context, impersonator string) context.Context {
+	if impersonator == "" {
+		if ctx == nil {
+			return context.Background()
+		}
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, keyImpersonator, impersonator)
+}
+
+// Impersonator returns the real subject behind an impersonated request, or empty string
+// if the request is not impersonated.
+func Impersonator(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	v, ok := ctx.Value(keyImpersonator).(string)
+	if !ok {
+		return ""
+	}
+	return v
+}
+
+// Membership is the subject's membership in one tenant, with tenant-specific roles and scopes.
+type Membership struct {
+	TenantID string
+	Roles    []string
+	Scopes   []string
+}
+
+// WithMemberships returns a derived context carrying the tenants the subject belongs to.
+//
+// The memberships are copied on write to prevent caller mutation.
+// Defensive behavior: if ctx is nil, it is treated as context.Background().
+// Empty memberships is ignored (ctx returned unchanged).
+func WithMemberships(ctx context.Context, memberships []Membership) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(memberships) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, keyMemberships, cloneMemberships(memberships))
+}
+
+// ReplaceMemberships returns a derived context whose memberships are exactly memberships.
+// Unlike WithMemberships, empty memberships clear those set by an outer layer.
+// Defensive behavior: if ctx is nil, it is treated as context.Background().
+func ReplaceMemberships(ctx context.Context, memberships []Membership) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, keyMemberships, cloneMemberships(memberships))
+}
+
+// Memberships returns the memberships stored in ctx, or nil if not set.
+// The returned slice is a copy.
+func Memberships(ctx context.Context) []Membership {
+	if ctx == nil {
+		return nil
+	}
+	v, ok := ctx.Value(keyMemberships).([]Membership)
+	if !ok || len(v) == 0 {
+		return nil
+	}
+	return cloneMemberships(v)
+}
+
+// CurrentMembership returns the membership for the tenant_id stored in ctx, e.g. to read
+// the subject's roles in the selected tenant.
+func CurrentMembership(ctx context.Context) (Membership, bool) {
+	tid := TenantID(ctx)
+	if tid == "" {
+		return Membership{}, false
+	}
+	v, _ := ctx.Value(keyMemberships).([]Membership)
+	for _, m := range v {
+		if m.TenantID == tid {
+			return cloneMemberships([]Membership{m})[0], true
+		}
+	}
+	return Membership{}, false
+}
+
+func cloneMemberships(in []Membership) []Membership {
+	out := make([]Membership, len(in))
+	for i, m := range in {
+		out[i] = Membership{
+			TenantID: m.TenantID,
+			Roles:    append([]string(nil), m.Roles...),
+			Scopes:   append([]string(nil), m.Scopes...),
+		}
+	}
+	return out
+}
+
 // WithClaims stores arbitrary claims in context. Use sparingly.
 // Defensive behavior: if ctx is nil, it is treated as context.Background().
 func WithClaims[T any](ctx context.Context, claims T) context.Context {
@@ -87,6 +87,41 @@ func TestSubjectID(t *testing.T) {
 	}
 }
 
+func TestReplaceScopes(t *testing.T) {
+	t.Parallel()
+
+	in := []string{"a"}
+	ctx := ReplaceScopes(WithScopes(context.Background(), []string{"x", "y"}), in)
+	in[0] = "z"
+	if got := Scopes(ctx); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("Scopes()=%v, want [a]", got)
+	}
+
+	// unlike WithScopes, empty scopes clear outer scopes
+	if got := Scopes(ReplaceScopes(ctx, nil)); got != nil {
+		t.Fatalf("Scopes() after clear=%v, want nil", got)
+	}
+
+	var nilCtx context.Context
+	if got := Scopes(ReplaceScopes(nilCtx, []string{"b"})); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("Scopes(nil ctx)=%v", got)
+	}
+}
+
+func TestReplaceMemberships(t *testing.T) {
+	t.Parallel()
+
+	ctx := WithMemberships(context.Background(), []Membership{{TenantID: "t1"}})
+	if got := Memberships(ReplaceMemberships(ctx, nil)); got != nil {
+		t.Fatalf("Memberships() after clear=%v, want nil", got)
+	}
+	var nilCtx context.Context
+	got := Memberships(ReplaceMemberships(nilCtx, []Membership{{TenantID: "t2"}}))
+	if len(got) != 1 || got[0].TenantID != "t2" {
+		t.Fatalf("Memberships()=%v", got)
+	}
+}
+
 func TestScopes_CopyOnWrite_And_CopyOnRead(t *testing.T) {
 	t.Parallel()
 
@@ -120,6 +155,94 @@ func TestScopes_CopyOnWrite_And_CopyOnRead(t *testing.T) {
 	}
 }
 
+func TestActors(t *testing.T) {
+	t.Parallel()
+
+	in := []string{"svc-payments", "svc-orders"}
+	ctx1 := WithActors(context.Background(), in)
+	in[0] = "x"
+
+	if got := Actors(ctx1); !reflect.DeepEqual(got, []string{"svc-payments", "svc-orders"}) {
+		t.Fatalf("Actors()=%v", got)
+	}
+	if got := Actor(ctx1); got != "svc-payments" {
+		t.Fatalf("Actor()=%q, want svc-payments", got)
+	}
+
+	got := Actors(ctx1)
+	got[0] = "y"
+	if Actor(ctx1) != "svc-payments" {
+		t.Fatalf("Actors() must return a copy")
+	}
+
+	var nilCtx context.Context
+	if Actors(WithActors(nilCtx, nil)) != nil || Actor(nilCtx) != "" || Actors(nilCtx) != nil {
+		t.Fatalf("expected empty actors")
+	}
+	if Actor(context.TODO()) != "" {
+		t.Fatalf("Actor(TODO) should be empty")
+	}
+}
+
+func TestImpersonator(t *testing.T) {
+	t.Parallel()
+
+	ctx := WithImpersonator(context.Background(), "support-1")
+	if got := Impersonator(ctx); got != "support-1" {
+		t.Fatalf("Impersonator()=%q", got)
+	}
+	if Impersonator(WithImpersonator(context.Background(), "")) != "" {
+		t.Fatalf("empty impersonator must be ignored")
+	}
+
+	var nilCtx context.Context
+	if Impersonator(nilCtx) != "" || Impersonator(WithImpersonator(nilCtx, "")) != "" {
+		t.Fatalf("expected empty impersonator")
+	}
+	if Impersonator(WithImpersonator(nilCtx, "x")) != "x" {
+		t.Fatalf("expected impersonator on nil ctx")
+	}
+}
+
+func TestMemberships(t *testing.T) {
+	t.Parallel()
+
+	in := []Membership{
+		{TenantID: "t1", Roles: []string{"admin"}, Scopes: []string{"orders:*"}},
+		{TenantID: "t2", Roles: []string{"viewer"}},
+	}
+	ctx1 := WithMemberships(context.Background(), in)
+	in[0].Roles[0] = "x"
+
+	got := Memberships(ctx1)
+	if len(got) != 2 || got[0].Roles[0] != "admin" || got[1].Scopes != nil {
+		t.Fatalf("Memberships()=%+v", got)
+	}
+	got[0].Scopes[0] = "y"
+	if Memberships(ctx1)[0].Scopes[0] != "orders:*" {
+		t.Fatalf("Memberships() must return a copy")
+	}
+
+	if _, ok := CurrentMembership(ctx1); ok {
+		t.Fatalf("expected no current membership without tenant_id")
+	}
+	m, ok := CurrentMembership(WithTenantID(ctx1, "t2"))
+	if !ok || m.TenantID != "t2" || m.Roles[0] != "viewer" {
+		t.Fatalf("CurrentMembership()=%+v, %v", m, ok)
+	}
+	if _, ok := CurrentMembership(WithTenantID(ctx1, "t3")); ok {
+		t.Fatalf("expected no membership for t3")
+	}
+
+	var nilCtx context.Context
+	if Memberships(WithMemberships(nilCtx, nil)) != nil || Memberships(nilCtx) != nil {
+		t.Fatalf("expected empty memberships")
+	}
+	if _, ok := CurrentMembership(nilCtx); ok {
+		t.Fatalf("expected no membership for nil ctx")
+	}
+}
+
 func TestClaims_Generic(t *testing.T) {
 	t.Parallel()
 
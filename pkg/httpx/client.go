@@ -26,6 +26,16 @@ type ClientConfig struct {
 	Transport http.RoundTripper
 
 	DisableRequestIDPropagation bool
+
+	// TokenSource optionally authenticates every request with a bearer token
+	// (e.g. auth.ClientCredentials). A 401 response is retried once with a fresh token.
+	// Requests that already carry an Authorization header are sent unchanged.
+	TokenSource TokenSource
+
+	// TokenHosts lists the hosts that receive the TokenSource token, as "host" (any port)
+	// or "host:port". Requests to other hosts, including redirects, are sent without it.
+	// Required with TokenSource.
+	TokenHosts []string
 }
 
 func NewClient(cfg ClientConfig) *http.Client {
@@ -43,6 +53,12 @@ func NewClient(cfg ClientConfig) *http.Client {
 	}
 
 	rt := cfg.Transport
+	if cfg.TokenSource != nil {
+		if len(cfg.TokenHosts) == 0 {
+			panic("httpx.NewClient requires TokenHosts when TokenSource is set")
+		}
+		rt = &bearerTransport{base: rt, src: cfg.TokenSource, hosts: cfg.TokenHosts}
+	}
 	if !cfg.DisableRequestIDPropagation {
 		rt = &requestIDTransport{base: rt}
 	}
@@ -0,0 +1,90 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenSource supplies bearer tokens for outgoing requests, e.g. auth.ClientCredentials.
+type TokenSource interface {
+	// Token returns a currently valid access token.
+	Token(ctx context.Context) (string, error)
+
+	// Invalidate drops token from any cache after the server rejected it.
+	Invalidate(token string)
+}
+
+// maxDrainOnRetry bounds how much of a rejected response is read to reuse the connection.
+const maxDrainOnRetry = 4 << 10
+
+// bearerTransport sets Authorization from a TokenSource on requests to hosts and
+// retries once on 401.
+type bearerTransport struct {
+	base  http.RoundTripper
+	src   TokenSource
+	hosts []string
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// An explicit Authorization header always wins; other hosts (e.g. a cross-host
+	// redirect, which net/http already stripped) never see the token.
+	if r.Header.Get("Authorization") != "" || !t.allowed(r.URL) {
+		return t.base.RoundTrip(r)
+	}
+
+	tok, err := t.src.Token(r.Context())
+	if err != nil {
+		// RoundTrip must close the request body, even on errors.
+		if r.Body != nil {
+			_ = r.Body.Close()
+		}
+		return nil, fmt.Errorf("httpx: token source: %w", err)
+	}
+	resp, err := t.base.RoundTrip(withBearer(r, tok))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The token may have been revoked or rotated early: drop it, then retry once with a
+	// fresh one, but only if the body can be replayed.
+	t.src.Invalidate(tok)
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return resp, nil
+	}
+	fresh, err := t.src.Token(r.Context())
+	if err != nil || fresh == tok {
+		return resp, nil
+	}
+
+	r2 := withBearer(r, fresh)
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		r2.Body = body
+	}
+	_, _ = io.CopyN(io.Discard, resp.Body, maxDrainOnRetry)
+	_ = resp.Body.Close()
+	return t.base.RoundTrip(r2)
+}
+
+func (t *bearerTransport) allowed(u *url.URL) bool {
+	for _, h := range t.hosts {
+		if strings.EqualFold(h, u.Host) || strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func withBearer(r *http.Request, token string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.Header = cloneHeader(r.Header)
+	r2.Header.Set("Authorization", "Bearer "+token)
+	return r2
+}
@@ -0,0 +1,243 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// rotatingSource hands out tok-1, tok-2, ... and moves on after Invalidate.
+type rotatingSource struct {
+	mu          sync.Mutex
+	n           int
+	invalidated []string
+	err         error
+}
+
+func (s *rotatingSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return "", s.err
+	}
+	if s.n == 0 {
+		s.n = 1
+	}
+	return "tok-" + strconv.Itoa(s.n), nil
+}
+
+func (s *rotatingSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidated = append(s.invalidated, token)
+	s.n++
+}
+
+func TestClient_TokenSource(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization")+"|"+string(body))
+		mu.Unlock()
+		// only tok-2 and an explicit token are accepted
+		switch r.Header.Get("Authorization") {
+		case "Bearer tok-2", "Bearer explicit":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		req      func() *http.Request
+		want     int
+		wantSeen []string
+		wantDrop []string
+	}{
+		{
+			name:     "retry once with fresh token",
+			req:      func() *http.Request { r, _ := http.NewRequest(http.MethodGet, srv.URL, nil); return r },
+			want:     200,
+			wantSeen: []string{"Bearer tok-1|", "Bearer tok-2|"},
+			wantDrop: []string{"tok-1"},
+		},
+		{
+			name: "replayable body is resent",
+			req: func() *http.Request {
+				r, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("x"))
+				return r
+			},
+			want:     200,
+			wantSeen: []string{"Bearer tok-1|x", "Bearer tok-2|x"},
+			wantDrop: []string{"tok-1"},
+		},
+		{
+			name: "non-replayable body is not retried",
+			req: func() *http.Request {
+				r, _ := http.NewRequest(http.MethodPost, srv.URL, io.NopCloser(strings.NewReader("x")))
+				return r
+			},
+			want:     401,
+			wantSeen: []string{"Bearer tok-1|x"},
+			wantDrop: []string{"tok-1"},
+		},
+		{
+			name: "explicit authorization wins",
+			req: func() *http.Request {
+				r, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+				r.Header.Set("Authorization", "Bearer explicit")
+				return r
+			},
+			want:     200,
+			wantSeen: []string{"Bearer explicit|"},
+		},
+	}
+
+	for _, tt := range tests {
+		mu.Lock()
+		seen = nil
+		mu.Unlock()
+
+		src := &rotatingSource{}
+		client := NewClient(ClientConfig{TokenSource: src, TokenHosts: []string{hostOf(srv.URL)}})
+		resp, err := client.Do(tt.req())
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Fatalf("%s: status=%d want %d", tt.name, resp.StatusCode, tt.want)
+		}
+		mu.Lock()
+		got := strings.Join(seen, ",")
+		mu.Unlock()
+		if got != strings.Join(tt.wantSeen, ",") {
+			t.Fatalf("%s: seen=%q want %q", tt.name, got, tt.wantSeen)
+		}
+		if got := strings.Join(src.invalidated, ","); got != strings.Join(tt.wantDrop, ",") {
+			t.Fatalf("%s: invalidated=%q want %q", tt.name, got, tt.wantDrop)
+		}
+	}
+}
+
+func TestClient_TokenSource_Errors(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	src := &rotatingSource{err: errors.New("idp down")}
+	client := NewClient(ClientConfig{TokenSource: src, TokenHosts: []string{hostOf(srv.URL)}})
+	if _, err := client.Get(srv.URL); err == nil || !strings.Contains(err.Error(), "idp down") {
+		t.Fatalf("expected token source error, got %v", err)
+	}
+
+	// the request body is closed when no token can be obtained
+	body := &closeRecorder{Reader: strings.NewReader("x")}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, body)
+	tr := &bearerTransport{base: http.DefaultTransport, src: src, hosts: []string{hostOf(srv.URL)}}
+	if _, err := tr.RoundTrip(req); err == nil || !body.closed {
+		t.Fatalf("expected error and closed body, got %v closed=%v", err, body.closed)
+	}
+
+	// a source that keeps returning the same token is not retried
+	same := &staticSource{tok: "same"}
+	client = NewClient(ClientConfig{TokenSource: same, TokenHosts: []string{hostOf(srv.URL)}})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || same.invalidated != 1 {
+		t.Fatalf("status=%d invalidated=%d", resp.StatusCode, same.invalidated)
+	}
+}
+
+type staticSource struct {
+	tok         string
+	invalidated int
+}
+
+func (s *staticSource) Token(ctx context.Context) (string, error) { return s.tok, nil }
+func (s *staticSource) Invalidate(token string)                   { s.invalidated++ }
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error { c.closed = true; return nil }
+
+func TestClient_TokenSource_OtherHosts(t *testing.T) {
+	t.Parallel()
+
+	var thirdPartyAuth atomic.Value
+	thirdParty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		thirdPartyAuth.Store(r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer thirdParty.Close()
+	// a different host name, not just a different port
+	elsewhere := strings.Replace(thirdParty.URL, "127.0.0.1", "localhost", 1)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, elsewhere+"/callback", http.StatusFound)
+	}))
+	defer api.Close()
+
+	client := NewClient(ClientConfig{TokenSource: &rotatingSource{}, TokenHosts: []string{hostOf(api.URL)}})
+	resp, err := client.Get(api.URL)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status=%d", resp.StatusCode)
+	}
+	if got, _ := thirdPartyAuth.Load().(string); got != "" {
+		t.Fatalf("token leaked to redirect target: %q", got)
+	}
+
+	// direct requests to other hosts are not authenticated either
+	thirdPartyAuth.Store("")
+	resp, err = client.Get(thirdParty.URL)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	_ = resp.Body.Close()
+	if got, _ := thirdPartyAuth.Load().(string); got != "" {
+		t.Fatalf("token sent to unlisted host: %q", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic without TokenHosts")
+		}
+	}()
+	NewClient(ClientConfig{TokenSource: &rotatingSource{}})
+}
+
+func hostOf(rawURL string) string {
+	u, _ := url.Parse(rawURL)
+	return u.Host
+}
@@ -47,6 +47,12 @@ func (l *Logger) With(ctx context.Context) *slog.Logger {
 	if sid := wsctx.SubjectID(ctx); sid != "" {
 		attrs = append(attrs, slog.String("subject_id", sid))
 	}
+	if actors := wsctx.Actors(ctx); len(actors) > 0 {
+		attrs = append(attrs, slog.Any("actors", actors))
+	}
+	if imp := wsctx.Impersonator(ctx); imp != "" {
+		attrs = append(attrs, slog.String("impersonator_id", imp))
+	}
 
 	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
 		attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
@@ -1,84 +1,507 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
 	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
 	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+	wslog "github.com/hanzy-dev/saas-ws-lib/pkg/log"
 )
 
-const HeaderAuthorization = "Authorization"
+const (
+	HeaderAuthorization = "Authorization"
+	HeaderAPIKey        = "X-API-Key"
+)
 
 type AuthConfig struct {
-	Verifier *auth.Verifier
+	// Verifier authenticates Bearer tokens, e.g. *auth.Verifier, *auth.MultiVerifier, or
+	// *auth.Introspector for opaque tokens.
+	// With an auth.CustomClaimsVerifier (auth.TypedVerifier) the full custom claims are
+	// stored in the context. A typed nil (e.g. a nil *auth.Verifier) panics in Auth.
+	Verifier auth.TokenVerifier
+
+	// APIKeys optionally authenticates API keys (see auth.APIKeyPrefix), sent either as
+	// "Authorization: Bearer wsk_..." or in the X-API-Key header.
+	//
+	// Precedence: the Authorization header always wins; X-API-Key is only consulted when
+	// Authorization is absent. A Bearer credential with the API key prefix is verified as
+	// an API key, anything else as a JWT. There is no fallback after a failed credential.
+	APIKeys *auth.APIKeyVerifier
+
+	// Sessions optionally authenticates browser requests by session cookie (see
+	// SessionManager). The cookie is only consulted when neither Authorization nor
+	// X-API-Key is sent. State-changing requests must carry the session's CSRF token.
+	Sessions *SessionManager
 
 	// RequireScopes enforces that the authenticated principal has all listed scopes.
+	// Granted scopes may use wildcards (see auth.Scope). They are the token scopes; for
+	// per-tenant membership scopes use TenantConfig.RequireScopes.
 	RequireScopes []auth.Scope
 
+	// ScopeImplications optionally expands granted actions, e.g. write implies read.
+	ScopeImplications auth.ScopeImplications
+
+	// StepUp optionally requires a strong and recent user authentication (acr, amr,
+	// auth_time), e.g. MFA within 5 minutes for changing payout details. Unmet requirements
+	// are UNAUTHENTICATED with an RFC 9470 `insufficient_user_authentication` challenge.
+	StepUp auth.StepUp
+
 	// Policy optionally performs an external policy check.
-	// If Policy is set, Action and Resource must be non-empty stable strings.
+	// If Policy is set, Action and Resource must be non-empty stable strings, or be
+	// derived per request by ActionFunc and ResourceFunc.
+	// The check uses the token tenant (tenant_id claim), or the impersonated tenant with
+	// Impersonation; a tenant selected afterwards by Tenant in TenantSelect mode is not
+	// re-authorized by Auth.
 	Policy   auth.PolicyChecker
 	Action   string
 	Resource string
+
+	// ActionFunc and ResourceFunc optionally derive the action and resource from the
+	// authenticated request, e.g. MethodAction or ResourceTemplate("tenant/{tenant}/orders/{id}"),
+	// and take precedence over Action and Resource. A *wserr.Error is written as-is; other
+	// errors and empty results map to INTERNAL.
+	ActionFunc   PolicyTargetFunc
+	ResourceFunc PolicyTargetFunc
+
+	// ResourceAttributes optionally loads attributes of the target object for
+	// attribute-based rules (e.g. the order owner). A *wserr.Error is written as-is;
+	// other errors map to INTERNAL.
+	ResourceAttributes func(r *http.Request) (map[string]any, error)
+
+	// Impersonation optionally enables header impersonation (see Impersonation) inside
+	// Auth: the identity is switched before RequireScopes and Policy, so both authorize
+	// the impersonated subject and tenant. StepUp still applies to the caller. Use it
+	// instead of the Impersonation middleware on routes with RequireScopes or Policy.
+	Impersonation *ImpersonationConfig
+
+	// ImpersonatorIssuers lists the issuers ("iss") trusted to mint tokens with an
+	// "impersonator" claim. Such tokens from any other issuer are UNAUTHENTICATED.
+	// Default none: impersonation tokens are rejected.
+	ImpersonatorIssuers []string
+
+	// Realm is an optional realm for the WWW-Authenticate challenge.
+	Realm string
+
+	// Logger optionally logs failures with their internal reason (e.g. "expired").
+	// Reasons are never sent to clients.
+	Logger *wslog.Logger
+
+	// Metrics optionally counts failures by reason.
+	Metrics *AuthMetrics
+}
+
+// AuthMetrics counts authentication and authorization failures.
+type AuthMetrics struct {
+	FailuresTotal *prometheus.CounterVec
 }
 
-// Auth authenticates requests using JWT in Authorization header and enriches context with:
-// subject_id (sub), tenant_id, and scopes.
+// NewAuthMetrics creates and registers auth_failures_total{reason} into cfg.Registry
+// (or DefaultRegisterer if nil). cfg.GroupStatus is ignored.
+func NewAuthMetrics(cfg MetricsConfig) *AuthMetrics {
+	reg := cfg.Registry
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	m := &AuthMetrics{
+		FailuresTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: cfg.Namespace,
+				Subsystem: cfg.Subsystem,
+				Name:      "auth_failures_total",
+				Help:      "Total number of rejected requests by auth failure reason.",
+			},
+			[]string{"reason"},
+		),
+	}
+
+	reg.MustRegister(m.FailuresTotal)
+	return m
+}
+
+// Auth authenticates requests using a JWT, API key or session cookie and enriches context with:
+// subject_id (sub), tenant_id, scopes, tenant memberships, the actor chain of
+// delegated tokens ("act"), and the impersonator of impersonation tokens.
+//
+// The verified claims are stored too: read them with wsctx.Claims[*auth.Claims], or
+// wsctx.Claims[*T] when Verifier is an auth.TypedVerifier for T.
 //
 // It never leaks token verification details to clients. All failures map to standardized errors.
+// 401 and scope failures carry an RFC 6750 challenge, e.g.
+// `WWW-Authenticate: Bearer error="invalid_token"` or `Bearer error="insufficient_scope", scope="..."`.
+// StepUp failures carry `Bearer error="insufficient_user_authentication"` with the
+// acr_values and max_age to obtain (RFC 9470).
 func Auth(cfg AuthConfig) func(http.Handler) http.Handler {
-	if cfg.Verifier == nil {
-		panic("middleware.Auth requires non-nil Verifier")
+	if cfg.Verifier == nil && cfg.APIKeys == nil && cfg.Sessions == nil {
+		panic("middleware.Auth requires non-nil Verifier, APIKeys or Sessions")
+	}
+	if cfg.Verifier != nil && isNilPointer(cfg.Verifier) {
+		panic("middleware.Auth requires non-nil Verifier, got a nil " + reflect.TypeOf(cfg.Verifier).String())
 	}
-	if cfg.Policy != nil && (cfg.Action == "" || cfg.Resource == "") {
+	if cfg.APIKeys != nil && cfg.APIKeys.Store == nil {
+		panic("middleware.Auth requires non-nil APIKeys.Store")
+	}
+	if cfg.Policy != nil && ((cfg.Action == "" && cfg.ActionFunc == nil) || (cfg.Resource == "" && cfg.ResourceFunc == nil)) {
 		panic("middleware.Auth requires non-empty Action and Resource when Policy is set")
 	}
+	if cfg.Policy == nil && (cfg.ActionFunc != nil || cfg.ResourceFunc != nil) {
+		panic("middleware.Auth requires Policy when ActionFunc or ResourceFunc is set")
+	}
+	scopeNames := make([]string, 0, len(cfg.RequireScopes))
+	for _, sc := range cfg.RequireScopes {
+		if !sc.Valid() {
+			panic("middleware.Auth requires valid RequireScopes, got " + sc.String())
+		}
+		scopeNames = append(scopeNames, sc.String())
+	}
+	requiredScopes := strings.Join(scopeNames, " ")
+	if err := cfg.StepUp.Validate(); err != nil {
+		panic("middleware.Auth requires valid StepUp: " + err.Error())
+	}
+	stepUpChallenge, stepUpErr := cfg.stepUpFailure()
+	var imp *ImpersonationConfig
+	if cfg.Impersonation != nil {
+		c := *cfg.Impersonation
+		c.init()
+		imp = &c
+	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			raw := r.Header.Get(HeaderAuthorization)
-			token, err := auth.ParseBearer(raw)
-			if err != nil {
-				wserr.WriteError(r.Context(), w, wserr.Unauthenticated("authentication required"))
+			full, csrfToken, verr := authenticate(w, r, cfg)
+			if verr != nil {
+				switch {
+				case errors.Is(verr, auth.ErrRevocationUnavailable) ||
+					errors.Is(verr, auth.ErrKeySourceUnavailable) ||
+					errors.Is(verr, auth.ErrAPIKeyUnavailable) ||
+					errors.Is(verr, auth.ErrIntrospectionUnavailable):
+					cfg.fail(r.Context(), w, auth.VerifyErrorReason(verr), verr, "",
+						wserr.Unavailable("authentication service unavailable"))
+				case errors.Is(verr, errNoCredentials):
+					cfg.fail(r.Context(), w, "missing_credentials", nil, cfg.challenge("", ""),
+						wserr.Unauthenticated("authentication required"))
+				case errors.Is(verr, errSessionInvalid):
+					cfg.fail(r.Context(), w, "invalid_session", nil, "",
+						wserr.Unauthenticated("authentication required"))
+				case errors.Is(verr, errSessionExpired):
+					cfg.fail(r.Context(), w, "session_expired", nil, "",
+						wserr.Unauthenticated("authentication required"))
+				case errors.Is(verr, errSessionRevoked):
+					cfg.fail(r.Context(), w, "session_revoked", nil, "",
+						wserr.Unauthenticated("authentication required"))
+				case errors.Is(verr, errCSRF):
+					cfg.fail(r.Context(), w, "csrf_failed", nil, "", wserr.Forbidden("forbidden"))
+				case errors.Is(verr, errMalformedAuthorization):
+					cfg.fail(r.Context(), w, "malformed_header", nil, cfg.challenge("invalid_request", ""),
+						wserr.Unauthenticated("authentication required"))
+				default:
+					cfg.fail(r.Context(), w, auth.VerifyErrorReason(verr), verr, cfg.challenge("invalid_token", ""),
+						wserr.Unauthenticated("authentication required"))
+				}
 				return
 			}
 
-			claims, verr := cfg.Verifier.Verify(token)
-			if verr != nil {
-				wserr.WriteError(r.Context(), w, wserr.Unauthenticated("authentication required"))
+			claims := full.Base()
+			if claims.Impersonator != "" && !slices.Contains(cfg.ImpersonatorIssuers, claims.Issuer) {
+				cfg.fail(r.Context(), w, "untrusted_impersonator", nil, cfg.challenge("invalid_token", ""),
+					wserr.Unauthenticated("authentication required"))
 				return
 			}
 
 			ctx := r.Context()
+			ctx = wsctx.WithClaims(ctx, full)
 			ctx = wsctx.WithSubjectID(ctx, claims.Subject)
 			ctx = wsctx.WithTenantID(ctx, claims.TenantID)
 			ctx = wsctx.WithScopes(ctx, claims.Scopes)
+			ctx = wsctx.WithActors(ctx, claims.ActorChain())
+			ctx = wsctx.WithMemberships(ctx, memberships(claims))
+			ctx = wsctx.WithImpersonator(ctx, claims.Impersonator)
+			if csrfToken != "" {
+				ctx = context.WithValue(ctx, csrfTokenKey{}, csrfToken)
+			}
+
+			if !cfg.StepUp.IsZero() {
+				if serr := cfg.StepUp.Check(claims, time.Now()); serr != nil {
+					cfg.fail(ctx, w, auth.VerifyErrorReason(serr), serr, stepUpChallenge, stepUpErr)
+					return
+				}
+			}
 
-			if len(cfg.RequireScopes) > 0 && !auth.HasAll(claims.Scopes, cfg.RequireScopes...) {
-				wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+			if imp != nil {
+				var ok bool
+				if ctx, ok = imp.switchIdentity(w, r.WithContext(ctx)); !ok {
+					return
+				}
+			}
+
+			if len(cfg.RequireScopes) > 0 && !hasScopes(wsctx.Scopes(ctx), cfg) {
+				cfg.fail(ctx, w, "insufficient_scope", nil, cfg.challenge("insufficient_scope", "scope", requiredScopes),
+					wserr.Forbidden("forbidden"))
 				return
 			}
 
 			if cfg.Policy != nil {
+				action, err := policyTarget(r.WithContext(ctx), cfg.Action, cfg.ActionFunc)
+				if err != nil {
+					cfg.failTarget(ctx, w, "policy_action_unresolved", err)
+					return
+				}
+				resource, err := policyTarget(r.WithContext(ctx), cfg.Resource, cfg.ResourceFunc)
+				if err != nil {
+					cfg.failTarget(ctx, w, "policy_resource_unresolved", err)
+					return
+				}
+
+				var attrs map[string]any
+				if cfg.ResourceAttributes != nil {
+					a, aerr := cfg.ResourceAttributes(r.WithContext(ctx))
+					if aerr != nil {
+						cfg.failTarget(ctx, w, "policy_attributes_unresolved", aerr)
+						return
+					}
+					attrs = a
+				}
+
 				dec, perr := cfg.Policy.Check(ctx, auth.PolicyRequest{
-					SubjectID: claims.Subject,
-					TenantID:  claims.TenantID,
-					Scopes:    claims.Scopes,
-					Action:    cfg.Action,
-					Resource:  cfg.Resource,
+					SubjectID:          wsctx.SubjectID(ctx),
+					TenantID:           wsctx.TenantID(ctx),
+					Scopes:             wsctx.Scopes(ctx),
+					Actors:             wsctx.Actors(ctx),
+					Action:             action,
+					Resource:           resource,
+					ResourceAttributes: attrs,
+					Request:            requestAttributes(r),
 				})
 				if perr != nil {
-					wserr.WriteError(ctx, w, wserr.Unavailable("authorization service unavailable"))
+					cfg.fail(ctx, w, "policy_unavailable", perr, "", wserr.Unavailable("authorization service unavailable"))
 					return
 				}
 				if !dec.IsAllow() {
-					wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+					cfg.fail(ctx, w, "policy_denied", nil, "", wserr.Forbidden("forbidden"))
 					return
 				}
 			}
 
+			if len(cfg.RequireScopes) > 0 || cfg.Policy != nil {
+				ctx = context.WithValue(ctx, authorizedKey{}, true)
+			}
+			if imp != nil && !imp.admit(w, r.WithContext(ctx)) {
+				return
+			}
+
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// authorizedKey marks requests whose identity Auth has authorized (RequireScopes or
+// Policy), so that a later identity switch cannot go unchecked.
+type authorizedKey struct{}
+
+func authorized(ctx context.Context) bool {
+	ok, _ := ctx.Value(authorizedKey{}).(bool)
+	return ok
+}
+
+var (
+	errNoCredentials          = errors.New("middleware: no credentials")
+	errMalformedAuthorization = errors.New("middleware: malformed authorization header")
+)
+
+// authenticate applies the credential precedence documented on AuthConfig.APIKeys and
+// AuthConfig.Sessions. csrfToken is set for session requests.
+func authenticate(w http.ResponseWriter, r *http.Request, cfg AuthConfig) (claims auth.CustomClaims, csrfToken string, err error) {
+	raw := r.Header.Get(HeaderAuthorization)
+	if strings.TrimSpace(raw) == "" {
+		if key := r.Header.Get(HeaderAPIKey); key != "" && cfg.APIKeys != nil {
+			claims, err = nonNil(cfg.APIKeys.Verify(r.Context(), key))
+			return claims, "", err
+		}
+		if cfg.Sessions != nil {
+			st, err := cfg.Sessions.authenticate(w, r)
+			if err != nil {
+				return nil, "", err
+			}
+			return st.Claims, st.CSRF, nil
+		}
+		return nil, "", errNoCredentials
+	}
+	claims, err = authenticateBearer(r, cfg, raw)
+	return claims, "", err
+}
+
+func authenticateBearer(r *http.Request, cfg AuthConfig, raw string) (auth.CustomClaims, error) {
+	token, err := auth.ParseBearer(raw)
+	if err != nil {
+		return nil, errMalformedAuthorization
+	}
+	if auth.IsAPIKey(token) {
+		if cfg.APIKeys == nil {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return nonNil(cfg.APIKeys.Verify(r.Context(), token))
+	}
+	if cfg.Verifier == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	if cv, ok := cfg.Verifier.(auth.CustomClaimsVerifier); ok {
+		return cv.VerifyCustom(r.Context(), token)
+	}
+	return nonNil(cfg.Verifier.VerifyContext(r.Context(), token))
+}
+
+// isNilPointer reports whether v holds a nil pointer (or other nil-able value) behind a
+// non-nil interface.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// nonNil avoids returning a typed nil *auth.Claims as a non-nil interface.
+func nonNil(claims *auth.Claims, err error) (auth.CustomClaims, error) {
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// challenge builds an RFC 6750 WWW-Authenticate value. errCode is empty when no
+// credentials were sent, as the RFC recommends. extra holds further name/value pairs;
+// empty values are skipped.
+func (cfg AuthConfig) challenge(errCode string, extra ...string) string {
+	var params []string
+	if cfg.Realm != "" {
+		params = append(params, "realm="+strconv.Quote(cfg.Realm))
+	}
+	if errCode != "" {
+		params = append(params, "error="+strconv.Quote(errCode))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if extra[i+1] != "" {
+			params = append(params, extra[i]+"="+strconv.Quote(extra[i+1]))
+		}
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// stepUpFailure builds the RFC 9470 challenge and the error telling the client which
+// authentication to obtain. Both are fixed per configuration.
+func (cfg AuthConfig) stepUpFailure() (string, *wserr.Error) {
+	acrValues := strings.Join(cfg.StepUp.ACRValues(), " ")
+	var maxAge string
+	if cfg.StepUp.MaxAge > 0 {
+		maxAge = strconv.FormatInt(int64(cfg.StepUp.MaxAge/time.Second), 10)
+	}
+	challenge := cfg.challenge("insufficient_user_authentication",
+		"error_description", "A different authentication level is required",
+		"acr_values", acrValues,
+		"max_age", maxAge,
+	)
+
+	details := map[string]any{"reason": "insufficient_user_authentication"}
+	if acrValues != "" {
+		details["acr_values"] = acrValues
+	}
+	if len(cfg.StepUp.AMR) > 0 {
+		details["amr"] = strings.Join(cfg.StepUp.AMR, " ")
+	}
+	if maxAge != "" {
+		details["max_age"] = int64(cfg.StepUp.MaxAge / time.Second)
+	}
+	return challenge, wserr.New(wserr.CodeUnauthenticated, "step-up authentication required", details)
+}
+
+// fail logs and counts a rejected request, then writes e with an optional challenge.
+func (cfg AuthConfig) fail(ctx context.Context, w http.ResponseWriter, reason string, cause error, challenge string, e *wserr.Error) {
+	if cfg.Metrics != nil {
+		cfg.Metrics.FailuresTotal.WithLabelValues(reason).Inc()
+	}
+	if cfg.Logger != nil {
+		args := []any{"reason", reason, "status", wserr.Status(e.Code)}
+		if cause != nil {
+			args = append(args, "error", cause.Error())
+		}
+		if e.Code == wserr.CodeUnavailable || e.Code == wserr.CodeInternal {
+			cfg.Logger.With(ctx).Error("auth failed", args...)
+		} else {
+			cfg.Logger.With(ctx).Info("auth failed", args...)
+		}
+	}
+	if challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	wserr.WriteError(ctx, w, e)
+}
+
+// policyTarget returns the static value unless fn derives it from the request.
+func policyTarget(r *http.Request, static string, fn PolicyTargetFunc) (string, error) {
+	if fn == nil {
+		return static, nil
+	}
+	v, err := fn(r)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(v) == "" {
+		return "", errors.New("middleware: empty policy target")
+	}
+	return v, nil
+}
+
+// failTarget rejects a request whose policy action or resource could not be derived.
+func (cfg AuthConfig) failTarget(ctx context.Context, w http.ResponseWriter, reason string, err error) {
+	if e, ok := wserr.As(err); ok {
+		cfg.fail(ctx, w, reason, nil, "", e)
+		return
+	}
+	cfg.fail(ctx, w, reason, err, "", wserr.Internal("internal error"))
+}
+
+func memberships(claims *auth.Claims) []wsctx.Membership {
+	if len(claims.Memberships) == 0 {
+		return nil
+	}
+	out := make([]wsctx.Membership, 0, len(claims.Memberships))
+	for _, m := range claims.Memberships {
+		out = append(out, wsctx.Membership{TenantID: m.TenantID, Roles: m.Roles, Scopes: m.Scopes})
+	}
+	return out
+}
+
+func requestAttributes(r *http.Request) auth.RequestAttributes {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return auth.RequestAttributes{
+		IP:     ip,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Time:   time.Now(),
+	}
+}
+
+func hasScopes(granted []string, cfg AuthConfig) bool {
+	if len(cfg.ScopeImplications) == 0 {
+		return auth.HasAll(granted, cfg.RequireScopes...)
+	}
+	return auth.CompileScopes(granted, cfg.ScopeImplications).HasAll(cfg.RequireScopes...)
+}
@@ -1,17 +1,23 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
 	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+	wslog "github.com/hanzy-dev/saas-ws-lib/pkg/log"
 )
 
 type fakePolicy struct {
@@ -70,6 +76,9 @@ func TestAuthMiddleware(t *testing.T) {
 		{"valid token ok", AuthConfig{Verifier: verifier}, "Bearer " + sign("u1", "t1", []string{"a"}, time.Now().Add(time.Hour)), 204},
 		{"missing required scope => 403", AuthConfig{Verifier: verifier, RequireScopes: []auth.Scope{"admin"}}, "Bearer " + sign("u1", "t1", []string{"user"}, time.Now().Add(time.Hour)), 403},
 		{"has required scopes => 204", AuthConfig{Verifier: verifier, RequireScopes: []auth.Scope{"user"}}, "Bearer " + sign("u1", "t1", []string{"user"}, time.Now().Add(time.Hour)), 204},
+		{"wildcard scope => 204", AuthConfig{Verifier: verifier, RequireScopes: []auth.Scope{"orders:read"}}, "Bearer " + sign("u1", "t1", []string{"orders:*"}, time.Now().Add(time.Hour)), 204},
+		{"implied scope => 204", AuthConfig{Verifier: verifier, RequireScopes: []auth.Scope{"orders:read"}, ScopeImplications: auth.ScopeImplications{"admin": {"read"}}}, "Bearer " + sign("u1", "t1", []string{"orders:admin"}, time.Now().Add(time.Hour)), 204},
+		{"not implied => 403", AuthConfig{Verifier: verifier, RequireScopes: []auth.Scope{"orders:read"}}, "Bearer " + sign("u1", "t1", []string{"orders:admin"}, time.Now().Add(time.Hour)), 403},
 	}
 
 	for _, tt := range tests {
@@ -161,3 +170,744 @@ func TestAuthMiddleware_Policy(t *testing.T) {
 		}
 	})
 }
+
+func TestAuthMiddleware_InvalidRequiredScopePanics(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	Auth(AuthConfig{Verifier: &auth.Verifier{}, RequireScopes: []auth.Scope{"orders:re*d"}})
+}
+
+func TestAuthMiddleware_PolicyAttributes(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "t1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	signed, _ := tok.SignedString(secret)
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) })
+
+	t.Run("attributes passed to policy", func(t *testing.T) {
+		p := &fakePolicy{dec: auth.DecisionAllow}
+		cfg := AuthConfig{
+			Verifier: verifier, Policy: p, Action: "orders.update", Resource: "orders",
+			ResourceAttributes: func(r *http.Request) (map[string]any, error) {
+				if wsctx.SubjectID(r.Context()) != "u1" {
+					t.Fatalf("context should be enriched before loading attributes")
+				}
+				return map[string]any{"owner_id": "u1"}, nil
+			},
+		}
+
+		r := httptest.NewRequest(http.MethodPatch, "/orders/1", nil)
+		r.RemoteAddr = "10.0.0.7:5555"
+		r.Header.Set(HeaderAuthorization, "Bearer "+signed)
+		rr := httptest.NewRecorder()
+		Auth(cfg)(okHandler).ServeHTTP(rr, r)
+
+		if rr.Code != 204 {
+			t.Fatalf("status=%d want=204", rr.Code)
+		}
+		if p.got.ResourceAttributes["owner_id"] != "u1" {
+			t.Fatalf("attributes not passed: %+v", p.got)
+		}
+		if p.got.Request.IP != "10.0.0.7" || p.got.Request.Method != http.MethodPatch || p.got.Request.Path != "/orders/1" || p.got.Request.Time.IsZero() {
+			t.Fatalf("request attributes not filled: %+v", p.got.Request)
+		}
+	})
+
+	t.Run("attribute loader errors", func(t *testing.T) {
+		tests := []struct {
+			err  error
+			want int
+		}{
+			{wserr.NotFound("order not found"), 404},
+			{errors.New("db down"), 500},
+		}
+		for _, tt := range tests {
+			var logs bytes.Buffer
+			p := &fakePolicy{dec: auth.DecisionAllow}
+			loadErr := tt.err
+			cfg := AuthConfig{
+				Verifier: verifier, Policy: p, Action: "a", Resource: "r",
+				ResourceAttributes: func(r *http.Request) (map[string]any, error) { return nil, loadErr },
+				Logger:             wslog.NewJSON(wslog.Options{Out: &logs}),
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(HeaderAuthorization, "Bearer "+signed)
+			rr := httptest.NewRecorder()
+			Auth(cfg)(okHandler).ServeHTTP(rr, r)
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.want)
+			}
+			if !strings.Contains(logs.String(), `"reason":"policy_attributes_unresolved"`) {
+				t.Fatalf("expected failure logged, got %s", logs.String())
+			}
+		}
+	})
+}
+
+type failingRevocation struct{}
+
+func (failingRevocation) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, errors.New("db down")
+}
+
+func (failingRevocation) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	return time.Time{}, errors.New("db down")
+}
+
+func TestAuthMiddleware_Revocation(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	keyFunc := func(t *jwt.Token) (any, error) { return secret, nil }
+	store := auth.NewMemoryRevocationStore()
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "t1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ID:        "j1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	})
+	signed, err := tok.SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	_ = store.Revoke(context.Background(), "j1", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		store auth.RevocationStore
+		want  int
+	}{
+		{"revoked token", store, 401},
+		{"store unavailable", failingRevocation{}, 503},
+		{"key source unavailable", nil, 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &auth.Verifier{KeyFunc: keyFunc, Revocation: tt.store}
+			if tt.store == nil {
+				v.KeyFunc = func(t *jwt.Token) (any, error) {
+					return nil, fmt.Errorf("%w: status 503", auth.ErrJWKSUnavailable)
+				}
+			}
+			h := Auth(AuthConfig{Verifier: v})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+signed)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_APIKeys(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+
+	plain, k, err := auth.NewAPIKey("partner-1", "t1", []string{"orders:read"}, time.Time{})
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	keys := &auth.APIKeyVerifier{Store: auth.NewMemoryAPIKeyStore(k)}
+
+	jwtTok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "t1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      AuthConfig
+		authz    string
+		apiKey   string
+		wantCode int
+		wantSub  string
+	}{
+		{"api key header", AuthConfig{Verifier: verifier, APIKeys: keys}, "", plain, 204, "partner-1"},
+		{"api key as bearer", AuthConfig{Verifier: verifier, APIKeys: keys}, "Bearer " + plain, "", 204, "partner-1"},
+		{"api key only config", AuthConfig{APIKeys: keys}, "", plain, 204, "partner-1"},
+		{"jwt wins over api key", AuthConfig{Verifier: verifier, APIKeys: keys}, "Bearer " + jwtTok, plain, 204, "u1"},
+		{"no fallback after bad bearer", AuthConfig{Verifier: verifier, APIKeys: keys}, "Bearer bad", plain, 401, ""},
+		{"bad api key", AuthConfig{Verifier: verifier, APIKeys: keys}, "", "wsk_x_y", 401, ""},
+		{"api keys not enabled", AuthConfig{Verifier: verifier}, "", plain, 401, ""},
+		{"api key bearer not enabled", AuthConfig{Verifier: verifier}, "Bearer " + plain, "", 401, ""},
+		{"jwt without verifier", AuthConfig{APIKeys: keys}, "Bearer " + jwtTok, "", 401, ""},
+		{"scopes enforced", AuthConfig{APIKeys: keys, RequireScopes: []auth.Scope{"orders:write"}}, "", plain, 403, ""},
+		{"store unavailable", AuthConfig{APIKeys: &auth.APIKeyVerifier{Store: failingAPIKeys{}}}, "", plain, 503, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSub string
+			h := Auth(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSub = wsctx.SubjectID(r.Context())
+				w.WriteHeader(204)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authz != "" {
+				req.Header.Set(HeaderAuthorization, tt.authz)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(HeaderAPIKey, tt.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d", tt.wantCode, rec.Code)
+			}
+			if gotSub != tt.wantSub {
+				t.Fatalf("expected subject %q, got %q", tt.wantSub, gotSub)
+			}
+		})
+	}
+}
+
+type failingAPIKeys struct{}
+
+func (failingAPIKeys) LookupAPIKey(ctx context.Context, id string) (auth.APIKey, error) {
+	return auth.APIKey{}, errors.New("db down")
+}
+
+func (failingAPIKeys) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	return nil
+}
+
+func TestAuthMiddleware_ConfigPanics(t *testing.T) {
+	t.Parallel()
+
+	for name, cfg := range map[string]AuthConfig{
+		"no verifier":        {},
+		"api keys no store":  {APIKeys: &auth.APIKeyVerifier{}},
+		"typed nil verifier": {Verifier: (*auth.Verifier)(nil)},
+		"typed nil multi":    {Verifier: (*auth.MultiVerifier)(nil), Sessions: &SessionManager{}},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("%s: expected panic", name)
+				}
+			}()
+			Auth(cfg)
+		}()
+	}
+}
+
+func TestAuthMiddleware_MultiVerifier(t *testing.T) {
+	t.Parallel()
+
+	secretA := []byte("secret-a")
+	secretB := []byte("secret-b")
+	mv, err := auth.NewMultiVerifier(
+		auth.Verifier{KeyFunc: func(*jwt.Token) (any, error) { return secretA, nil }, Config: auth.VerifyConfig{Issuer: "a"}},
+		auth.Verifier{
+			KeyFunc: func(*jwt.Token) (any, error) { return secretB, nil },
+			Config:  auth.VerifyConfig{Issuer: "b", Claims: auth.ClaimMapping{TenantID: "org"}},
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewMultiVerifier: %v", err)
+	}
+
+	sign := func(secret []byte, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantCode   int
+		wantTenant string
+	}{
+		{"issuer a", sign(secretA, jwt.MapClaims{"iss": "a", "sub": "u1", "tenant_id": "t1"}), 204, "t1"},
+		{"issuer b mapped tenant", sign(secretB, jwt.MapClaims{"iss": "b", "sub": "u2", "org": "t2"}), 204, "t2"},
+		{"issuer b signed with a's key", sign(secretA, jwt.MapClaims{"iss": "b", "sub": "u2", "org": "t2"}), 401, ""},
+		{"unknown issuer", sign(secretA, jwt.MapClaims{"iss": "c", "sub": "u1", "tenant_id": "t1"}), 401, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotTenant string
+			h := Auth(AuthConfig{Verifier: mv})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotTenant = wsctx.TenantID(r.Context())
+				w.WriteHeader(204)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(HeaderAuthorization, "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode || gotTenant != tt.wantTenant {
+				t.Fatalf("code=%d tenant=%q, want %d %q", rec.Code, gotTenant, tt.wantCode, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_Challenges(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+
+	sign := func(exp time.Time, scopes []string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			TenantID: "t1",
+			Scopes:   scopes,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "u1",
+				ExpiresAt: jwt.NewNumericDate(exp),
+			},
+		}).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	var logs bytes.Buffer
+	reg := prometheus.NewRegistry()
+	cfg := AuthConfig{
+		Verifier:      verifier,
+		RequireScopes: []auth.Scope{"orders:write", "orders:read"},
+		Realm:         "api",
+		Logger:        wslog.NewJSON(wslog.Options{Out: &logs}),
+		Metrics:       NewAuthMetrics(MetricsConfig{Registry: reg}),
+	}
+
+	tests := []struct {
+		name      string
+		authz     string
+		wantCode  int
+		wantChall string
+		reason    string
+	}{
+		{"no credentials", "", 401, `Bearer realm="api"`, "missing_credentials"},
+		{"malformed header", "Basic abc", 401, `Bearer realm="api", error="invalid_request"`, "malformed_header"},
+		{"expired", "Bearer " + sign(time.Now().Add(-time.Hour), nil), 401, `Bearer realm="api", error="invalid_token"`, "expired"},
+		{"bad signature", "Bearer " + sign(time.Now().Add(time.Hour), nil) + "x", 401, `Bearer realm="api", error="invalid_token"`, "bad_signature"},
+		{"insufficient scope", "Bearer " + sign(time.Now().Add(time.Hour), []string{"orders:read"}), 403, `Bearer realm="api", error="insufficient_scope", scope="orders:write orders:read"`, "insufficient_scope"},
+		{"ok", "Bearer " + sign(time.Now().Add(time.Hour), []string{"orders:*"}), 204, "", ""},
+	}
+
+	h := Auth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }))
+	for _, tt := range tests {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.authz != "" {
+			req.Header.Set(HeaderAuthorization, tt.authz)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantCode {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.wantCode, rec.Code)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChall {
+			t.Fatalf("%s: challenge=%q want %q", tt.name, got, tt.wantChall)
+		}
+		if tt.reason == "" {
+			continue
+		}
+		if !strings.Contains(logs.String(), `"reason":"`+tt.reason+`"`) {
+			t.Fatalf("%s: expected reason logged, got %s", tt.name, logs.String())
+		}
+		// the reason stays internal
+		if strings.Contains(rec.Body.String(), tt.reason) && tt.reason != "insufficient_scope" {
+			t.Fatalf("%s: reason leaked in body: %s", tt.name, rec.Body.String())
+		}
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	counts := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "auth_failures_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			counts[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+	}
+	if counts["expired"] != 1 || counts["bad_signature"] != 1 || counts["insufficient_scope"] != 1 || len(counts) != 5 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func TestAuthMiddleware_ChallengeWithoutRealm(t *testing.T) {
+	t.Parallel()
+
+	h := Auth(AuthConfig{Verifier: &auth.Verifier{}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("WWW-Authenticate"); got != "Bearer" {
+		t.Fatalf("challenge=%q", got)
+	}
+}
+
+type appClaims struct {
+	auth.Claims
+	Roles []string `json:"roles"`
+	Plan  string   `json:"plan"`
+}
+
+func TestAuthMiddleware_ClaimsInContext(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	base := auth.Verifier{KeyFunc: func(*jwt.Token) (any, error) { return secret, nil }}
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "u1", "tenant_id": "t1", "roles": []string{"admin"}, "plan": "pro",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	serve := func(cfg AuthConfig, check func(r *http.Request)) {
+		h := Auth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			check(r)
+			w.WriteHeader(204)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAuthorization, "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != 204 {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+	}
+
+	serve(AuthConfig{Verifier: auth.NewTypedVerifier[appClaims](base)}, func(r *http.Request) {
+		c, ok := wsctx.Claims[*appClaims](r.Context())
+		if !ok || c.Plan != "pro" || len(c.Roles) != 1 || c.Subject != "u1" {
+			t.Fatalf("typed claims not in context: %+v ok=%v", c, ok)
+		}
+		if wsctx.TenantID(r.Context()) != "t1" {
+			t.Fatalf("context not enriched")
+		}
+	})
+
+	serve(AuthConfig{Verifier: &base}, func(r *http.Request) {
+		c, ok := wsctx.Claims[*auth.Claims](r.Context())
+		if !ok || c.Subject != "u1" || c.TenantID != "t1" {
+			t.Fatalf("standard claims not in context: %+v ok=%v", c, ok)
+		}
+	})
+}
+
+func TestAuthMiddleware_Delegation(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(*jwt.Token) (any, error) { return secret, nil }}
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "t1",
+		Act:      &auth.Actor{Subject: "svc-payments", Act: &auth.Actor{Subject: "svc-orders"}},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	policy := &fakePolicy{dec: auth.DecisionAllow}
+	h := Auth(AuthConfig{Verifier: verifier, Policy: policy, Action: "payments.refund", Resource: "payments"})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wsctx.SubjectID(r.Context()) != "u1" || wsctx.Actor(r.Context()) != "svc-payments" {
+				t.Fatalf("subject=%q actor=%q", wsctx.SubjectID(r.Context()), wsctx.Actor(r.Context()))
+			}
+			if got := strings.Join(wsctx.Actors(r.Context()), ","); got != "svc-payments,svc-orders" {
+				t.Fatalf("actors=%q", got)
+			}
+			w.WriteHeader(204)
+		}),
+	)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderAuthorization, "Bearer "+tok)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != 204 {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if got := strings.Join(policy.got.Actors, ","); got != "svc-payments,svc-orders" {
+		t.Fatalf("policy actors=%q", got)
+	}
+}
+
+func TestAuthMiddleware_Introspection(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.PostForm.Get("token") {
+		case "opaque-good":
+			_, _ = w.Write([]byte(`{"active":true,"sub":"u1","tenant_id":"t1","scope":"orders:read"}`))
+		case "opaque-down":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte(`{"active":false}`))
+		}
+	}))
+	defer srv.Close()
+
+	in, err := auth.NewIntrospector(auth.IntrospectionConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewIntrospector: %v", err)
+	}
+	h := Auth(AuthConfig{Verifier: in, RequireScopes: []auth.Scope{"orders:read"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if sub := wsctx.SubjectID(r.Context()); sub != "u1" {
+				t.Errorf("subject=%q", sub)
+			}
+			w.WriteHeader(204)
+		}),
+	)
+
+	tests := []struct {
+		token string
+		want  int
+	}{
+		{"opaque-good", 204},
+		{"opaque-revoked", 401},
+		{"opaque-down", 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_StepUp(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+
+	sign := func(acr string, amr []string, authTime time.Time) string {
+		c := auth.Claims{
+			TenantID: "t1",
+			ACR:      acr,
+			AMR:      amr,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "u1",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		if !authTime.IsZero() {
+			c.AuthTime = jwt.NewNumericDate(authTime)
+		}
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+
+	h := Auth(AuthConfig{
+		Verifier: verifier,
+		StepUp: auth.StepUp{
+			ACR:       "aal2",
+			ACRLevels: []string{"aal1", "aal2", "aal3"},
+			AMR:       []string{"mfa"},
+			MaxAge:    5 * time.Minute,
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }))
+
+	recent := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"meets requirements", sign("aal2", []string{"pwd", "mfa"}, recent), 204},
+		{"stronger acr", sign("aal3", []string{"mfa"}, recent), 204},
+		{"weak acr", sign("aal1", []string{"mfa"}, recent), 401},
+		{"no mfa", sign("aal2", []string{"pwd"}, recent), 401},
+		{"stale login", sign("aal2", []string{"mfa"}, time.Now().Add(-time.Hour)), 401},
+		{"no auth_time", sign("aal2", []string{"mfa"}, time.Time{}), 401},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/payouts/bank", nil)
+		req.Header.Set(HeaderAuthorization, "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+		if tt.want == 204 {
+			continue
+		}
+		want := `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", acr_values="aal2 aal3", max_age="300"`
+		if got := rec.Header().Get("WWW-Authenticate"); got != want {
+			t.Fatalf("%s: challenge=%q", tt.name, got)
+		}
+		if !strings.Contains(rec.Body.String(), `"reason":"insufficient_user_authentication"`) {
+			t.Fatalf("%s: expected step-up details, got %s", tt.name, rec.Body.String())
+		}
+	}
+}
+
+func TestAuthMiddleware_InvalidStepUpPanics(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	_ = Auth(AuthConfig{Verifier: &auth.Verifier{}, StepUp: auth.StepUp{ACR: "aal9", ACRLevels: []string{"aal1"}}})
+}
+
+func TestAuthMiddleware_TenantSelection(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Memberships: []auth.Membership{
+			{TenantID: "t1", Roles: []string{"owner"}, Scopes: []string{"orders:*"}},
+			{TenantID: "t2", Roles: []string{"viewer"}, Scopes: []string{"orders:read"}},
+		},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	h := Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m, ok := wsctx.CurrentMembership(r.Context())
+			if !ok || m.Roles[0] != "viewer" || wsctx.Scopes(r.Context())[0] != "orders:read" {
+				t.Errorf("membership=%+v, %v", m, ok)
+			}
+			w.WriteHeader(204)
+		}),
+		Auth(AuthConfig{Verifier: &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}}),
+		Tenant(TenantConfig{Mode: TenantSelect, Required: true}),
+	)
+
+	tests := []struct {
+		tenant string
+		want   int
+	}{
+		{"t2", 204},
+		{"t3", 403},
+		{"", 403},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAuthorization, "Bearer "+signed)
+		if tt.tenant != "" {
+			req.Header.Set(HeaderTenantID, tt.tenant)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Fatalf("tenant %q: expected %d, got %d", tt.tenant, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestAuthMiddleware_ImpersonatorIssuers(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(*jwt.Token) (any, error) { return secret, nil }}
+	sign := func(iss string) string {
+		tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			TenantID:     "t9",
+			Impersonator: "support-1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    iss,
+				Subject:   "cust-1",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}).SignedString(secret)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return tok
+	}
+
+	tests := []struct {
+		name    string
+		iss     string
+		trusted []string
+		want    int
+	}{
+		{"no trusted issuers", "https://support.example", nil, 401},
+		{"other issuer", "https://customer-idp.example", []string{"https://support.example"}, 401},
+		{"trusted issuer", "https://support.example", []string{"https://support.example"}, 204},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := Auth(AuthConfig{Verifier: verifier, ImpersonatorIssuers: tt.trusted})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if wsctx.Impersonator(r.Context()) != "support-1" {
+						t.Errorf("impersonator=%q", wsctx.Impersonator(r.Context()))
+					}
+					w.WriteHeader(204)
+				}),
+			)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(HeaderAuthorization, "Bearer "+sign(tt.iss))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.want)
+			}
+			if tt.want == 401 && !strings.Contains(rr.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+				t.Fatalf("challenge=%q", rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
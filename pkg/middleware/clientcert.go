@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+)
+
+// CertMapper derives subject_id from a verified client certificate.
+type CertMapper func(cert *x509.Certificate) (string, error)
+
+// MapSPIFFEID maps the certificate's SPIFFE ID (a spiffe:// URI SAN) to subject_id.
+func MapSPIFFEID(cert *x509.Certificate) (string, error) {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" && u.Host != "" {
+			return u.String(), nil
+		}
+	}
+	return "", errors.New("middleware: client certificate has no spiffe id")
+}
+
+// MapURISAN maps the first URI SAN to subject_id.
+func MapURISAN(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) == 0 {
+		return "", errors.New("middleware: client certificate has no uri san")
+	}
+	return cert.URIs[0].String(), nil
+}
+
+// MapCommonName maps the subject common name to subject_id. Prefer SANs where possible.
+func MapCommonName(cert *x509.Certificate) (string, error) {
+	cn := strings.TrimSpace(cert.Subject.CommonName)
+	if cn == "" {
+		return "", errors.New("middleware: client certificate has no common name")
+	}
+	return cn, nil
+}
+
+type ClientCertConfig struct {
+	// Mapper derives subject_id from the verified leaf certificate. Defaults to MapSPIFFEID.
+	Mapper CertMapper
+
+	// Allow lists the subject ids that may call the handler. Required.
+	// An entry ending in '*' matches by prefix (e.g. "spiffe://prod.example.com/ns/billing/*");
+	// "*" alone allows every verified client.
+	Allow []string
+
+	// Scopes assigns service scopes by subject id, using the same patterns as Allow.
+	// Scopes of every matching entry are granted.
+	Scopes map[string][]string
+}
+
+// ClientCert authenticates requests by the TLS client certificate verified by the server
+// (tls.Config.ClientAuth must verify certificates) and enriches context with subject_id
+// and scopes, like Auth does for tokens. Tenant and policy middleware work unchanged.
+//
+// Unverified peer certificates are ignored. A missing or unmappable certificate is
+// UNAUTHENTICATED; a subject outside Allow is FORBIDDEN.
+func ClientCert(cfg ClientCertConfig) func(http.Handler) http.Handler {
+	if len(cfg.Allow) == 0 {
+		panic("middleware.ClientCert requires non-empty Allow")
+	}
+	if cfg.Mapper == nil {
+		cfg.Mapper = MapSPIFFEID
+	}
+	// deterministic scope order regardless of map iteration
+	scopePatterns := slices.Sorted(maps.Keys(cfg.Scopes))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				wserr.WriteError(ctx, w, wserr.Unauthenticated("authentication required"))
+				return
+			}
+
+			subject, err := cfg.Mapper(r.TLS.VerifiedChains[0][0])
+			if err != nil || strings.TrimSpace(subject) == "" {
+				wserr.WriteError(ctx, w, wserr.Unauthenticated("authentication required"))
+				return
+			}
+
+			if !matchesAny(cfg.Allow, subject) {
+				wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+				return
+			}
+
+			var scopes []string
+			for _, pattern := range scopePatterns {
+				if matchesSubject(pattern, subject) {
+					scopes = append(scopes, cfg.Scopes[pattern]...)
+				}
+			}
+
+			ctx = wsctx.WithSubjectID(ctx, subject)
+			ctx = wsctx.WithScopes(ctx, scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func matchesAny(patterns []string, subject string) bool {
+	for _, p := range patterns {
+		if matchesSubject(p, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSubject(pattern, subject string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(subject, prefix)
+	}
+	return pattern == subject
+}
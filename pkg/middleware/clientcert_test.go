@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+)
+
+func testCert(t *testing.T, cn string, uris ...string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			t.Fatalf("parse uri: %v", err)
+		}
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse cert: %v", err)
+	}
+	return cert
+}
+
+func TestClientCert(t *testing.T) {
+	t.Parallel()
+
+	billing := testCert(t, "billing", "spiffe://prod.example.com/ns/billing/sa/worker")
+	orders := testCert(t, "orders", "spiffe://prod.example.com/ns/orders/sa/api")
+	noSAN := testCert(t, "legacy-service")
+	httpsSAN := testCert(t, "web", "https://svc.example.com/id")
+
+	cfg := ClientCertConfig{
+		Allow: []string{"spiffe://prod.example.com/ns/billing/*", "spiffe://prod.example.com/ns/orders/sa/api"},
+		Scopes: map[string][]string{
+			"spiffe://prod.example.com/ns/billing/*": {"invoices:write"},
+			"spiffe://prod.example.com/*":            {"internal:call"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		cfg        ClientCertConfig
+		state      *tls.ConnectionState
+		wantCode   int
+		wantSub    string
+		wantScopes string
+	}{
+		{"spiffe allowed by prefix", cfg, verified(billing), 204, "spiffe://prod.example.com/ns/billing/sa/worker", "internal:call,invoices:write"},
+		{"spiffe allowed exact", cfg, verified(orders), 204, "spiffe://prod.example.com/ns/orders/sa/api", "internal:call"},
+		{"no tls", cfg, nil, 401, "", ""},
+		{"unverified peer cert ignored", cfg, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{billing}}, 401, "", ""},
+		{"no spiffe id", cfg, verified(noSAN), 401, "", ""},
+		{"not allowlisted", ClientCertConfig{Allow: []string{"spiffe://prod.example.com/ns/orders/*"}}, verified(billing), 403, "", ""},
+		{"common name", ClientCertConfig{Mapper: MapCommonName, Allow: []string{"legacy-service"}}, verified(noSAN), 204, "legacy-service", ""},
+		{"uri san", ClientCertConfig{Mapper: MapURISAN, Allow: []string{"*"}}, verified(httpsSAN), 204, "https://svc.example.com/id", ""},
+		{"uri san missing", ClientCertConfig{Mapper: MapURISAN, Allow: []string{"*"}}, verified(noSAN), 401, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSub, gotScopes string
+			h := ClientCert(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSub = wsctx.SubjectID(r.Context())
+				gotScopes = strings.Join(wsctx.Scopes(r.Context()), ",")
+				w.WriteHeader(204)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = tt.state
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d", tt.wantCode, rec.Code)
+			}
+			if gotSub != tt.wantSub || gotScopes != tt.wantScopes {
+				t.Fatalf("subject=%q scopes=%q", gotSub, gotScopes)
+			}
+		})
+	}
+}
+
+func TestClientCert_TenantHeaderForServices(t *testing.T) {
+	t.Parallel()
+
+	cert := testCert(t, "svc", "spiffe://prod.example.com/ns/jobs/sa/runner")
+	var gotTenant string
+	h := Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotTenant = wsctx.TenantID(r.Context())
+			w.WriteHeader(204)
+		}),
+		ClientCert(ClientCertConfig{Allow: []string{"*"}}),
+		Tenant(TenantConfig{Mode: TenantAllowHeader, Required: true}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = verified(cert)
+	req.Header.Set(HeaderTenantID, "t1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 204 || gotTenant != "t1" {
+		t.Fatalf("code=%d tenant=%q", rec.Code, gotTenant)
+	}
+}
+
+func TestClientCert_EmptyAllowPanics(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	ClientCert(ClientCertConfig{})
+}
+
+func verified(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+	wslog "github.com/hanzy-dev/saas-ws-lib/pkg/log"
+)
+
+const (
+	HeaderImpersonateSubject = "X-Impersonate-Subject"
+	HeaderImpersonateTenant  = "X-Impersonate-Tenant"
+)
+
+// ImpersonationEvent is one impersonated request.
+type ImpersonationEvent struct {
+	Impersonator string
+	SubjectID    string
+	TenantID     string
+	Method       string
+	Path         string
+	RequestID    string
+	Time         time.Time
+}
+
+// ImpersonationAudit records impersonated requests, e.g. to an append-only audit table.
+type ImpersonationAudit interface {
+	RecordImpersonation(ctx context.Context, ev ImpersonationEvent) error
+}
+
+// ImpersonationAuditFunc adapts a function to ImpersonationAudit.
+type ImpersonationAuditFunc func(ctx context.Context, ev ImpersonationEvent) error
+
+// RecordImpersonation implements ImpersonationAudit.
+func (f ImpersonationAuditFunc) RecordImpersonation(ctx context.Context, ev ImpersonationEvent) error {
+	return f(ctx, ev)
+}
+
+type ImpersonationConfig struct {
+	// Scope must be granted to the caller to impersonate via headers, e.g.
+	// "support:impersonate". Required.
+	Scope auth.Scope
+
+	// Audit records every impersonated request before it is served. Required.
+	// If recording fails the request is rejected (UNAVAILABLE): no unaudited impersonation.
+	Audit ImpersonationAudit
+
+	// Scopes are granted while impersonating via headers, replacing the caller's scopes,
+	// e.g. read-only scopes for troubleshooting. Default none: routes requiring scopes
+	// reject header impersonation.
+	Scopes []string
+
+	// SubjectHeader and TenantHeader name the target user and tenant. Both are required
+	// to impersonate. Default to X-Impersonate-Subject and X-Impersonate-Tenant.
+	SubjectHeader string
+	TenantHeader  string
+
+	// Sensitive lists routes that can never be called while impersonating, as
+	// "[METHOD ]path" with an optional trailing '*' for prefixes,
+	// e.g. "POST /payouts/*" or "/account/password". Request paths are cleaned first,
+	// so "/account//password/" matches too.
+	Sensitive []string
+
+	// Logger optionally logs every impersonated request.
+	Logger *wslog.Logger
+
+	now func() time.Time
+}
+
+// Impersonation lets support staff act as a customer user in a tenant. It runs after Auth.
+//
+// A caller holding Scope sends the impersonation headers; subject_id and tenant_id become
+// the target's and the caller is kept as the impersonator (wsctx.Impersonator, and
+// "impersonator_id" in Logger.With). The caller's scopes are replaced by Scopes, and the
+// caller's claims and memberships are cleared. Nested impersonation and impersonation by
+// delegated services are FORBIDDEN.
+// Tokens issued with an "impersonator" claim are treated the same way (see
+// AuthConfig.ImpersonatorIssuers).
+//
+// Impersonated requests to Sensitive routes are FORBIDDEN; all others are audited.
+//
+// Authorization must see the impersonated identity, so header impersonation after an
+// Auth that checked RequireScopes or Policy fails (INTERNAL). For such routes set
+// AuthConfig.Impersonation instead, which switches the identity before those checks.
+func Impersonation(cfg ImpersonationConfig) func(http.Handler) http.Handler {
+	cfg.init()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, ok := cfg.switchIdentity(w, r)
+			if !ok {
+				return
+			}
+			r = r.WithContext(ctx)
+			if !cfg.admit(w, r) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (cfg *ImpersonationConfig) init() {
+	if !cfg.Scope.Valid() {
+		panic("middleware.Impersonation requires valid Scope")
+	}
+	if cfg.Audit == nil {
+		panic("middleware.Impersonation requires non-nil Audit")
+	}
+	if cfg.SubjectHeader == "" {
+		cfg.SubjectHeader = HeaderImpersonateSubject
+	}
+	if cfg.TenantHeader == "" {
+		cfg.TenantHeader = HeaderImpersonateTenant
+	}
+	if cfg.now == nil {
+		cfg.now = time.Now
+	}
+}
+
+// switchIdentity applies the impersonation headers, if any, to the request context.
+// It writes the error response and returns false if the request must not proceed.
+func (cfg ImpersonationConfig) switchIdentity(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	ctx := r.Context()
+	subject := strings.TrimSpace(r.Header.Get(cfg.SubjectHeader))
+	tenant := strings.TrimSpace(r.Header.Get(cfg.TenantHeader))
+	if subject == "" && tenant == "" {
+		return ctx, true
+	}
+
+	caller := wsctx.SubjectID(ctx)
+	switch {
+	case caller == "":
+		wserr.WriteError(ctx, w, wserr.Unauthenticated("authentication required"))
+		return nil, false
+	case authorized(ctx):
+		// the route was authorized for the caller, not for the impersonated user
+		if cfg.Logger != nil {
+			cfg.Logger.With(ctx).Error("impersonation after authorization; use AuthConfig.Impersonation")
+		}
+		wserr.WriteError(ctx, w, wserr.Internal("internal error"))
+		return nil, false
+	case subject == "" || tenant == "":
+		wserr.WriteError(ctx, w, wserr.InvalidArgument("impersonation requires subject and tenant"))
+		return nil, false
+	case wsctx.Impersonator(ctx) != "" || len(wsctx.Actors(ctx)) > 0:
+		// no nested impersonation, and services cannot impersonate on behalf of users
+		wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+		return nil, false
+	case !auth.HasAll(wsctx.Scopes(ctx), cfg.Scope):
+		wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+		return nil, false
+	}
+
+	ctx = wsctx.WithImpersonator(ctx, caller)
+	ctx = wsctx.WithSubjectID(ctx, subject)
+	ctx = wsctx.WithTenantID(ctx, tenant)
+	// nothing of the support engineer's own authorization carries over
+	ctx = wsctx.ReplaceScopes(ctx, cfg.Scopes)
+	ctx = wsctx.ReplaceMemberships(ctx, nil)
+	ctx = wsctx.WithClaims[any](ctx, nil)
+	return ctx, true
+}
+
+// admit blocks Sensitive routes and audits impersonated requests. It writes the error
+// response and returns false if the request must not proceed.
+func (cfg ImpersonationConfig) admit(w http.ResponseWriter, r *http.Request) bool {
+	ctx := r.Context()
+	impersonator := wsctx.Impersonator(ctx)
+	if impersonator == "" {
+		return true
+	}
+
+	if cfg.sensitive(r) {
+		if cfg.Logger != nil {
+			cfg.Logger.With(ctx).Warn("impersonation blocked", "method", r.Method, "path", r.URL.Path)
+		}
+		wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+		return false
+	}
+
+	ev := ImpersonationEvent{
+		Impersonator: impersonator,
+		SubjectID:    wsctx.SubjectID(ctx),
+		TenantID:     wsctx.TenantID(ctx),
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		RequestID:    wsctx.RequestID(ctx),
+		Time:         cfg.now().UTC(),
+	}
+	if err := cfg.Audit.RecordImpersonation(ctx, ev); err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.With(ctx).Error("impersonation audit failed", "error", err.Error())
+		}
+		wserr.WriteError(ctx, w, wserr.Unavailable("service unavailable"))
+		return false
+	}
+	if cfg.Logger != nil {
+		cfg.Logger.With(ctx).Info("impersonated request", "method", r.Method, "path", r.URL.Path)
+	}
+	return true
+}
+
+func (cfg ImpersonationConfig) sensitive(r *http.Request) bool {
+	// "//x", "/x/" and "/a/../x" must not slip past "/x"
+	p := path.Clean("/" + r.URL.Path)
+	for _, route := range cfg.Sensitive {
+		method, pattern, ok := strings.Cut(route, " ")
+		if !ok {
+			method, pattern = "", route
+		}
+		if method != "" && method != r.Method {
+			continue
+		}
+		pattern = strings.TrimSpace(pattern)
+		if matchesSubject(pattern, p) || matchesSubject(pattern, p+"/") {
+			return true
+		}
+	}
+	return false
+}
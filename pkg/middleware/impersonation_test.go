@@ -0,0 +1,335 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+	wslog "github.com/hanzy-dev/saas-ws-lib/pkg/log"
+)
+
+type memoryAudit struct {
+	mu     sync.Mutex
+	events []ImpersonationEvent
+	err    error
+}
+
+func (a *memoryAudit) RecordImpersonation(ctx context.Context, ev ImpersonationEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	a.events = append(a.events, ev)
+	return nil
+}
+
+func TestImpersonation(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		subject    string
+		scopes     []string
+		actors     []string
+		imp        string // impersonator already in context (impersonation token)
+		headers    map[string]string
+		auditErr   error
+		want       int
+		wantSub    string
+		wantImp    string
+		wantEvents int
+	}{
+		{"no impersonation", "GET", "/orders", "u1", nil, nil, "", nil, nil, 204, "u1", "", 0},
+		{"impersonate", "GET", "/orders", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 204, "cust-1", "support-1", 1},
+		{"wildcard scope", "GET", "/orders", "support-1", []string{"support:*"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 204, "cust-1", "support-1", 1},
+		{"missing scope", "GET", "/orders", "u1", []string{"orders:read"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"missing tenant", "GET", "/orders", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1"}, nil, 400, "", "", 0},
+		{"unauthenticated", "GET", "/orders", "", nil, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 401, "", "", 0},
+		{"delegated service", "GET", "/orders", "support-1", []string{"support:impersonate"}, []string{"svc-a"}, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"nested", "GET", "/orders", "cust-1", []string{"support:impersonate"}, nil, "support-1",
+			map[string]string{HeaderImpersonateSubject: "cust-2", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive prefix", "POST", "/payouts/bank", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive exact any method", "GET", "/account/password", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive with trailing slash", "GET", "/account/password/", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive with double slash", "GET", "/account//password", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive with dot segments", "POST", "/orders/../payouts/bank", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive prefix root", "POST", "//payouts/", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 403, "", "", 0},
+		{"sensitive other method", "GET", "/payouts/bank", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, nil, 204, "cust-1", "support-1", 1},
+		{"impersonation token audited", "GET", "/orders", "cust-1", nil, nil, "support-1", nil, nil, 204, "cust-1", "support-1", 1},
+		{"impersonation token on sensitive route", "POST", "/payouts/x", "cust-1", nil, nil, "support-1", nil, nil, 403, "", "", 0},
+		{"audit unavailable", "GET", "/orders", "support-1", []string{"support:impersonate"}, nil, "",
+			map[string]string{HeaderImpersonateSubject: "cust-1", HeaderImpersonateTenant: "t9"}, errors.New("db down"), 503, "", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			audit := &memoryAudit{err: tt.auditErr}
+			var logs bytes.Buffer
+			h := Impersonation(ImpersonationConfig{
+				Scope:     "support:impersonate",
+				Audit:     audit,
+				Sensitive: []string{"POST /payouts/*", "/account/password"},
+				Logger:    wslog.NewJSON(wslog.Options{Out: &logs}),
+				now:       func() time.Time { return now },
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx := r.Context()
+				if got := wsctx.SubjectID(ctx); got != tt.wantSub {
+					t.Errorf("subject_id=%q want %q", got, tt.wantSub)
+				}
+				if got := wsctx.Impersonator(ctx); got != tt.wantImp {
+					t.Errorf("impersonator=%q want %q", got, tt.wantImp)
+				}
+				w.WriteHeader(204)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			ctx := wsctx.WithSubjectID(req.Context(), tt.subject)
+			ctx = wsctx.WithTenantID(ctx, "t1")
+			ctx = wsctx.WithScopes(ctx, tt.scopes)
+			ctx = wsctx.WithActors(ctx, tt.actors)
+			ctx = wsctx.WithImpersonator(ctx, tt.imp)
+			ctx = wsctx.WithRequestID(ctx, "req-1")
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req.WithContext(ctx))
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.want, rr.Body.String())
+			}
+			if len(audit.events) != tt.wantEvents {
+				t.Fatalf("events=%+v", audit.events)
+			}
+			if tt.wantEvents == 0 {
+				return
+			}
+			ev := audit.events[0]
+			if ev.Impersonator != tt.wantImp || ev.SubjectID != tt.wantSub || ev.RequestID != "req-1" ||
+				ev.Path != tt.path || !ev.Time.Equal(now) {
+				t.Fatalf("unexpected event: %+v", ev)
+			}
+			if !strings.Contains(logs.String(), `"impersonator_id":"`+tt.wantImp+`"`) ||
+				!strings.Contains(logs.String(), `"subject_id":"`+tt.wantSub+`"`) {
+				t.Fatalf("expected both identities logged, got %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestImpersonation_DropsCallerAuthorization(t *testing.T) {
+	t.Parallel()
+
+	for _, granted := range [][]string{nil, {"orders:read"}} {
+		h := Impersonation(ImpersonationConfig{
+			Scope:  "support:impersonate",
+			Scopes: granted,
+			Audit:  ImpersonationAuditFunc(func(ctx context.Context, ev ImpersonationEvent) error { return nil }),
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if got := wsctx.Scopes(ctx); strings.Join(got, " ") != strings.Join(granted, " ") {
+				t.Errorf("scopes=%v want %v", got, granted)
+			}
+			if m := wsctx.Memberships(ctx); m != nil {
+				t.Errorf("caller memberships leaked: %+v", m)
+			}
+			if _, ok := wsctx.Claims[string](ctx); ok {
+				t.Errorf("caller claims leaked")
+			}
+			w.WriteHeader(204)
+		}))
+
+		ctx := wsctx.WithSubjectID(context.Background(), "support-1")
+		ctx = wsctx.WithScopes(ctx, []string{"support:impersonate", "admin:*"})
+		ctx = wsctx.WithMemberships(ctx, []wsctx.Membership{{TenantID: "support-tenant"}})
+		ctx = wsctx.WithClaims(ctx, "support claims")
+
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx)
+		req.Header.Set(HeaderImpersonateSubject, "cust-1")
+		req.Header.Set(HeaderImpersonateTenant, "t9")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != 204 {
+			t.Fatalf("status=%d", rr.Code)
+		}
+	}
+}
+
+func TestImpersonation_ConfigPanics(t *testing.T) {
+	t.Parallel()
+
+	audit := ImpersonationAuditFunc(func(ctx context.Context, ev ImpersonationEvent) error { return nil })
+	for _, cfg := range []ImpersonationConfig{
+		{Audit: audit},
+		{Scope: "support:impersonate"},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("expected panic for %+v", cfg)
+				}
+			}()
+			_ = Impersonation(cfg)
+		}()
+	}
+}
+
+func TestTenant_SelectWhileImpersonating(t *testing.T) {
+	t.Parallel()
+
+	h := Tenant(TenantConfig{Mode: TenantSelect})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+
+	ctx := wsctx.WithSubjectID(context.Background(), "cust-1")
+	ctx = wsctx.WithTenantID(ctx, "t9")
+	ctx = wsctx.WithImpersonator(ctx, "support-1")
+	ctx = wsctx.WithMemberships(ctx, []wsctx.Membership{{TenantID: "support-tenant"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	req.Header.Set(HeaderTenantID, "support-tenant")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != 403 {
+		t.Fatalf("status=%d want=403", rr.Code)
+	}
+}
+
+func TestAuth_Impersonation(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(*jwt.Token) (any, error) { return secret, nil }}
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "support-tenant",
+		Scopes:   []string{"support:impersonate", "orders:*"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "support-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) })
+
+	tests := []struct {
+		name       string
+		granted    []string // ImpersonationConfig.Scopes
+		require    []auth.Scope
+		decision   auth.Decision
+		want       int
+		wantEvents int
+	}{
+		{"policy allows the impersonated subject", nil, nil, auth.DecisionAllow, 204, 1},
+		{"policy denies the impersonated subject", nil, nil, auth.DecisionDeny, 403, 0},
+		{"caller scopes do not satisfy RequireScopes", nil, []auth.Scope{"orders:write"}, auth.DecisionAllow, 403, 0},
+		{"granted scopes satisfy RequireScopes", []string{"orders:write"}, []auth.Scope{"orders:write"}, auth.DecisionAllow, 204, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			audit := &memoryAudit{}
+			policy := &fakePolicy{dec: tt.decision}
+			h := Auth(AuthConfig{
+				Verifier:      verifier,
+				RequireScopes: tt.require,
+				Policy:        policy,
+				Action:        "orders.refund",
+				Resource:      "orders",
+				Impersonation: &ImpersonationConfig{Scope: "support:impersonate", Scopes: tt.granted, Audit: audit},
+			})(okHandler)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/1/refund", nil)
+			req.Header.Set(HeaderAuthorization, "Bearer "+tok)
+			req.Header.Set(HeaderImpersonateSubject, "cust-1")
+			req.Header.Set(HeaderImpersonateTenant, "t9")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.want)
+			}
+			if tt.require == nil && (policy.got.SubjectID != "cust-1" || policy.got.TenantID != "t9" ||
+				strings.Join(policy.got.Scopes, " ") != strings.Join(tt.granted, " ")) {
+				t.Fatalf("policy checked %+v, want the impersonated identity", policy.got)
+			}
+			if len(audit.events) != tt.wantEvents {
+				t.Fatalf("events=%d want=%d", len(audit.events), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestImpersonation_AfterAuthorization(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(*jwt.Token) (any, error) { return secret, nil }}
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "support-tenant",
+		Scopes:   []string{"support:impersonate", "orders:*"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "support-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	audit := &memoryAudit{}
+	imp := Impersonation(ImpersonationConfig{Scope: "support:impersonate", Audit: audit})
+	for _, cfg := range []AuthConfig{
+		{Verifier: verifier, RequireScopes: []auth.Scope{"orders:write"}},
+		{Verifier: verifier, Policy: &fakePolicy{dec: auth.DecisionAllow}, Action: "orders.refund", Resource: "orders"},
+	} {
+		h := Auth(cfg)(imp(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("handler reached as %q", wsctx.SubjectID(r.Context()))
+		})))
+
+		req := httptest.NewRequest(http.MethodPost, "/orders/1/refund", nil)
+		req.Header.Set(HeaderAuthorization, "Bearer "+tok)
+		req.Header.Set(HeaderImpersonateSubject, "cust-1")
+		req.Header.Set(HeaderImpersonateTenant, "t9")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != 500 {
+			t.Fatalf("status=%d want=500", rr.Code)
+		}
+	}
+	if len(audit.events) != 0 {
+		t.Fatalf("events=%d want=0", len(audit.events))
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+)
+
+// PolicyTargetFunc derives a policy action or resource from an authenticated request
+// (see AuthConfig.ActionFunc and ResourceFunc).
+type PolicyTargetFunc func(r *http.Request) (string, error)
+
+// MethodAction maps the request method to an action, e.g.
+// {"GET": "orders.read", "POST": "orders.create", "DELETE": "orders.delete"}.
+// Unmapped methods are FORBIDDEN.
+func MethodAction(actions map[string]string) PolicyTargetFunc {
+	if len(actions) == 0 {
+		panic("middleware.MethodAction requires non-empty actions")
+	}
+	for method, action := range actions {
+		if method == "" || strings.TrimSpace(action) == "" {
+			panic("middleware.MethodAction requires non-empty methods and actions")
+		}
+	}
+	return func(r *http.Request) (string, error) {
+		action, ok := actions[r.Method]
+		if !ok {
+			return "", wserr.Forbidden("forbidden")
+		}
+		return action, nil
+	}
+}
+
+// ResourceTemplate expands a resource URN template per request, e.g.
+// "tenant/{tenant}/orders/{id}". {tenant} and {subject} are the authenticated tenant_id
+// and subject_id; any other {name} is the ServeMux path value r.PathValue(name).
+//
+// The template is validated up front. At request time every placeholder must resolve to
+// a non-empty value, otherwise the handler is misrouted and the request fails (INTERNAL).
+// Values containing '/' (e.g. an escaped "%2F"), ':', '*', '{' or '}' are INVALID_ARGUMENT,
+// so a value can neither address another resource nor act as a URN separator, wildcard or
+// placeholder in policy rules.
+func ResourceTemplate(tmpl string) PolicyTargetFunc {
+	parts, err := parseResourceTemplate(tmpl)
+	if err != nil {
+		panic("middleware.ResourceTemplate requires a valid template: " + err.Error())
+	}
+	return func(r *http.Request) (string, error) {
+		var b strings.Builder
+		for _, p := range parts {
+			if !p.placeholder {
+				b.WriteString(p.text)
+				continue
+			}
+
+			var v string
+			switch p.text {
+			case "tenant":
+				v = wsctx.TenantID(r.Context())
+			case "subject":
+				v = wsctx.SubjectID(r.Context())
+			default:
+				v = r.PathValue(p.text)
+			}
+			if v == "" {
+				return "", fmt.Errorf("middleware: resource template %q: {%s} is empty", tmpl, p.text)
+			}
+			if strings.ContainsAny(v, resourceReserved) {
+				return "", wserr.InvalidArgument("invalid resource path")
+			}
+			b.WriteString(v)
+		}
+		return b.String(), nil
+	}
+}
+
+// resourceReserved are the characters with a meaning in resources and policy rules.
+const resourceReserved = "/:*{}"
+
+type templatePart struct {
+	text        string
+	placeholder bool
+}
+
+func parseResourceTemplate(tmpl string) ([]templatePart, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		return nil, errors.New("empty template")
+	}
+	var parts []templatePart
+	for rest := tmpl; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			parts = append(parts, templatePart{text: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("unexpected '}' in %q", tmpl)
+		}
+		if open > 0 {
+			parts = append(parts, templatePart{text: rest[:open]})
+		}
+		closing := strings.IndexAny(rest[open+1:], "{}")
+		if closing < 0 || rest[open+1+closing] != '}' {
+			return nil, fmt.Errorf("unclosed '{' in %q", tmpl)
+		}
+		name := rest[open+1 : open+1+closing]
+		if !validPlaceholder(name) {
+			return nil, fmt.Errorf("invalid placeholder {%s} in %q", name, tmpl)
+		}
+		parts = append(parts, templatePart{text: name, placeholder: true})
+		rest = rest[open+2+closing:]
+	}
+	return parts, nil
+}
+
+func validPlaceholder(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
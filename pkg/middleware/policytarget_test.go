@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+)
+
+func TestAuthMiddleware_PolicyTargets(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	verifier := &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }}
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID: "t1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(secret)
+
+	tests := []struct {
+		name         string
+		method       string
+		pathValues   map[string]string
+		actionFunc   PolicyTargetFunc
+		resourceFunc PolicyTargetFunc
+		wantCode     int
+		wantAction   string
+		wantResource string
+	}{
+		{
+			name: "method and template", method: http.MethodPatch,
+			pathValues:   map[string]string{"id": "123"},
+			actionFunc:   MethodAction(map[string]string{"GET": "orders.read", "PATCH": "orders.update"}),
+			resourceFunc: ResourceTemplate("urn:shop:tenant/{tenant}/orders/{id}"),
+			wantCode:     204, wantAction: "orders.update", wantResource: "urn:shop:tenant/t1/orders/123",
+		},
+		{
+			name: "static action with subject template", method: http.MethodGet,
+			resourceFunc: ResourceTemplate("users/{subject}"),
+			wantCode:     204, wantAction: "static.action", wantResource: "users/u1",
+		},
+		{
+			name: "unmapped method", method: http.MethodDelete,
+			actionFunc: MethodAction(map[string]string{"GET": "orders.read"}),
+			wantCode:   403,
+		},
+		{
+			name: "unresolved path value", method: http.MethodGet,
+			resourceFunc: ResourceTemplate("orders/{order_id}"),
+			wantCode:     500,
+		},
+		{
+			name: "escaped slash in path value", method: http.MethodGet,
+			pathValues:   map[string]string{"id": "1/../../t2"},
+			resourceFunc: ResourceTemplate("tenant/{tenant}/orders/{id}"),
+			wantCode:     400,
+		},
+		{
+			name: "urn separator in path value", method: http.MethodGet,
+			pathValues:   map[string]string{"id": "1:t2"},
+			resourceFunc: ResourceTemplate("urn:shop:tenant/{tenant}/orders/{id}"),
+			wantCode:     400,
+		},
+		{
+			name: "wildcard in path value", method: http.MethodGet,
+			pathValues:   map[string]string{"id": "*"},
+			resourceFunc: ResourceTemplate("tenant/{tenant}/orders/{id}"),
+			wantCode:     400,
+		},
+		{
+			name: "placeholder in path value", method: http.MethodGet,
+			pathValues:   map[string]string{"id": "{subject}"},
+			resourceFunc: ResourceTemplate("tenant/{tenant}/orders/{id}"),
+			wantCode:     400,
+		},
+		{
+			name: "extractor error", method: http.MethodGet,
+			actionFunc: func(r *http.Request) (string, error) { return "", errors.New("boom") },
+			wantCode:   500,
+		},
+		{
+			name: "empty result", method: http.MethodGet,
+			actionFunc: func(r *http.Request) (string, error) { return " ", nil },
+			wantCode:   500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePolicy{dec: auth.DecisionAllow}
+			h := Auth(AuthConfig{
+				Verifier:     verifier,
+				Policy:       p,
+				Action:       "static.action",
+				Resource:     "static.resource",
+				ActionFunc:   tt.actionFunc,
+				ResourceFunc: tt.resourceFunc,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }))
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set(HeaderAuthorization, "Bearer "+signed)
+			for k, v := range tt.pathValues {
+				req.SetPathValue(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode == 204 && (p.got.Action != tt.wantAction || p.got.Resource != tt.wantResource) {
+				t.Fatalf("unexpected policy request: %q %q", p.got.Action, p.got.Resource)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_PolicyTargetsWithServeMux(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		TenantID:         "t1",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+	}).SignedString(secret)
+
+	p := &fakePolicy{dec: auth.DecisionAllow}
+	mw := Auth(AuthConfig{
+		Verifier:     &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return secret, nil }},
+		Policy:       p,
+		ActionFunc:   MethodAction(map[string]string{"GET": "orders.read"}),
+		ResourceFunc: ResourceTemplate("tenant/{tenant}/orders/{id}"),
+	})
+	mux := http.NewServeMux()
+	mux.Handle("GET /orders/{id}", mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) })))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	req.Header.Set(HeaderAuthorization, "Bearer "+signed)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != 204 || p.got.Resource != "tenant/t1/orders/42" || p.got.Action != "orders.read" {
+		t.Fatalf("unexpected result %d %+v", rec.Code, p.got)
+	}
+}
+
+func TestPolicyTargets_ConfigPanics(t *testing.T) {
+	t.Parallel()
+
+	policy := &fakePolicy{}
+	verifier := &auth.Verifier{KeyFunc: func(t *jwt.Token) (any, error) { return nil, nil }}
+
+	cases := map[string]func(){
+		"empty template":       func() { ResourceTemplate("") },
+		"unclosed placeholder": func() { ResourceTemplate("orders/{id") },
+		"stray brace":          func() { ResourceTemplate("orders/id}") },
+		"nested placeholder":   func() { ResourceTemplate("orders/{a{b}}") },
+		"empty placeholder":    func() { ResourceTemplate("orders/{}") },
+		"invalid placeholder":  func() { ResourceTemplate("orders/{id...}") },
+		"empty method actions": func() { MethodAction(nil) },
+		"empty action":         func() { MethodAction(map[string]string{"GET": ""}) },
+		"funcs without policy": func() { Auth(AuthConfig{Verifier: verifier, ActionFunc: MethodAction(map[string]string{"GET": "a"})}) },
+		"policy without resource": func() {
+			Auth(AuthConfig{Verifier: verifier, Policy: policy, ActionFunc: MethodAction(map[string]string{"GET": "a"})})
+		},
+	}
+	for name, fn := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: expected panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
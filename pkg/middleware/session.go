@@ -0,0 +1,446 @@
+package middleware
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+	"github.com/hanzy-dev/saas-ws-lib/pkg/config"
+)
+
+const HeaderCSRFToken = "X-CSRF-Token"
+
+// CSRFMode selects how state-changing session requests are protected against CSRF.
+// In both modes the client echoes the session's CSRF token in the CSRF header.
+type CSRFMode int
+
+const (
+	// CSRFSynchronizer keeps the token only in the encrypted session. Handlers hand it to
+	// the client, e.g. from a "GET /session" endpoint (see CSRFToken).
+	CSRFSynchronizer CSRFMode = iota
+
+	// CSRFDoubleSubmit also sets the token in a cookie readable by scripts. The cookie must
+	// match the header and the session, so a cookie planted by a sibling domain is rejected.
+	CSRFDoubleSubmit
+)
+
+type SessionConfig struct {
+	// Keys encrypts session cookies with AES-256-GCM under a key derived from the active
+	// HMAC secret; verify-only keys still decrypt, so secrets rotate without logging
+	// users out. Required. Only HMAC keys ([]byte) are usable.
+	Keys *auth.Keyring
+
+	// CookieName defaults to "__Host-session" in production and "session" otherwise.
+	CookieName string
+
+	// Path defaults to "/". Domain is empty (host-only) by default. "__Host-" cookies
+	// require Path "/" and no Domain.
+	Path   string
+	Domain string
+
+	// SameSite defaults to Strict in production and Lax otherwise.
+	// SameSite=None is rejected in production.
+	SameSite http.SameSite
+
+	// Insecure drops the Secure attribute for plain-HTTP local development.
+	// It is rejected in production.
+	Insecure bool
+
+	// IdleTimeout ends sessions without requests for that long. Defaults to 30m.
+	// Active sessions are refreshed at most every IdleTimeout/10.
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout ends sessions that long after Start, regardless of activity.
+	// Defaults to 12h.
+	AbsoluteTimeout time.Duration
+
+	// CSRF selects the CSRF protection applied to methods other than GET, HEAD, OPTIONS
+	// and TRACE. Defaults to CSRFSynchronizer.
+	CSRF CSRFMode
+
+	// CSRFHeader defaults to "X-CSRF-Token".
+	CSRFHeader string
+
+	// CSRFCookieName is used with CSRFDoubleSubmit. Defaults to "__Host-csrf" in
+	// production and "csrf" otherwise.
+	CSRFCookieName string
+
+	// Revocation optionally ends sessions whose claims were revoked by jti or by a
+	// subject-wide cutoff (see auth.RevocationStore), e.g. after logout-everywhere.
+	// Claims without "iat" are dated by the session start. Store failures fail closed.
+	Revocation auth.RevocationStore
+
+	now func() time.Time
+}
+
+// SessionManager issues and verifies encrypted session cookies for browser clients.
+// Start a session after login, then set AuthConfig.Sessions so that Auth accepts the
+// cookie; the session principal ends up in context exactly like a token's.
+type SessionManager struct {
+	cfg SessionConfig
+}
+
+// NewSessionManager validates cfg and applies defaults. Cookie attributes are stricter
+// when config.IsProd() reports production.
+func NewSessionManager(cfg SessionConfig) (*SessionManager, error) {
+	if cfg.Keys == nil {
+		return nil, errors.New("middleware: session requires non-nil Keys")
+	}
+	if _, err := activeSessionKey(cfg.Keys); err != nil {
+		return nil, err
+	}
+
+	prod := config.IsProd()
+	if cfg.CookieName == "" {
+		cfg.CookieName = "session"
+		if prod {
+			cfg.CookieName = "__Host-session"
+		}
+	}
+	if cfg.CSRFCookieName == "" {
+		cfg.CSRFCookieName = "csrf"
+		if prod {
+			cfg.CSRFCookieName = "__Host-csrf"
+		}
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.SameSite == 0 || cfg.SameSite == http.SameSiteDefaultMode {
+		cfg.SameSite = http.SameSiteLaxMode
+		if prod {
+			cfg.SameSite = http.SameSiteStrictMode
+		}
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 30 * time.Minute
+	}
+	if cfg.AbsoluteTimeout <= 0 {
+		cfg.AbsoluteTimeout = 12 * time.Hour
+	}
+	if cfg.CSRFHeader == "" {
+		cfg.CSRFHeader = HeaderCSRFToken
+	}
+	if cfg.now == nil {
+		cfg.now = time.Now
+	}
+
+	if prod && cfg.Insecure {
+		return nil, errors.New("middleware: session Insecure is not allowed in production")
+	}
+	if prod && cfg.SameSite == http.SameSiteNoneMode {
+		return nil, errors.New("middleware: session SameSite=None is not allowed in production")
+	}
+	if cfg.CSRF != CSRFSynchronizer && cfg.CSRF != CSRFDoubleSubmit {
+		return nil, fmt.Errorf("middleware: unknown session CSRF mode %d", int(cfg.CSRF))
+	}
+	if cfg.IdleTimeout > cfg.AbsoluteTimeout {
+		return nil, errors.New("middleware: session IdleTimeout exceeds AbsoluteTimeout")
+	}
+	for _, name := range []string{cfg.CookieName, cfg.CSRFCookieName} {
+		if strings.HasPrefix(name, "__Host-") && (cfg.Insecure || cfg.Domain != "" || cfg.Path != "/") {
+			return nil, fmt.Errorf("middleware: cookie %q requires Secure, Path \"/\" and no Domain", name)
+		}
+		if strings.HasPrefix(name, "__Secure-") && cfg.Insecure {
+			return nil, fmt.Errorf("middleware: cookie %q requires Secure", name)
+		}
+	}
+	if cfg.CookieName == cfg.CSRFCookieName {
+		return nil, errors.New("middleware: session and CSRF cookies need different names")
+	}
+	return &SessionManager{cfg: cfg}, nil
+}
+
+// sessionState is the encrypted cookie payload.
+type sessionState struct {
+	Claims  *auth.Claims `json:"claims"`
+	CSRF    string       `json:"csrf"`
+	Created int64        `json:"created"`
+	Seen    int64        `json:"seen"`
+}
+
+// Start begins a session for claims, typically after a password or OIDC login, and
+// returns the CSRF token for the client. Only *auth.Claims are kept; custom claims of
+// typed verifiers are not. The session ends no later than the claims' "exp". Call it
+// again after a privilege change (e.g. step-up) so the CSRF token is renewed.
+func (m *SessionManager) Start(w http.ResponseWriter, claims *auth.Claims) (string, error) {
+	if claims == nil || strings.TrimSpace(claims.Subject) == "" {
+		return "", errors.New("middleware: session requires claims with a subject")
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("middleware: generate csrf token: %w", err)
+	}
+
+	if claims.ExpiresAt != nil && !m.cfg.now().Before(claims.ExpiresAt.Time) {
+		return "", errors.New("middleware: session claims are expired")
+	}
+	now := m.cfg.now().Unix()
+	st := &sessionState{
+		Claims:  claims,
+		CSRF:    base64.RawURLEncoding.EncodeToString(raw),
+		Created: now,
+		Seen:    now,
+	}
+	if err := m.write(w, st); err != nil {
+		return "", err
+	}
+	return st.CSRF, nil
+}
+
+// End clears the session cookies, e.g. on logout.
+func (m *SessionManager) End(w http.ResponseWriter) {
+	http.SetCookie(w, m.cookie(m.cfg.CookieName, "", -1, true))
+	if m.cfg.CSRF == CSRFDoubleSubmit {
+		http.SetCookie(w, m.cookie(m.cfg.CSRFCookieName, "", -1, false))
+	}
+}
+
+var (
+	errSessionInvalid = errors.New("middleware: invalid session")
+	errSessionExpired = errors.New("middleware: session expired")
+	errSessionRevoked = errors.New("middleware: session revoked")
+	errCSRF           = errors.New("middleware: csrf token mismatch")
+)
+
+// authenticate verifies the session cookie, its timeouts, the "exp" of its claims and
+// revocation, the CSRF token of state-changing requests, and refreshes the cookie of
+// active sessions. It returns errNoCredentials without a cookie.
+func (m *SessionManager) authenticate(w http.ResponseWriter, r *http.Request) (*sessionState, error) {
+	c, err := r.Cookie(m.cfg.CookieName)
+	if err != nil || c.Value == "" {
+		return nil, errNoCredentials
+	}
+
+	st, err := m.open(c.Value)
+	if err != nil {
+		m.End(w)
+		return nil, err
+	}
+
+	now := m.cfg.now()
+	if now.Unix()-st.Seen >= int64(m.cfg.IdleTimeout/time.Second) ||
+		now.Unix()-st.Created >= int64(m.cfg.AbsoluteTimeout/time.Second) ||
+		(st.Claims.ExpiresAt != nil && !now.Before(st.Claims.ExpiresAt.Time)) {
+		m.End(w)
+		return nil, errSessionExpired
+	}
+	if err := m.checkRevocation(r.Context(), st); err != nil {
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			m.End(w)
+			return nil, errSessionRevoked
+		}
+		return nil, err
+	}
+
+	if !isSafeMethod(r.Method) && !m.checkCSRF(r, st.CSRF) {
+		return nil, errCSRF
+	}
+
+	if now.Sub(time.Unix(st.Seen, 0)) >= m.cfg.IdleTimeout/10 {
+		st.Seen = now.Unix()
+		if err := m.write(w, st); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+func (m *SessionManager) checkRevocation(ctx context.Context, st *sessionState) error {
+	if m.cfg.Revocation == nil {
+		return nil
+	}
+	claims := st.Claims
+	if claims.IssuedAt == nil {
+		dated := *claims
+		dated.IssuedAt = jwt.NewNumericDate(time.Unix(st.Created, 0))
+		claims = &dated
+	}
+	return auth.CheckRevocation(ctx, m.cfg.Revocation, claims)
+}
+
+func (m *SessionManager) checkCSRF(r *http.Request, want string) bool {
+	got := r.Header.Get(m.cfg.CSRFHeader)
+	if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return false
+	}
+	if m.cfg.CSRF == CSRFDoubleSubmit {
+		c, err := r.Cookie(m.cfg.CSRFCookieName)
+		if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(want)) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// write seals st with the active key and sets the cookies, expiring at the earliest of
+// the idle and absolute deadlines and the "exp" of the claims.
+func (m *SessionManager) write(w http.ResponseWriter, st *sessionState) error {
+	key, err := activeSessionKey(m.cfg.Keys)
+	if err != nil {
+		return err
+	}
+	value, err := m.seal(key, st)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Unix(st.Seen, 0).Add(m.cfg.IdleTimeout)
+	if absolute := time.Unix(st.Created, 0).Add(m.cfg.AbsoluteTimeout); absolute.Before(expires) {
+		expires = absolute
+	}
+	if exp := st.Claims.ExpiresAt; exp != nil && exp.Before(expires) {
+		expires = exp.Time
+	}
+	maxAge := int(expires.Sub(m.cfg.now()) / time.Second)
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(w, m.cookie(m.cfg.CookieName, value, maxAge, true))
+	if m.cfg.CSRF == CSRFDoubleSubmit {
+		http.SetCookie(w, m.cookie(m.cfg.CSRFCookieName, st.CSRF, maxAge, false))
+	}
+	return nil
+}
+
+func (m *SessionManager) cookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     m.cfg.Path,
+		Domain:   m.cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   !m.cfg.Insecure,
+		HttpOnly: httpOnly,
+		SameSite: m.cfg.SameSite,
+	}
+}
+
+// maxCookieSize keeps cookies within the 4096 bytes browsers are required to store.
+const maxCookieSize = 4000
+
+// seal encodes st as "<base64url kid>.<base64url nonce|ciphertext>". The cookie name and
+// kid are authenticated as additional data.
+func (m *SessionManager) seal(key auth.SigningKey, st *sessionState) (string, error) {
+	plain, err := json.Marshal(st)
+	if err != nil {
+		return "", fmt.Errorf("middleware: encode session: %w", err)
+	}
+	aead, err := sessionAEAD(key.Key.([]byte))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("middleware: generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plain, m.additionalData(key.ID))
+
+	value := base64.RawURLEncoding.EncodeToString([]byte(key.ID)) + "." +
+		base64.RawURLEncoding.EncodeToString(sealed)
+	if len(value) > maxCookieSize {
+		return "", fmt.Errorf("middleware: session cookie exceeds %d bytes", maxCookieSize)
+	}
+	return value, nil
+}
+
+func (m *SessionManager) open(value string) (*sessionState, error) {
+	encKID, encSealed, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errSessionInvalid
+	}
+	kid, err := base64.RawURLEncoding.DecodeString(encKID)
+	if err != nil {
+		return nil, errSessionInvalid
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encSealed)
+	if err != nil {
+		return nil, errSessionInvalid
+	}
+
+	key, ok := m.cfg.Keys.Lookup(string(kid))
+	if !ok {
+		return nil, errSessionInvalid
+	}
+	secret, ok := key.Key.([]byte)
+	if !ok {
+		return nil, errSessionInvalid
+	}
+	aead, err := sessionAEAD(secret)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errSessionInvalid
+	}
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], m.additionalData(key.ID))
+	if err != nil {
+		return nil, errSessionInvalid
+	}
+
+	var st sessionState
+	if err := json.Unmarshal(plain, &st); err != nil || st.Claims == nil || st.Claims.Subject == "" || st.CSRF == "" {
+		return nil, errSessionInvalid
+	}
+	return &st, nil
+}
+
+func (m *SessionManager) additionalData(kid string) []byte {
+	return []byte(m.cfg.CookieName + "\x00" + kid)
+}
+
+// sessionAEAD derives a dedicated AES-256 key from an HMAC secret, so the same secret
+// is never used directly for two algorithms.
+func sessionAEAD(secret []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("saas-ws-lib session cookie v1"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("middleware: session cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func activeSessionKey(keys *auth.Keyring) (auth.SigningKey, error) {
+	key, err := keys.Active()
+	if err != nil {
+		return auth.SigningKey{}, err
+	}
+	if _, ok := key.Key.([]byte); !ok {
+		return auth.SigningKey{}, fmt.Errorf("middleware: session key %q is not an HMAC secret", key.ID)
+	}
+	return key, nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+type csrfTokenKey struct{}
+
+// CSRFToken returns the CSRF token of the session that authenticated the request, or ""
+// for token and API key requests. Clients send it back in the CSRF header.
+func CSRFToken(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	v, _ := ctx.Value(csrfTokenKey{}).(string)
+	return v
+}
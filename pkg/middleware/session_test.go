@@ -0,0 +1,406 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
+	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
+)
+
+func sessionKey(id string, state auth.KeyState, fill string) auth.KeyringKey {
+	return auth.KeyringKey{
+		SigningKey: auth.SigningKey{ID: id, Method: jwt.SigningMethodHS256, Key: []byte(strings.Repeat(fill, 32))},
+		State:      state,
+	}
+}
+
+type sessionFixture struct {
+	m     *SessionManager
+	keys  *auth.Keyring
+	now   time.Time
+	h     http.Handler
+	gotOK bool
+	csrf  string
+}
+
+func newSessionFixture(t *testing.T, cfg SessionConfig) *sessionFixture {
+	t.Helper()
+	keys, err := auth.NewKeyring(sessionKey("k1", auth.KeyActive, "a"))
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	f := &sessionFixture{keys: keys, now: time.Unix(1_700_000_000, 0)}
+	cfg.Keys = keys
+	cfg.now = func() time.Time { return f.now }
+	if f.m, err = NewSessionManager(cfg); err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	f.h = Auth(AuthConfig{Sessions: f.m})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		f.gotOK = wsctx.SubjectID(ctx) == "u1" && wsctx.TenantID(ctx) == "t1" &&
+			len(wsctx.Scopes(ctx)) == 1 && CSRFToken(ctx) == f.csrf
+		w.WriteHeader(204)
+	}))
+	return f
+}
+
+func (f *sessionFixture) start(t *testing.T) []*http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	csrf, err := f.m.Start(rec, &auth.Claims{
+		TenantID:         "t1",
+		Scopes:           []string{"orders:read"},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	f.csrf = csrf
+	return rec.Result().Cookies()
+}
+
+func (f *sessionFixture) do(method string, cookies []*http.Cookie, header map[string]string) *httptest.ResponseRecorder {
+	f.gotOK = false
+	req := httptest.NewRequest(method, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	f.h.ServeHTTP(rec, req)
+	return rec
+}
+
+func cookieNamed(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, c := range cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSession_AuthAndCSRF(t *testing.T) {
+	t.Parallel()
+
+	f := newSessionFixture(t, SessionConfig{})
+	cookies := f.start(t)
+
+	c := cookieNamed(cookies, "session")
+	if c == nil || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/" ||
+		c.MaxAge != int((30*time.Minute)/time.Second) {
+		t.Fatalf("unexpected session cookie: %+v", c)
+	}
+	encKID, encSealed, _ := strings.Cut(c.Value, ".")
+	sealed, err := base64.RawURLEncoding.DecodeString(encSealed)
+	if err != nil {
+		t.Fatalf("decode cookie: %v", err)
+	}
+	if bytes.Contains(sealed, []byte(`"sub":"u1"`)) {
+		t.Fatalf("session cookie must be encrypted")
+	}
+	sealed[len(sealed)/2] ^= 0x01
+	tampered := encKID + "." + base64.RawURLEncoding.EncodeToString(sealed)
+	if cookieNamed(cookies, "csrf") != nil {
+		t.Fatalf("synchronizer mode must not set a csrf cookie")
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		cookies  []*http.Cookie
+		header   map[string]string
+		wantCode int
+	}{
+		{"get", http.MethodGet, cookies, nil, 204},
+		{"post without csrf", http.MethodPost, cookies, nil, 403},
+		{"post with wrong csrf", http.MethodPost, cookies, map[string]string{HeaderCSRFToken: "x"}, 403},
+		{"post with csrf", http.MethodPost, cookies, map[string]string{HeaderCSRFToken: f.csrf}, 204},
+		{"no cookie", http.MethodGet, nil, nil, 401},
+		{"tampered", http.MethodGet, []*http.Cookie{{Name: "session", Value: tampered}}, nil, 401},
+		{"garbage", http.MethodGet, []*http.Cookie{{Name: "session", Value: "nope"}}, nil, 401},
+		{"bearer wins over cookie", http.MethodGet, cookies, map[string]string{HeaderAuthorization: "Bearer x.y.z"}, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.do(tt.method, tt.cookies, tt.header)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode == 204 && !f.gotOK {
+				t.Fatalf("principal not in context")
+			}
+		})
+	}
+}
+
+func TestSession_DoubleSubmit(t *testing.T) {
+	t.Parallel()
+
+	f := newSessionFixture(t, SessionConfig{CSRF: CSRFDoubleSubmit})
+	cookies := f.start(t)
+
+	csrfCookie := cookieNamed(cookies, "csrf")
+	if csrfCookie == nil || csrfCookie.HttpOnly || csrfCookie.Value != f.csrf {
+		t.Fatalf("unexpected csrf cookie: %+v", csrfCookie)
+	}
+	session := cookieNamed(cookies, "session")
+	header := map[string]string{HeaderCSRFToken: f.csrf}
+
+	if rec := f.do(http.MethodPost, cookies, header); rec.Code != 204 {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if rec := f.do(http.MethodPost, []*http.Cookie{session}, header); rec.Code != 403 {
+		t.Fatalf("expected 403 without csrf cookie, got %d", rec.Code)
+	}
+	planted := []*http.Cookie{session, {Name: "csrf", Value: "planted"}}
+	if rec := f.do(http.MethodPost, planted, map[string]string{HeaderCSRFToken: "planted"}); rec.Code != 403 {
+		t.Fatalf("expected 403 for planted csrf cookie, got %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	f.m.End(rec)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 || c.Value != "" {
+			t.Fatalf("expected cleared cookie, got %+v", c)
+		}
+	}
+	if len(rec.Result().Cookies()) != 2 {
+		t.Fatalf("expected both cookies cleared")
+	}
+}
+
+func TestSession_Timeouts(t *testing.T) {
+	t.Parallel()
+
+	f := newSessionFixture(t, SessionConfig{IdleTimeout: 10 * time.Minute, AbsoluteTimeout: time.Hour})
+	cookies := f.start(t)
+	start := f.now
+
+	// within the refresh interval the cookie is not re-issued
+	f.now = start.Add(30 * time.Second)
+	if rec := f.do(http.MethodGet, cookies, nil); rec.Code != 204 || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("expected 204 without refresh, got %d %v", rec.Code, rec.Result().Cookies())
+	}
+
+	// activity keeps the session alive past the idle timeout
+	for i := 1; i <= 7; i++ {
+		f.now = start.Add(time.Duration(i) * 8 * time.Minute)
+		rec := f.do(http.MethodGet, cookies, nil)
+		if rec.Code != 204 {
+			t.Fatalf("step %d: expected 204, got %d", i, rec.Code)
+		}
+		if refreshed := rec.Result().Cookies(); len(refreshed) == 1 {
+			cookies = refreshed
+		} else {
+			t.Fatalf("step %d: expected refreshed cookie", i)
+		}
+	}
+	// the last refresh expires with the absolute deadline
+	if c := cookies[0]; c.MaxAge != int((4*time.Minute)/time.Second) {
+		t.Fatalf("expected max-age capped by absolute timeout, got %d", c.MaxAge)
+	}
+
+	// absolute timeout ends the session despite activity
+	f.now = start.Add(time.Hour)
+	rec := f.do(http.MethodGet, cookies, nil)
+	if rec.Code != 401 {
+		t.Fatalf("expected 401 after absolute timeout, got %d", rec.Code)
+	}
+	if c := rec.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Fatalf("expected session cookie cleared, got %v", c)
+	}
+
+	// idle timeout
+	f.now = start
+	cookies = f.start(t)
+	f.now = start.Add(10 * time.Minute)
+	if rec := f.do(http.MethodGet, cookies, nil); rec.Code != 401 {
+		t.Fatalf("expected 401 after idle timeout, got %d", rec.Code)
+	}
+}
+
+func TestSession_KeyRotation(t *testing.T) {
+	t.Parallel()
+
+	f := newSessionFixture(t, SessionConfig{})
+	cookies := f.start(t)
+
+	if err := f.keys.Reload([]auth.KeyringKey{
+		sessionKey("k1", auth.KeyVerifyOnly, "a"),
+		sessionKey("k2", auth.KeyActive, "b"),
+	}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	f.now = f.now.Add(5 * time.Minute)
+	rec := f.do(http.MethodGet, cookies, nil)
+	if rec.Code != 204 || len(rec.Result().Cookies()) != 1 {
+		t.Fatalf("expected old session accepted and re-sealed, got %d", rec.Code)
+	}
+	resealed := rec.Result().Cookies()
+
+	if err := f.keys.Reload([]auth.KeyringKey{
+		sessionKey("k1", auth.KeyRetired, "a"),
+		sessionKey("k2", auth.KeyActive, "b"),
+	}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if rec := f.do(http.MethodGet, cookies, nil); rec.Code != 401 {
+		t.Fatalf("expected session sealed with retired key rejected, got %d", rec.Code)
+	}
+	if rec := f.do(http.MethodGet, resealed, nil); rec.Code != 204 {
+		t.Fatalf("expected re-sealed session accepted, got %d", rec.Code)
+	}
+}
+
+func TestSession_RevocationAndExpiry(t *testing.T) {
+	t.Parallel()
+
+	store := auth.NewMemoryRevocationStore()
+	f := newSessionFixture(t, SessionConfig{Revocation: store})
+	startWith := func(claims auth.Claims) []*http.Cookie {
+		t.Helper()
+		claims.Subject = "u1"
+		rec := httptest.NewRecorder()
+		if _, err := f.m.Start(rec, &claims); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		return rec.Result().Cookies()
+	}
+	ctx := context.Background()
+
+	byID := startWith(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "j1"}})
+	if rec := f.do(http.MethodGet, byID, nil); rec.Code != 204 {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	_ = store.Revoke(ctx, "j1", time.Now().Add(time.Hour))
+	rec := f.do(http.MethodGet, byID, nil)
+	if rec.Code != 401 {
+		t.Fatalf("expected revoked jti rejected, got %d", rec.Code)
+	}
+	if c := rec.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Fatalf("expected session cookie cleared, got %v", c)
+	}
+
+	// without "iat" the session start dates the claims for the subject cutoff
+	bySubject := startWith(auth.Claims{})
+	_ = store.RevokeSubject(ctx, "u1", f.now.Add(time.Second))
+	if rec := f.do(http.MethodGet, bySubject, nil); rec.Code != 401 {
+		t.Fatalf("expected session before cutoff rejected, got %d", rec.Code)
+	}
+	f.now = f.now.Add(time.Minute)
+	if rec := f.do(http.MethodGet, startWith(auth.Claims{}), nil); rec.Code != 204 {
+		t.Fatalf("expected session after cutoff accepted, got %d", rec.Code)
+	}
+
+	// the claims' exp ends the session before the idle timeout
+	exp := f.now.Add(5 * time.Minute)
+	expiring := startWith(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)}})
+	if c := cookieNamed(expiring, "session"); c == nil || c.MaxAge != int((5*time.Minute)/time.Second) {
+		t.Fatalf("expected max-age capped by exp, got %+v", c)
+	}
+	f.now = exp
+	if rec := f.do(http.MethodGet, expiring, nil); rec.Code != 401 {
+		t.Fatalf("expected session past exp rejected, got %d", rec.Code)
+	}
+	if _, err := f.m.Start(httptest.NewRecorder(), &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", ExpiresAt: jwt.NewNumericDate(exp)},
+	}); err == nil {
+		t.Fatalf("expected error for expired claims")
+	}
+
+	unavailable := newSessionFixture(t, SessionConfig{Revocation: failingRevocation{}})
+	if rec := unavailable.do(http.MethodGet, unavailable.start(t), nil); rec.Code != 503 {
+		t.Fatalf("expected 503 when the store is down, got %d", rec.Code)
+	}
+}
+
+func TestNewSessionManager_Config(t *testing.T) {
+	t.Parallel()
+
+	hmacKeys, _ := auth.NewKeyring(sessionKey("k1", auth.KeyActive, "a"))
+	ec, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecKeys, _ := auth.NewKeyring(auth.KeyringKey{
+		SigningKey: auth.SigningKey{ID: "ec", Method: jwt.SigningMethodES256, Key: ec},
+		State:      auth.KeyActive,
+	})
+
+	bad := map[string]SessionConfig{
+		"nil keys":          {},
+		"asymmetric key":    {Keys: ecKeys},
+		"idle > absolute":   {Keys: hmacKeys, IdleTimeout: 2 * time.Hour, AbsoluteTimeout: time.Hour},
+		"host with domain":  {Keys: hmacKeys, CookieName: "__Host-s", Domain: "example.com"},
+		"host insecure":     {Keys: hmacKeys, CookieName: "__Host-s", Insecure: true},
+		"secure insecure":   {Keys: hmacKeys, CookieName: "__Secure-s", Insecure: true},
+		"same cookie names": {Keys: hmacKeys, CookieName: "s", CSRFCookieName: "s"},
+		"unknown csrf mode": {Keys: hmacKeys, CSRF: CSRFMode(9)},
+	}
+	for name, cfg := range bad {
+		if _, err := NewSessionManager(cfg); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m, err := NewSessionManager(SessionConfig{Keys: hmacKeys, Insecure: true})
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	if _, err := m.Start(rec, &auth.Claims{}); err == nil {
+		t.Fatalf("expected error without subject")
+	}
+	if _, err := m.Start(rec, &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if c := rec.Result().Cookies()[0]; c.Secure {
+		t.Fatalf("expected insecure cookie in development")
+	}
+	if _, err := m.Start(httptest.NewRecorder(), &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+		Scopes:           []string{strings.Repeat("s", 4096)},
+	}); err == nil {
+		t.Fatalf("expected error for oversized session")
+	}
+}
+
+func TestNewSessionManager_ProductionDefaults(t *testing.T) {
+	t.Setenv("APP_ENV", "prod")
+
+	keys, _ := auth.NewKeyring(sessionKey("k1", auth.KeyActive, "a"))
+	if _, err := NewSessionManager(SessionConfig{Keys: keys, Insecure: true}); err == nil {
+		t.Fatalf("expected Insecure rejected in production")
+	}
+	if _, err := NewSessionManager(SessionConfig{Keys: keys, SameSite: http.SameSiteNoneMode}); err == nil {
+		t.Fatalf("expected SameSite=None rejected in production")
+	}
+
+	m, err := NewSessionManager(SessionConfig{Keys: keys, CSRF: CSRFDoubleSubmit})
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	if _, err := m.Start(rec, &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+	for _, name := range []string{"__Host-session", "__Host-csrf"} {
+		c := cookieNamed(cookies, name)
+		if c == nil || !c.Secure || c.SameSite != http.SameSiteStrictMode || c.Domain != "" || c.Path != "/" {
+			t.Fatalf("unexpected %s cookie: %+v", name, c)
+		}
+	}
+}
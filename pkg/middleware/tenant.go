@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
 	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
 	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
 )
@@ -17,6 +18,16 @@ const (
 	TenantFromContext TenantMode = iota
 	// TenantAllowHeader allows tenant_id override from a header (intended for internal calls only).
 	TenantAllowHeader
+	// TenantSelect lets an authenticated user pick one of their tenants per request, from the
+	// path (PathValue) or Header, falling back to the token tenant_id. The selection is
+	// validated against the memberships set by Auth; other tenants are FORBIDDEN.
+	//
+	// For a tenant other than the token's, scopes are replaced by the membership scopes
+	// (none if the membership has none); token scopes never carry over to another tenant.
+	// AuthConfig.RequireScopes and AuthConfig.Policy run in Auth, before the selection,
+	// against the token tenant: authorize the selected tenant with TenantConfig.RequireScopes
+	// or a policy check after Tenant.
+	TenantSelect
 )
 
 type TenantConfig struct {
@@ -24,6 +35,15 @@ type TenantConfig struct {
 	Required bool
 	Header   string
 
+	// PathValue is the route wildcard holding the tenant in TenantSelect mode, e.g. "tenant"
+	// for "/t/{tenant}/orders". It takes precedence over Header.
+	PathValue string
+
+	// RequireScopes enforces scopes after tenant selection, i.e. against the per-tenant
+	// scopes of the selected membership. Use it instead of AuthConfig.RequireScopes when
+	// tokens carry memberships with scopes.
+	RequireScopes []auth.Scope
+
 	// AllowHeaderWithoutAuth allows reading tenant_id from header even when subject_id is empty.
 	// Default false. Keep this disabled for public edge handlers.
 	AllowHeaderWithoutAuth bool
@@ -33,6 +53,11 @@ func Tenant(cfg TenantConfig) func(http.Handler) http.Handler {
 	if cfg.Header == "" {
 		cfg.Header = HeaderTenantID
 	}
+	for _, sc := range cfg.RequireScopes {
+		if !sc.Valid() {
+			panic("middleware.Tenant requires valid RequireScopes, got " + sc.String())
+		}
+	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,6 +75,34 @@ func Tenant(cfg TenantConfig) func(http.Handler) http.Handler {
 				}
 			}
 
+			// user-selected tenant, validated against memberships
+			if cfg.Mode == TenantSelect && wsctx.SubjectID(ctx) != "" {
+				selected := tid
+				if cfg.PathValue != "" && strings.TrimSpace(r.PathValue(cfg.PathValue)) != "" {
+					selected = strings.TrimSpace(r.PathValue(cfg.PathValue))
+				} else if h := strings.TrimSpace(r.Header.Get(cfg.Header)); h != "" {
+					selected = h
+				}
+
+				if selected != "" {
+					memberships := wsctx.Memberships(ctx)
+					if wsctx.Impersonator(ctx) != "" {
+						// memberships are the impersonator's, not the impersonated user's
+						memberships = nil
+					}
+					m, ok := selectMembership(memberships, tid, selected)
+					if !ok {
+						wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+						return
+					}
+					ctx = wsctx.WithTenantID(ctx, selected)
+					if selected != tid || m.Scopes != nil {
+						// token scopes belong to the token tenant only
+						ctx = wsctx.ReplaceScopes(ctx, m.Scopes)
+					}
+				}
+			}
+
 			if cfg.Required && wsctx.TenantID(ctx) == "" {
 				if wsctx.SubjectID(ctx) == "" {
 					wserr.WriteError(ctx, w, wserr.Unauthenticated("missing authentication"))
@@ -59,7 +112,23 @@ func Tenant(cfg TenantConfig) func(http.Handler) http.Handler {
 				return
 			}
 
+			if len(cfg.RequireScopes) > 0 && !auth.HasAll(wsctx.Scopes(ctx), cfg.RequireScopes...) {
+				wserr.WriteError(ctx, w, wserr.Forbidden("forbidden"))
+				return
+			}
+
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// selectMembership finds the membership for selected. The token tenant is always
+// allowed, with the token scopes unless its membership sets scopes.
+func selectMembership(memberships []wsctx.Membership, tokenTenant, selected string) (wsctx.Membership, bool) {
+	for _, m := range memberships {
+		if m.TenantID == selected {
+			return m, true
+		}
+	}
+	return wsctx.Membership{TenantID: tokenTenant}, selected == tokenTenant
+}
@@ -1,10 +1,15 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hanzy-dev/saas-ws-lib/pkg/auth"
 	wsctx "github.com/hanzy-dev/saas-ws-lib/pkg/ctx"
 )
 
@@ -113,3 +118,168 @@ func TestTenant_AllowHeaderWithoutAuth(t *testing.T) {
 		t.Fatalf("status=%d want=204 body=%s", rr.Code, rr.Body.String())
 	}
 }
+
+func TestTenant_Select(t *testing.T) {
+	t.Parallel()
+
+	memberships := []wsctx.Membership{
+		{TenantID: "t1", Roles: []string{"owner"}},
+		{TenantID: "t2", Roles: []string{"viewer"}, Scopes: []string{"orders:read"}},
+		{TenantID: "t3", Roles: []string{"guest"}},
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		header      string
+		memberships []wsctx.Membership
+		want        int
+		wantTenant  string
+		wantScopes  string
+	}{
+		{"default tenant", "/x", "", memberships, 204, "t1", "orders:*"},
+		{"header selects member tenant", "/x", "t2", memberships, 204, "t2", "orders:read"},
+		{"path selects member tenant", "/t/t2/orders", "", memberships, 204, "t2", "orders:read"},
+		{"path wins over header", "/t/t2/orders", "t1", memberships, 204, "t2", "orders:read"},
+		{"membership without scopes drops token scopes", "/t/t3/orders", "", memberships, 204, "t3", ""},
+		{"header selects foreign tenant", "/x", "t4", memberships, 403, "", ""},
+		{"path selects foreign tenant", "/t/t4/orders", "", memberships, 403, "", ""},
+		{"no memberships allows token tenant", "/t/t1/orders", "", nil, 204, "t1", "orders:*"},
+		{"no memberships rejects other tenant", "/t/t2/orders", "", nil, 403, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			h := Tenant(TenantConfig{Mode: TenantSelect, Required: true, PathValue: "tenant"})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctx := r.Context()
+					if got := wsctx.TenantID(ctx); got != tt.wantTenant {
+						t.Errorf("tenant_id=%q want %q", got, tt.wantTenant)
+					}
+					if got := strings.Join(wsctx.Scopes(ctx), " "); got != tt.wantScopes {
+						t.Errorf("scopes=%q want %q", got, tt.wantScopes)
+					}
+					w.WriteHeader(204)
+				}),
+			)
+			mux.Handle("/t/{tenant}/orders", h)
+			mux.Handle("/x", h)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderTenantID, tt.header)
+			}
+			ctx := wsctx.WithSubjectID(req.Context(), "u1")
+			ctx = wsctx.WithTenantID(ctx, "t1")
+			ctx = wsctx.WithScopes(ctx, []string{"orders:*"})
+			ctx = wsctx.WithMemberships(ctx, tt.memberships)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req.WithContext(ctx))
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTenant_SelectWithPinnedIssuer(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("customer-idp-secret")
+	keyFunc := func(t *jwt.Token) (any, error) { return secret, nil }
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "https://idp.acme.example",
+		"sub": "u1",
+		"memberships": []map[string]any{
+			{"tenant_id": "victim", "scopes": []string{"*"}},
+			{"tenant_id": "acme", "scopes": []string{"orders:read"}},
+		},
+	}).SignedString(secret)
+
+	tests := []struct {
+		name       string
+		trust      bool
+		tenant     string
+		want       int
+		wantScopes string
+	}{
+		{"foreign tenant", false, "victim", 403, ""},
+		{"pinned tenant", false, "acme", 204, ""},
+		{"trusted foreign tenant", true, "victim", 403, ""},
+		{"trusted pinned tenant", true, "acme", 204, "orders:read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mv, err := auth.NewMultiVerifier(auth.Verifier{KeyFunc: keyFunc, Config: auth.VerifyConfig{
+				Issuer: "https://idp.acme.example",
+				Claims: auth.ClaimMapping{FixedTenantID: "acme", TrustMemberships: tt.trust},
+			}})
+			if err != nil {
+				t.Fatalf("NewMultiVerifier: %v", err)
+			}
+			h := Auth(AuthConfig{Verifier: mv})(Tenant(TenantConfig{Mode: TenantSelect, Required: true})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if got := wsctx.TenantID(r.Context()); got != "acme" {
+						t.Errorf("tenant_id=%q", got)
+					}
+					if got := strings.Join(wsctx.Scopes(r.Context()), " "); got != tt.wantScopes {
+						t.Errorf("scopes=%q want %q", got, tt.wantScopes)
+					}
+					w.WriteHeader(204)
+				}),
+			))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(HeaderAuthorization, "Bearer "+signed)
+			req.Header.Set(HeaderTenantID, tt.tenant)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTenant_RequireScopesAfterSelection(t *testing.T) {
+	t.Parallel()
+
+	h := Tenant(TenantConfig{Mode: TenantSelect, RequireScopes: []auth.Scope{"orders:write"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m, ok := wsctx.CurrentMembership(r.Context()); !ok || m.Roles[0] != "admin" {
+				t.Errorf("membership=%+v, %v", m, ok)
+			}
+			w.WriteHeader(204)
+		}),
+	)
+
+	ctx := wsctx.WithSubjectID(context.Background(), "u1")
+	ctx = wsctx.WithScopes(ctx, []string{"orders:write"})
+	ctx = wsctx.WithMemberships(ctx, []wsctx.Membership{
+		{TenantID: "t1", Roles: []string{"admin"}, Scopes: []string{"orders:*"}},
+		{TenantID: "t2", Roles: []string{"viewer"}, Scopes: []string{"orders:read"}},
+	})
+
+	for tenant, want := range map[string]int{"t1": 204, "t2": 403} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+		req.Header.Set(HeaderTenantID, tenant)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("%s: status=%d want=%d", tenant, rr.Code, want)
+		}
+	}
+}
+
+func TestTenant_InvalidRequireScopesPanics(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	_ = Tenant(TenantConfig{RequireScopes: []auth.Scope{"bad scope"}})
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wserr "github.com/hanzy-dev/saas-ws-lib/pkg/errors"
+)
+
+// WebhookScheme describes how webhook signatures are computed and encoded.
+// The signed payload is "<unix timestamp>.<raw body>".
+type WebhookScheme struct {
+	// Prefix precedes each signature value in the header, e.g. "v1=" or "sha256=".
+	// Values without the prefix are ignored. Defaults to "v1=".
+	Prefix string
+
+	// Hash defaults to sha256.New.
+	Hash func() hash.Hash
+
+	// Base64 encodes signatures as standard base64 instead of lowercase hex.
+	Base64 bool
+}
+
+func (s WebhookScheme) withDefaults() WebhookScheme {
+	if s.Prefix == "" {
+		s.Prefix = "v1="
+	}
+	if s.Hash == nil {
+		s.Hash = sha256.New
+	}
+	return s
+}
+
+// Sign returns the signature header value for body sent at ts, e.g. to deliver webhooks
+// to other services or in tests.
+func (s WebhookScheme) Sign(secret []byte, ts time.Time, body []byte) string {
+	s = s.withDefaults()
+	return s.Prefix + s.encode(s.mac(secret, ts.Unix(), body))
+}
+
+func (s WebhookScheme) mac(secret []byte, ts int64, body []byte) []byte {
+	m := hmac.New(s.Hash, secret)
+	m.Write([]byte(strconv.FormatInt(ts, 10)))
+	m.Write([]byte{'.'})
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+func (s WebhookScheme) encode(sum []byte) string {
+	if s.Base64 {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return hex.EncodeToString(sum)
+}
+
+func (s WebhookScheme) decode(v string) ([]byte, error) {
+	if s.Base64 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return hex.DecodeString(v)
+}
+
+// NonceStore records delivered webhooks to reject replays.
+type NonceStore interface {
+	// Claim records nonce until expiresAt. It returns false if nonce is already recorded.
+	Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryNonceStore is an in-process NonceStore, suitable for tests and single-instance
+// services. Entries are forgotten after they expire.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	now    func() time.Time
+}
+
+// NewMemoryNonceStore returns an empty store.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}, now: time.Now}
+}
+
+// Claim implements NonceStore.
+func (s *MemoryNonceStore) Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, exp := range s.nonces {
+		if !exp.After(now) {
+			delete(s.nonces, k)
+		}
+	}
+	if _, ok := s.nonces[nonce]; ok {
+		return false, nil
+	}
+	s.nonces[nonce] = expiresAt
+	return true, nil
+}
+
+type WebhookConfig struct {
+	// Secrets are the active signing secrets. A signature made with any of them is accepted,
+	// so a new secret can be added before the sender switches and the old one removed after.
+	// Required.
+	Secrets [][]byte
+
+	// Scheme defaults to hex HMAC-SHA256 with a "v1=" prefix.
+	Scheme WebhookScheme
+
+	// SignatureHeader defaults to "X-Webhook-Signature". It may carry several
+	// comma- or space-separated signatures (sender-side rotation).
+	SignatureHeader string
+
+	// TimestampHeader defaults to "X-Webhook-Timestamp" (unix seconds).
+	TimestampHeader string
+
+	// Tolerance bounds the age (and clock skew) of a delivery. Defaults to 5m.
+	Tolerance time.Duration
+
+	// BodyLimit bounds the buffered body. Defaults to 1 MiB.
+	BodyLimit int64
+
+	// Nonces, if set, rejects deliveries that were already accepted within Tolerance.
+	// The nonce is derived from the signed content (timestamp and body), so it cannot be
+	// changed without invalidating the signature.
+	Nonces NonceStore
+
+	now func() time.Time
+}
+
+// Webhook verifies timestamped HMAC signatures on inbound webhooks. The body is buffered
+// (within BodyLimit) and handed to next unchanged.
+//
+// A missing, stale or invalid signature is UNAUTHENTICATED; a replay is CONFLICT; an
+// oversized body is RESOURCE_EXHAUSTED; a failing nonce store is UNAVAILABLE.
+func Webhook(cfg WebhookConfig) func(http.Handler) http.Handler {
+	if len(cfg.Secrets) == 0 {
+		panic("middleware.Webhook requires non-empty Secrets")
+	}
+	for _, s := range cfg.Secrets {
+		if len(s) == 0 {
+			panic("middleware.Webhook requires non-empty secrets")
+		}
+	}
+	cfg.Scheme = cfg.Scheme.withDefaults()
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = "X-Webhook-Signature"
+	}
+	if cfg.TimestampHeader == "" {
+		cfg.TimestampHeader = "X-Webhook-Timestamp"
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 5 * time.Minute
+	}
+	if cfg.BodyLimit <= 0 {
+		cfg.BodyLimit = 1 << 20
+	}
+	if cfg.now == nil {
+		cfg.now = time.Now
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.BodyLimit))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					wserr.WriteError(ctx, w, wserr.ResourceExhausted("request body too large"))
+					return
+				}
+				wserr.WriteError(ctx, w, wserr.InvalidArgument("invalid request body"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ts, err := strconv.ParseInt(strings.TrimSpace(r.Header.Get(cfg.TimestampHeader)), 10, 64)
+			if err != nil {
+				wserr.WriteError(ctx, w, wserr.Unauthenticated("invalid signature"))
+				return
+			}
+			now := cfg.now()
+			sent := time.Unix(ts, 0)
+			if sent.Before(now.Add(-cfg.Tolerance)) || sent.After(now.Add(cfg.Tolerance)) {
+				wserr.WriteError(ctx, w, wserr.Unauthenticated("invalid signature"))
+				return
+			}
+
+			if !cfg.verify(r.Header.Get(cfg.SignatureHeader), ts, body) {
+				wserr.WriteError(ctx, w, wserr.Unauthenticated("invalid signature"))
+				return
+			}
+
+			if cfg.Nonces != nil {
+				sum := sha256.Sum256(body)
+				nonce := strconv.FormatInt(ts, 10) + "." + hex.EncodeToString(sum[:])
+				fresh, err := cfg.Nonces.Claim(ctx, nonce, sent.Add(cfg.Tolerance))
+				if err != nil {
+					wserr.WriteError(ctx, w, wserr.Unavailable("service unavailable"))
+					return
+				}
+				if !fresh {
+					wserr.WriteError(ctx, w, wserr.Conflict("duplicate delivery"))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verify reports whether any signature in header verifies under any secret.
+func (cfg WebhookConfig) verify(header string, ts int64, body []byte) bool {
+	fields := strings.FieldsFunc(header, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return false
+	}
+
+	macs := make([][]byte, len(cfg.Secrets))
+	for i, secret := range cfg.Secrets {
+		macs[i] = cfg.Scheme.mac(secret, ts, body)
+	}
+
+	for _, f := range fields {
+		v, ok := strings.CutPrefix(f, cfg.Scheme.Prefix)
+		if !ok {
+			continue
+		}
+		got, err := cfg.Scheme.decode(v)
+		if err != nil {
+			continue
+		}
+		for _, want := range macs {
+			if hmac.Equal(got, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
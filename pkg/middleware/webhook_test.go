@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingNonces struct{}
+
+func (failingNonces) Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	return false, errors.New("redis down")
+}
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+	oldSecret, newSecret := []byte("old"), []byte("new")
+	body := `{"event":"paid"}`
+	ts := strconv.FormatInt(now.Unix(), 10)
+	scheme := WebhookScheme{}
+	nonces := NewMemoryNonceStore()
+	nonces.now = func() time.Time { return now }
+
+	tests := []struct {
+		name   string
+		cfg    WebhookConfig
+		ts     string
+		sig    string
+		body   string
+		want   int
+		repeat int
+	}{
+		{"valid", WebhookConfig{}, ts, scheme.Sign(newSecret, now, []byte(body)), body, 204, 0},
+		{"old secret during rotation", WebhookConfig{}, ts, scheme.Sign(oldSecret, now, []byte(body)), body, 204, 0},
+		{"one of several signatures", WebhookConfig{}, ts, "v1=deadbeef, " + scheme.Sign(newSecret, now, []byte(body)), body, 204, 0},
+		{"unknown secret", WebhookConfig{}, ts, scheme.Sign([]byte("other"), now, []byte(body)), body, 401, 0},
+		{"tampered body", WebhookConfig{}, ts, scheme.Sign(newSecret, now, []byte(body)), `{"event":"refunded"}`, 401, 0},
+		{"missing signature", WebhookConfig{}, ts, "", body, 401, 0},
+		{"wrong prefix", WebhookConfig{}, ts, strings.Replace(scheme.Sign(newSecret, now, []byte(body)), "v1=", "v0=", 1), body, 401, 0},
+		{"missing timestamp", WebhookConfig{}, "", scheme.Sign(newSecret, now, []byte(body)), body, 401, 0},
+		{"stale", WebhookConfig{}, strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10),
+			scheme.Sign(newSecret, now.Add(-6*time.Minute), []byte(body)), body, 401, 0},
+		{"future", WebhookConfig{}, strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10),
+			scheme.Sign(newSecret, now.Add(6*time.Minute), []byte(body)), body, 401, 0},
+		{"too large", WebhookConfig{BodyLimit: 4}, ts, scheme.Sign(newSecret, now, []byte(body)), body, 413, 0},
+		{"replay", WebhookConfig{Nonces: nonces}, ts, scheme.Sign(newSecret, now, []byte(body)), body, 409, 1},
+		{"nonce store down", WebhookConfig{Nonces: failingNonces{}}, ts, scheme.Sign(newSecret, now, []byte(body)), body, 503, 0},
+		{"custom scheme", WebhookConfig{
+			Scheme:          WebhookScheme{Prefix: "sha1=", Hash: sha1.New, Base64: true},
+			SignatureHeader: "X-Hub-Signature",
+			TimestampHeader: "X-Hub-Timestamp",
+		}, ts, WebhookScheme{Prefix: "sha1=", Hash: sha1.New, Base64: true}.Sign(oldSecret, now, []byte(body)), body, 204, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := tt.cfg
+			cfg.Secrets = [][]byte{newSecret, oldSecret}
+			cfg.now = func() time.Time { return now }
+			sigHeader, tsHeader := cfg.SignatureHeader, cfg.TimestampHeader
+			if sigHeader == "" {
+				sigHeader, tsHeader = "X-Webhook-Signature", "X-Webhook-Timestamp"
+			}
+
+			h := Webhook(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, err := io.ReadAll(r.Body)
+				if err != nil || string(got) != tt.body {
+					t.Errorf("handler body=%q err=%v", got, err)
+				}
+				w.WriteHeader(204)
+			}))
+
+			var rec *httptest.ResponseRecorder
+			for range tt.repeat + 1 {
+				req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(tt.body))
+				req.Header.Set(sigHeader, tt.sig)
+				req.Header.Set(tsHeader, tt.ts)
+				rec = httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhook_PanicsWithoutSecrets(t *testing.T) {
+	t.Parallel()
+
+	for _, secrets := range [][][]byte{nil, {[]byte("")}} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("expected panic")
+				}
+			}()
+			_ = Webhook(WebhookConfig{Secrets: secrets})
+		}()
+	}
+}
+
+func TestMemoryNonceStore_Expiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1_700_000_000, 0)
+	s := NewMemoryNonceStore()
+	s.now = func() time.Time { return now }
+
+	if ok, _ := s.Claim(context.Background(), "n1", now.Add(time.Minute)); !ok {
+		t.Fatalf("expected first claim to succeed")
+	}
+	if ok, _ := s.Claim(context.Background(), "n1", now.Add(time.Minute)); ok {
+		t.Fatalf("expected duplicate claim to fail")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := s.Claim(context.Background(), "n1", now.Add(time.Minute)); !ok {
+		t.Fatalf("expected claim after expiry to succeed")
+	}
+}